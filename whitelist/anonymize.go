@@ -0,0 +1,75 @@
+package whitelist
+
+// This file contains the hook used to mask addresses before they are
+// written to logs.
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var anonymizer struct {
+	lock *sync.Mutex
+	fn   func(net.IP) string
+}
+
+func init() {
+	anonymizer.lock = new(sync.Mutex)
+}
+
+// SetAnonymizer registers a function that is applied to every IP
+// address before the package writes it to a log. Passing nil restores
+// the default behaviour of logging full addresses. AnonymizeIP is a
+// suitable anonymizer for most deployments.
+func SetAnonymizer(fn func(net.IP) string) {
+	anonymizer.lock.Lock()
+	defer anonymizer.lock.Unlock()
+	anonymizer.fn = fn
+}
+
+// AnonymizeIP masks the host portion of an address: the last octet of
+// an IPv4 address, or the last 80 bits of an IPv6 address, are zeroed.
+func AnonymizeIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	if len(ip) == net.IPv6len {
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+
+	return ip.String()
+}
+
+// logIP returns the form of the address that should be logged.
+func logIP(ip net.IP) string {
+	anonymizer.lock.Lock()
+	fn := anonymizer.fn
+	anonymizer.lock.Unlock()
+
+	if fn == nil {
+		return ip.String()
+	}
+	return fn(ip)
+}
+
+// anonymizing returns true if an anonymizer has been registered.
+func anonymizing() bool {
+	anonymizer.lock.Lock()
+	defer anonymizer.lock.Unlock()
+	return anonymizer.fn != nil
+}
+
+// logError strips any raw address from an address lookup error if
+// an anonymizer has been registered, as it can't be masked.
+func logError(err error) error {
+	if !anonymizing() {
+		return err
+	}
+
+	if addrErr, ok := err.(*net.AddrError); ok {
+		return errors.New(addrErr.Err)
+	}
+	return err
+}
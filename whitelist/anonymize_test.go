@@ -0,0 +1,96 @@
+package whitelist
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tv := map[string]string{
+		"192.168.3.1":            "192.168.3.0",
+		"::ffff:10.0.1.15":       "10.0.1.0",
+		"2001:db8:1:2:3:4:5:6":   "2001:db8:1::",
+		"2001:db8:ffff:ffff::ff": "2001:db8:ffff::",
+	}
+
+	for in, expected := range tv {
+		if out := AnonymizeIP(net.ParseIP(in)); out != expected {
+			t.Fatalf("Expected %s to be anonymized to %s, but got %s", in, expected, out)
+		}
+	}
+}
+
+func TestAnonymizedLogs(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	SetAnonymizer(AnonymizeIP)
+	defer SetAnonymizer(nil)
+
+	wl := NewHostStub()
+	addIPString(wl, "192.168.3.1", t)
+	checkIPString(wl, "192.168.3.1", t)
+
+	h, err := NewHandler(testAllowHandler, nil, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.3.1"
+	if h.ServeHTTP(w, req); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expect HTTP 500, but got HTTP %d", w.Code)
+	}
+
+	if strings.Contains(buf.String(), "192.168.3.1") {
+		t.Fatalf("Expected no full addresses in logs, but have %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), "192.168.3.0") {
+		t.Fatalf("Expected anonymized addresses in logs, but have %s", buf.String())
+	}
+
+	SetAnonymizer(nil)
+	buf.Reset()
+	checkIPString(wl, "192.168.3.1", t)
+	if !strings.Contains(buf.String(), "192.168.3.1") {
+		t.Fatalf("Expected full addresses in logs, but have %s", buf.String())
+	}
+}
+
+func TestAnonymizedLookupErrors(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	SetAnonymizer(AnonymizeIP)
+	defer SetAnonymizer(nil)
+
+	h, err := NewHandler(testAllowHandler, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[fe80::1%eth0]:80"
+	if h.ServeHTTP(w, req); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expect HTTP 500, but got HTTP %d", w.Code)
+	}
+
+	if strings.Contains(buf.String(), "fe80") {
+		t.Fatalf("Expected no full addresses in logs, but have %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), "invalid address") {
+		t.Fatalf("Expected the lookup failure to be logged, but have %s", buf.String())
+	}
+}
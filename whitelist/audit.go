@@ -0,0 +1,231 @@
+package whitelist
+
+// This file contains audit logging of changes to whitelists.
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Values of the Op field in an AuditEvent.
+const (
+	AuditAdd     = "add"
+	AuditRemove  = "remove"
+	AuditReplace = "replace"
+	AuditClear   = "clear"
+)
+
+// An AuditEvent records a single change to a whitelist: when it was
+// made, by whom, and what was changed. Entry is set for additions and
+// removals; Entries holds the new contents of a replaced whitelist.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Op      string    `json:"op"`
+	Entry   string    `json:"entry,omitempty"`
+	Entries []string  `json:"entries,omitempty"`
+}
+
+// An AuditSink receives an event for each change to an audited
+// whitelist, such as the Log method of an AuditLog.
+type AuditSink func(ev AuditEvent)
+
+// An AuditLog writes audit events to a writer as JSON, with one
+// AuditEvent object per line. Writes are serialised, so the
+// underlying writer doesn't need to be safe for concurrent use.
+type AuditLog struct {
+	lock *sync.Mutex
+	w    io.Writer
+}
+
+// NewAuditLog returns a new AuditLog writing to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{
+		lock: new(sync.Mutex),
+		w:    w,
+	}
+}
+
+// Log writes the event. If the event can't be written, such as when
+// the disk is full or the writer has been closed, the failure is
+// logged, so that lost events don't go unnoticed.
+func (al *AuditLog) Log(ev AuditEvent) {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+	if err := json.NewEncoder(al.w).Encode(ev); err != nil {
+		log.Printf("whitelist: failed to write audit event %s %q by %q: %v",
+			ev.Op, ev.Entry, ev.Actor, err)
+	}
+}
+
+// auditor sends events to a sink on behalf of an actor.
+type auditor struct {
+	sink  AuditSink
+	actor string
+}
+
+func (a auditor) audit(op, entry string, entries []string) {
+	a.sink(AuditEvent{
+		Time:    time.Now(),
+		Actor:   a.actor,
+		Op:      op,
+		Entry:   entry,
+		Entries: entries,
+	})
+}
+
+// AuditedBasic wraps a Basic whitelist so that every change made
+// through it is recorded in an audit sink, along with the actor
+// making the change. Changes made directly to the wrapped whitelist
+// aren't recorded.
+type AuditedBasic struct {
+	wl *Basic
+	auditor
+}
+
+// NewAuditedBasic wraps the whitelist, sending an event for each
+// change to sink. Changes are attributed to an empty actor; use
+// WithActor to attribute them to a user or process.
+func NewAuditedBasic(wl *Basic, sink AuditSink) *AuditedBasic {
+	return &AuditedBasic{
+		wl:      wl,
+		auditor: auditor{sink: sink},
+	}
+}
+
+// WithActor returns a copy of the wrapper whose changes are
+// attributed to actor, such as the authenticated user of an admin
+// endpoint. It shares the underlying whitelist and sink.
+func (aw *AuditedBasic) WithActor(actor string) *AuditedBasic {
+	return &AuditedBasic{
+		wl:      aw.wl,
+		auditor: auditor{sink: aw.sink, actor: actor},
+	}
+}
+
+// Permitted returns true if the IP has been whitelisted.
+func (aw *AuditedBasic) Permitted(ip net.IP) bool {
+	return aw.wl.Permitted(ip)
+}
+
+// Add whitelists the IP, recording the change. Invalid addresses are
+// ignored and not recorded.
+func (aw *AuditedBasic) Add(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	aw.wl.Add(ip)
+	aw.audit(AuditAdd, hostKey(ip), nil)
+}
+
+// Remove drops the IP from the whitelist, recording the change.
+// Invalid addresses are ignored and not recorded.
+func (aw *AuditedBasic) Remove(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	aw.wl.Remove(ip)
+	aw.audit(AuditRemove, hostKey(ip), nil)
+}
+
+// ReplaceAll replaces the contents of the whitelist, as Basic's
+// ReplaceAll does, recording the new contents.
+func (aw *AuditedBasic) ReplaceAll(ips []net.IP) {
+	aw.wl.ReplaceAll(ips)
+
+	entries := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if validIP(ip) {
+			entries = append(entries, hostKey(ip))
+		}
+	}
+	aw.audit(AuditReplace, "", entries)
+}
+
+// Clear removes every host from the whitelist, recording the change.
+func (aw *AuditedBasic) Clear() {
+	aw.wl.ReplaceAll(nil)
+	aw.audit(AuditClear, "", nil)
+}
+
+// AuditedBasicNet wraps a BasicNet whitelist so that every change
+// made through it is recorded in an audit sink, along with the actor
+// making the change. Changes made directly to the wrapped whitelist
+// aren't recorded.
+type AuditedBasicNet struct {
+	wl *BasicNet
+	auditor
+}
+
+// NewAuditedBasicNet wraps the whitelist, sending an event for each
+// change to sink. Changes are attributed to an empty actor; use
+// WithActor to attribute them to a user or process.
+func NewAuditedBasicNet(wl *BasicNet, sink AuditSink) *AuditedBasicNet {
+	return &AuditedBasicNet{
+		wl:      wl,
+		auditor: auditor{sink: sink},
+	}
+}
+
+// WithActor returns a copy of the wrapper whose changes are
+// attributed to actor. It shares the underlying whitelist and sink.
+func (aw *AuditedBasicNet) WithActor(actor string) *AuditedBasicNet {
+	return &AuditedBasicNet{
+		wl:      aw.wl,
+		auditor: auditor{sink: aw.sink, actor: actor},
+	}
+}
+
+// Permitted returns true if the IP is in a whitelisted network.
+func (aw *AuditedBasicNet) Permitted(ip net.IP) bool {
+	return aw.wl.Permitted(ip)
+}
+
+// Add adds the network to the whitelist, recording the change. Nil
+// networks are ignored and not recorded.
+func (aw *AuditedBasicNet) Add(n *net.IPNet) {
+	if n == nil {
+		return
+	}
+
+	aw.wl.Add(n)
+	aw.audit(AuditAdd, netKey(n), nil)
+}
+
+// Remove drops the network from the whitelist, recording the change.
+// Nil networks are ignored and not recorded.
+func (aw *AuditedBasicNet) Remove(n *net.IPNet) {
+	if n == nil {
+		return
+	}
+
+	aw.wl.Remove(n)
+	aw.audit(AuditRemove, netKey(n), nil)
+}
+
+// ReplaceAll replaces the contents of the whitelist, as BasicNet's
+// ReplaceAll does, recording the new contents.
+func (aw *AuditedBasicNet) ReplaceAll(nets []*net.IPNet) {
+	aw.wl.ReplaceAll(nets)
+
+	entries := make([]string, 0, len(nets))
+	for _, n := range nets {
+		if n != nil {
+			entries = append(entries, netKey(n))
+		}
+	}
+	aw.audit(AuditReplace, "", entries)
+}
+
+// Clear removes every network from the whitelist, recording the
+// change.
+func (aw *AuditedBasicNet) Clear() {
+	aw.wl.ReplaceAll(nil)
+	aw.audit(AuditClear, "", nil)
+}
@@ -0,0 +1,107 @@
+package whitelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	_ HostACL = &AuditedBasic{}
+	_ NetACL  = &AuditedBasicNet{}
+)
+
+func TestAuditedBasic(t *testing.T) {
+	var events []AuditEvent
+	wl := NewBasic()
+	aw := NewAuditedBasic(wl, func(ev AuditEvent) {
+		events = append(events, ev)
+	})
+
+	alice := aw.WithActor("alice")
+	alice.Add(net.ParseIP("2001:DB8::1"))
+	alice.Add(nil)
+	aw.Add(net.IP{127, 0, 0, 1})
+	alice.Remove(net.IP{127, 0, 0, 1})
+	alice.ReplaceAll([]net.IP{{10, 0, 0, 1}, nil})
+	if !aw.Permitted(net.IP{10, 0, 0, 1}) || wl.Permitted(net.ParseIP("2001:db8::1")) {
+		t.Fatal("Expected changes to be made to the wrapped whitelist")
+	}
+
+	alice.Clear()
+	if len(wl.whitelist) != 0 {
+		t.Fatal("Expected the whitelist to be cleared")
+	}
+
+	expected := []AuditEvent{
+		{Actor: "alice", Op: AuditAdd, Entry: "2001:db8::1"},
+		{Actor: "", Op: AuditAdd, Entry: "127.0.0.1"},
+		{Actor: "alice", Op: AuditRemove, Entry: "127.0.0.1"},
+		{Actor: "alice", Op: AuditReplace, Entries: []string{"10.0.0.1"}},
+		{Actor: "alice", Op: AuditClear},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, but have %+v", len(expected), events)
+	}
+
+	for i, ev := range events {
+		if ev.Time.IsZero() || ev.Actor != expected[i].Actor || ev.Op != expected[i].Op ||
+			ev.Entry != expected[i].Entry || !equalStrings(ev.Entries, expected[i].Entries) {
+			t.Fatalf("Expected event %+v, but have %+v", expected[i], ev)
+		}
+	}
+}
+
+func TestAuditedBasicNet(t *testing.T) {
+	var buf bytes.Buffer
+	al := NewAuditLog(&buf)
+	aw := NewAuditedBasicNet(NewBasicNet(), al.Log).WithActor("deploy")
+
+	testAddNet(aw, "192.168.3.0/24", t)
+	aw.Add(&net.IPNet{IP: net.IP{10, 1, 2, 3}, Mask: net.CIDRMask(8, 32)})
+	testDelNet(aw, "192.168.3.0/24", t)
+	aw.Clear()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 events, but have %q", buf.String())
+	}
+
+	var ev AuditEvent
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Actor != "deploy" || ev.Op != AuditAdd || ev.Entry != "10.0.0.0/8" {
+		t.Fatalf("Unexpected event %+v", ev)
+	}
+
+	if !strings.Contains(lines[3], `"op":"clear"`) {
+		t.Fatalf("Expected a clear event, but have %s", lines[3])
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAuditLogWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	al := NewAuditLog(failingWriter{})
+	al.Log(AuditEvent{Actor: "deploy", Op: AuditAdd, Entry: "10.0.0.1"})
+
+	if !strings.Contains(buf.String(), "disk full") || !strings.Contains(buf.String(), "10.0.0.1") {
+		t.Fatalf("Expected the failed write to be logged, have %q", buf.String())
+	}
+}
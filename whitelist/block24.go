@@ -0,0 +1,148 @@
+package whitelist
+
+// This file contains a network whitelist optimised for large numbers
+// of small IPv4 networks.
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// Block24Net is a network whitelist optimised for whitelists made up
+// of many IPv4 /24 and smaller networks, such as blocks taken from a
+// provider's contiguous allocations. Such networks are bucketed by
+// their first 24 bits, so that looking up an IPv4 address is a single
+// map lookup followed by a scan of the few networks in its /24. Larger
+// IPv4 networks and IPv6 networks are kept in a list that is scanned
+// on every lookup, as in a BasicNet, so they should be few.
+type Block24Net struct {
+	lock    *sync.Mutex
+	blocks  map[uint32][]*net.IPNet
+	others  []*net.IPNet
+	entries int
+}
+
+// NewBlock24Net returns a new initialised Block24Net.
+func NewBlock24Net() *Block24Net {
+	return &Block24Net{
+		lock:   new(sync.Mutex),
+		blocks: map[uint32][]*net.IPNet{},
+	}
+}
+
+// block24 returns the bucket key for the network: its first 24 bits.
+// It returns false if the network isn't an IPv4 network of at least
+// 24 bits, and so doesn't fit in a bucket.
+func block24(n *net.IPNet) (uint32, bool) {
+	ones, bits := n.Mask.Size()
+	if bits != 32 || ones < 24 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(n.IP) >> 8, true
+}
+
+// Permitted returns true if the IP is in a whitelisted network.
+func (wl *Block24Net) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	if ip4 := ip.To4(); ip4 != nil {
+		for _, n := range wl.blocks[binary.BigEndian.Uint32(ip4)>>8] {
+			if n.Contains(ip4) {
+				return true
+			}
+		}
+	}
+
+	for _, n := range wl.others {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds a network to the whitelist. Invalid networks and networks
+// already in the whitelist are ignored.
+func (wl *Block24Net) Add(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	key := n.String()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	if block, ok := block24(n); ok {
+		for _, entry := range wl.blocks[block] {
+			if entry.String() == key {
+				return
+			}
+		}
+		wl.blocks[block] = append(wl.blocks[block], n)
+	} else {
+		for _, entry := range wl.others {
+			if entry.String() == key {
+				return
+			}
+		}
+		wl.others = append(wl.others, n)
+	}
+	wl.entries++
+}
+
+// Remove drops a network from the whitelist. As with a BasicNet, the
+// exact network must be given: subnets of the network are kept.
+func (wl *Block24Net) Remove(n *net.IPNet) {
+	n = canonicalNet(n)
+	if n == nil {
+		return
+	}
+
+	key := n.String()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	if block, ok := block24(n); ok {
+		nets, removed := removeNet(wl.blocks[block], key)
+		if len(nets) == 0 {
+			delete(wl.blocks, block)
+		} else {
+			wl.blocks[block] = nets
+		}
+
+		if removed {
+			wl.entries--
+		}
+		return
+	}
+
+	var removed bool
+	if wl.others, removed = removeNet(wl.others, key); removed {
+		wl.entries--
+	}
+}
+
+// removeNet returns the networks without the one whose canonical
+// string form is key, and whether it was found.
+func removeNet(nets []*net.IPNet, key string) ([]*net.IPNet, bool) {
+	for i, n := range nets {
+		if n.String() == key {
+			return append(nets[:i], nets[i+1:]...), true
+		}
+	}
+	return nets, false
+}
+
+// Stats returns the number of networks in the whitelist.
+func (wl *Block24Net) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return Stats{Entries: wl.entries}
+}
@@ -0,0 +1,108 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+var _ NetACL = NewBlock24Net()
+
+func TestBlock24Net(t *testing.T) {
+	wl := NewBlock24Net()
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "192.168.4.128/25", t)
+	testAddNet(wl, "192.168.4.7/32", t)
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "2001:db8::/32", t)
+	testAddNet(wl, "192.168.3.0/24", t)
+	wl.Add(&net.IPNet{IP: net.ParseIP("192.168.5.9"), Mask: net.CIDRMask(24, 32)})
+	wl.Add(nil)
+
+	if stats := wl.Stats(); stats.Entries != 6 {
+		t.Fatalf("Expected 6 entries, but have %d", stats.Entries)
+	}
+
+	tv := map[string]bool{
+		"192.168.3.1":        true,
+		"::ffff:192.168.3.1": true,
+		"192.168.4.1":        false,
+		"192.168.4.7":        true,
+		"192.168.4.200":      true,
+		"192.168.5.1":        true,
+		"192.168.6.1":        false,
+		"10.20.30.40":        true,
+		"2001:db8::1":        true,
+		"2001:db9::1":        false,
+	}
+
+	for addr, permitted := range tv {
+		if checkIPString(wl, addr, t) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	testDelNet(wl, "192.168.4.128/25", t)
+	testDelNet(wl, "192.168.4.7/32", t)
+	testDelNet(wl, "10.0.0.0/8", t)
+	testDelNet(wl, "172.16.0.0/12", t)
+	if checkIPString(wl, "192.168.4.200", t) || checkIPString(wl, "10.20.30.40", t) {
+		t.Fatal("Expected removed networks to be denied")
+	}
+
+	if len(wl.blocks) != 2 || wl.Stats().Entries != 3 {
+		t.Fatalf("Expected 2 buckets and 3 entries, but have %d and %d", len(wl.blocks), wl.Stats().Entries)
+	}
+}
+
+// benchmarkBlocks returns 4096 /24 networks taken from 16
+// contiguous provider allocations, and an address in one of them.
+func benchmarkBlocks() ([]*net.IPNet, net.IP) {
+	var nets []*net.IPNet
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 256; j++ {
+			nets = append(nets, &net.IPNet{
+				IP:   net.IP{byte(20 + i), byte(j), byte(i), 0},
+				Mask: net.CIDRMask(24, 32),
+			})
+		}
+	}
+	return nets, net.IP{27, 200, 7, 1}
+}
+
+func BenchmarkBlock24Net(b *testing.B) {
+	nets, ip := benchmarkBlocks()
+	wl := NewBlock24Net()
+	for _, n := range nets {
+		wl.Add(n)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wl.Permitted(ip)
+	}
+}
+
+func BenchmarkBlock24BasicNet(b *testing.B) {
+	nets, ip := benchmarkBlocks()
+	wl := NewBasicNet()
+	wl.ReplaceAll(nets)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wl.Permitted(ip)
+	}
+}
+
+func BenchmarkBlock24Trie(b *testing.B) {
+	nets, ip := benchmarkBlocks()
+	dl := NewTrieDenylist()
+	dl.Load(nets)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dl.Permitted(ip)
+	}
+}
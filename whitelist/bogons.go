@@ -0,0 +1,75 @@
+package whitelist
+
+// This file contains a denylist of bogon addresses.
+
+import "net"
+
+// BogonsVersion identifies the revision of the bogon list used by
+// Bogons. It changes whenever prefixes are added or removed.
+const BogonsVersion = "2026.10.1"
+
+// bogonPrefixes are the networks blocked by Bogons: addresses that
+// are reserved, private, or otherwise should never appear as the
+// source of a packet from the public internet. IPv4-mapped IPv6
+// addresses are checked as the IPv4 addresses they map, so they are
+// covered by the IPv4 prefixes rather than by ::ffff:0:0/96, which
+// would block every IPv4 address.
+var bogonPrefixes = []string{
+	"0.0.0.0/8",       // "This network" (RFC 791)
+	"10.0.0.0/8",      // Private use (RFC 1918)
+	"100.64.0.0/10",   // Shared address space for CGN (RFC 6598)
+	"127.0.0.0/8",     // Loopback (RFC 1122)
+	"169.254.0.0/16",  // Link local (RFC 3927)
+	"172.16.0.0/12",   // Private use (RFC 1918)
+	"192.0.0.0/24",    // IETF protocol assignments (RFC 6890)
+	"192.0.2.0/24",    // Documentation, TEST-NET-1 (RFC 5737)
+	"192.168.0.0/16",  // Private use (RFC 1918)
+	"198.18.0.0/15",   // Benchmarking (RFC 2544)
+	"198.51.100.0/24", // Documentation, TEST-NET-2 (RFC 5737)
+	"203.0.113.0/24",  // Documentation, TEST-NET-3 (RFC 5737)
+	"224.0.0.0/4",     // Multicast (RFC 5771)
+	"240.0.0.0/4",     // Reserved, including broadcast (RFC 1112, RFC 919)
+	"::/128",          // Unspecified address (RFC 4291)
+	"::1/128",         // Loopback (RFC 4291)
+	"100::/64",        // Discard only (RFC 6666)
+	"2001:2::/48",     // Benchmarking (RFC 5180)
+	"2001:10::/28",    // Deprecated ORCHID (RFC 4843)
+	"2001:db8::/32",   // Documentation (RFC 3849)
+	"3fff::/20",       // Documentation (RFC 9637)
+	"fc00::/7",        // Unique local addresses (RFC 4193)
+	"fe80::/10",       // Link local (RFC 4291)
+	"fec0::/10",       // Deprecated site local (RFC 3879)
+	"ff00::/8",        // Multicast (RFC 4291)
+}
+
+// Bogons returns a denylist of the standard bogon prefixes: the
+// reserved, private, loopback, link-local, documentation, and
+// multicast ranges that should never be the source of a connection
+// from the public internet, so that a client using a spoofed source
+// address can't match a whitelist. Its Permitted method returns
+// false for an address in any of them, and true otherwise. It is
+// meant to be checked before the whitelist for internet-facing
+// services, for example with a FuncACL:
+//
+//	bogons := whitelist.Bogons()
+//	acl := whitelist.FuncACL(func(ip net.IP) bool {
+//		return bogons.Permitted(ip) && wl.Permitted(ip)
+//	})
+//
+// Unallocated address space isn't included, as it changes over time.
+// The list is identified by BogonsVersion. Each call returns a new
+// denylist, which may be extended with Add.
+func Bogons() NetACL {
+	nets := make([]*net.IPNet, 0, len(bogonPrefixes))
+	for _, prefix := range bogonPrefixes {
+		_, n, err := net.ParseCIDR(prefix)
+		if err != nil {
+			panic("whitelist: invalid bogon prefix " + prefix)
+		}
+		nets = append(nets, n)
+	}
+
+	dl := NewTrieDenylist()
+	dl.Load(nets)
+	return dl
+}
@@ -0,0 +1,55 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBogons(t *testing.T) {
+	bogons := Bogons()
+	tv := map[string]bool{
+		"0.1.2.3":         false,
+		"10.1.2.3":        false,
+		"100.64.0.1":      false,
+		"127.0.0.1":       false,
+		"192.0.2.1":       false,
+		"198.51.100.7":    false,
+		"203.0.113.9":     false,
+		"224.0.0.1":       false,
+		"255.255.255.255": false,
+		"::ffff:10.1.2.3": false,
+		"::1":             false,
+		"::":              false,
+		"2001:db8::1":     false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"ff02::1":         false,
+		"1.1.1.1":         true,
+		"8.8.8.8":         true,
+		"100.128.0.1":     true,
+		"2606:4700::1111": true,
+		"::ffff:8.8.8.8":  true,
+	}
+
+	for addr, permitted := range tv {
+		if checkIPString(bogons, addr, t) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	// Each call returns an independent denylist.
+	testAddNet(bogons, "1.1.1.0/24", t)
+	if !checkIPString(Bogons(), "1.1.1.1", t) {
+		t.Fatal("Expected a new denylist to be unaffected by changes to another")
+	}
+
+	wl := NewBasicNet()
+	testAddNet(wl, "0.0.0.0/0", t)
+	acl := FuncACL(func(ip net.IP) bool {
+		return bogons.Permitted(ip) && wl.Permitted(ip)
+	})
+
+	if checkIPString(acl, "10.1.2.3", t) || !checkIPString(acl, "8.8.8.8", t) {
+		t.Fatal("Expected bogons to be filtered out before the whitelist")
+	}
+}
@@ -0,0 +1,74 @@
+package whitelist
+
+// This file contains a constructor for ACLs that mix hosts and
+// networks.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// hostsAndNets permits an address if either its host or its network
+// whitelist does.
+type hostsAndNets struct {
+	hosts *Basic
+	nets  *BasicNet
+}
+
+func (wl hostsAndNets) Permitted(ip net.IP) bool {
+	return wl.hosts.Permitted(ip) || wl.nets.Permitted(ip)
+}
+
+// Stats returns the combined number of hosts and networks, and the
+// time either whitelist was last modified.
+func (wl hostsAndNets) Stats() Stats {
+	stats := wl.hosts.Stats()
+	nets := wl.nets.Stats()
+	stats.Entries += nets.Entries
+	if nets.Modified.After(stats.Modified) {
+		stats.Modified = nets.Modified
+	}
+	return stats
+}
+
+// NewFromStrings builds an ACL from a list of entries, each of which
+// is either a bare IP address or a network in CIDR notation or the
+// wildcard shorthand accepted by ParseNet. Hosts
+// are stored in a Basic whitelist and networks in a BasicNet, and an
+// address is permitted if either permits it. Surrounding whitespace
+// is ignored; if any entry can't be parsed, the error lists every
+// such entry.
+func NewFromStrings(entries []string) (ACL, error) {
+	wl := hostsAndNets{
+		hosts: NewBasic(),
+		nets:  NewBasicNet(),
+	}
+
+	var invalid []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.ContainsAny(entry, "/*") {
+			n, err := ParseNet(entry)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%q", entry))
+				continue
+			}
+			wl.nets.Add(n)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			invalid = append(invalid, fmt.Sprintf("%q", entry))
+			continue
+		}
+		wl.hosts.Add(ip)
+	}
+
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("whitelist: invalid entries %s", strings.Join(invalid, ", "))
+	}
+
+	return wl, nil
+}
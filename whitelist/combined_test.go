@@ -0,0 +1,36 @@
+package whitelist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewFromStrings(t *testing.T) {
+	wl, err := NewFromStrings([]string{"10.0.0.0/8", " 127.0.0.1 ", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, addr := range []string{"10.1.2.3", "127.0.0.1", "2001:db8::1", "::1"} {
+		if !checkIPString(wl, addr, t) {
+			t.Fatalf("whitelist should have permitted %s", addr)
+		}
+	}
+
+	for _, addr := range []string{"11.1.2.3", "127.0.0.2", "2001:db9::1"} {
+		if checkIPString(wl, addr, t) {
+			t.Fatalf("whitelist should have denied %s", addr)
+		}
+	}
+
+	_, err = NewFromStrings([]string{"10.0.0.0/33", "127.0.0.1", "localhost", ""})
+	if err == nil {
+		t.Fatal("Expected failure with invalid entries.")
+	}
+
+	for _, entry := range []string{`"10.0.0.0/33"`, `"localhost"`, `""`} {
+		if !strings.Contains(err.Error(), entry) {
+			t.Fatalf("Expected error to list %s, but have %v", entry, err)
+		}
+	}
+}
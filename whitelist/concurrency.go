@@ -0,0 +1,72 @@
+package whitelist
+
+// This file contains a per-address cap on concurrent requests.
+
+import (
+	"net"
+	"sync"
+)
+
+// A ConcurrencyLimit caps the number of requests from each address
+// that a handler serves at once. Being whitelisted doesn't mean that
+// a client's use is unlimited; this protects against a single
+// trusted but misbehaving client. It limits concurrency, not rate.
+type ConcurrencyLimit struct {
+	lock     *sync.Mutex
+	max      int
+	inFlight map[string]int
+}
+
+// NewConcurrencyLimit returns a new ConcurrencyLimit permitting up to
+// max concurrent requests from each address. A non-positive max
+// disables the limit.
+func NewConcurrencyLimit(max int) *ConcurrencyLimit {
+	return &ConcurrencyLimit{
+		lock:     new(sync.Mutex),
+		max:      max,
+		inFlight: map[string]int{},
+	}
+}
+
+// Acquire takes a slot for a request from ip, returning false if the
+// address is already at its limit. Each successful Acquire must be
+// paired with a Release, usually deferred so that the slot is
+// returned even if the request handler panics.
+func (cl *ConcurrencyLimit) Acquire(ip net.IP) bool {
+	if cl.max <= 0 {
+		return true
+	}
+
+	addr := ip.String()
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	if cl.inFlight[addr] >= cl.max {
+		return false
+	}
+	cl.inFlight[addr]++
+	return true
+}
+
+// Release returns a slot taken by Acquire.
+func (cl *ConcurrencyLimit) Release(ip net.IP) {
+	if cl.max <= 0 {
+		return
+	}
+
+	addr := ip.String()
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	if cl.inFlight[addr] <= 1 {
+		delete(cl.inFlight, addr)
+	} else {
+		cl.inFlight[addr]--
+	}
+}
+
+// InFlight returns the number of requests from ip currently being
+// served.
+func (cl *ConcurrencyLimit) InFlight(ip net.IP) int {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	return cl.inFlight[ip.String()]
+}
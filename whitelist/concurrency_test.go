@@ -0,0 +1,92 @@
+package whitelist
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	ip := net.IP{127, 0, 0, 1}
+	cl := NewConcurrencyLimit(2)
+	if !cl.Acquire(ip) || !cl.Acquire(ip) {
+		t.Fatal("Expected two slots to be available")
+	}
+
+	if cl.Acquire(ip) {
+		t.Fatal("Expected the third request to be refused")
+	}
+
+	if !cl.Acquire(net.IP{127, 0, 0, 2}) {
+		t.Fatal("Expected the limit to be per address")
+	}
+
+	cl.Release(ip)
+	if cl.InFlight(ip) != 1 || !cl.Acquire(ip) {
+		t.Fatal("Expected a released slot to be reusable")
+	}
+
+	cl = NewConcurrencyLimit(0)
+	for i := 0; i < 10; i++ {
+		if !cl.Acquire(ip) {
+			t.Fatal("Expected a non-positive limit to be disabled")
+		}
+	}
+}
+
+func TestConcurrencyLimitHandler(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("handler failed")
+		}
+		started <- struct{}{}
+		<-finish
+		w.Write([]byte("OK"))
+	})
+
+	h, err := NewHandlerWithOptions(slow, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.Concurrency = NewConcurrencyLimit(1)
+
+	newReq := func(path string) *http.Request {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		return req
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), newReq("/"))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, newReq("/")); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expect HTTP 503, but got HTTP %d", w.Code)
+	}
+
+	close(finish)
+	<-done
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected the handler to panic")
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), newReq("/panic"))
+	}()
+
+	if n := h.Concurrency.InFlight(net.IP{127, 0, 0, 1}); n != 0 {
+		t.Fatalf("Expected no requests in flight after a panic, have %d", n)
+	}
+}
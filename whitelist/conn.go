@@ -0,0 +1,35 @@
+package whitelist
+
+// This file contains whitelisting for raw network connections.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrConnectionDenied is returned by CheckConn when a connection's
+// remote address isn't whitelisted. The error returned is wrapped
+// with the address, so it should be tested for with errors.Is.
+var ErrConnectionDenied = errors.New("whitelist: connection denied")
+
+// CheckConn checks the remote address of a connection, such as one
+// accepted by a TCP proxy in front of a database, against the ACL.
+// It returns nil if the address is permitted, and an error wrapping
+// ErrConnectionDenied, naming the address, if it isn't; the caller
+// should then close the connection. If the address can't be
+// determined, the lookup error is returned as is, so that the caller
+// can tell the two cases apart; such a connection should also be
+// closed. The address in the error is passed through the anonymizer,
+// if one has been registered with SetAnonymizer.
+func CheckConn(conn net.Conn, acl ACL) error {
+	ip, err := NetConnLookup(conn)
+	if err != nil {
+		return err
+	}
+
+	if !acl.Permitted(ip) {
+		return fmt.Errorf("%w from %s", ErrConnectionDenied, logIP(ip))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package whitelist
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func testConn(addr string) net.Conn {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return &addrConn{addr: tcpAddr}
+}
+
+func TestCheckConn(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	if err := CheckConn(testConn("127.0.0.1:4141"), wl); err != nil {
+		t.Fatalf("Expected a permitted connection, but have %v", err)
+	}
+
+	err := CheckConn(testConn("192.168.3.1:4141"), wl)
+	if !errors.Is(err, ErrConnectionDenied) {
+		t.Fatalf("Expected ErrConnectionDenied, but have %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "192.168.3.1") {
+		t.Fatalf("Expected the error to name the address, but have %v", err)
+	}
+
+	err = CheckConn(new(stubConn), wl)
+	if err == nil || errors.Is(err, ErrConnectionDenied) {
+		t.Fatalf("Expected a lookup error, but have %v", err)
+	}
+}
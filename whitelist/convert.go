@@ -0,0 +1,92 @@
+package whitelist
+
+// This file contains conversions between host and network
+// whitelists.
+
+import (
+	"fmt"
+	"net"
+)
+
+// DefaultExpandLimit is the number of hosts ToHosts will produce if
+// it is called with a non-positive limit.
+const DefaultExpandLimit = 65536
+
+// ToNet returns a network whitelist containing the single-host
+// network (a /32 or a /128) for each host in the whitelist, carrying
+// over any labels. The networks can then be coalesced, such as with
+// DumpBasicNetAggregated.
+func ToNet(wl *Basic) *BasicNet {
+	wl.lock.Lock()
+	nets := make([]*net.IPNet, 0, len(wl.whitelist))
+	labels := map[string]string{}
+	for addr := range wl.whitelist {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+
+		n := hostNet(ip)
+		nets = append(nets, n)
+		if label, ok := wl.labels[addr]; ok {
+			labels[netKey(n)] = label
+		}
+	}
+	wl.lock.Unlock()
+
+	sortNets(nets)
+	out := NewBasicNet()
+	out.whitelist = nets
+	if len(labels) > 0 {
+		out.labels = labels
+	}
+	return out
+}
+
+// ToHosts returns a host whitelist containing every address in the
+// network whitelist, which is intended for whitelists of small
+// networks. Each host is given the label of the first network
+// containing it, if any. If the networks hold more than limit
+// distinct addresses, an error is returned; if limit is not
+// positive, DefaultExpandLimit is used.
+func ToHosts(wl *BasicNet, limit int) (*Basic, error) {
+	if limit <= 0 {
+		limit = DefaultExpandLimit
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	out := NewBasic()
+	for _, n := range wl.whitelist {
+		r, ok := networkRange(n)
+		if !ok {
+			continue
+		}
+
+		label, labelled := wl.labels[netKey(n)]
+		for ip := r.first; ; {
+			addr := hostKey(ip)
+			if !out.whitelist[addr] {
+				if len(out.whitelist) >= limit {
+					return nil, fmt.Errorf("whitelist: networks hold more than %d addresses", limit)
+				}
+
+				out.whitelist[addr] = true
+				if labelled {
+					if out.labels == nil {
+						out.labels = map[string]string{}
+					}
+					out.labels[addr] = label
+				}
+			}
+
+			if ip.Equal(r.last) {
+				break
+			}
+			ip, _ = nextIP(ip)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,64 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestToNet(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "192.168.3.1", t)
+	addIPString(wl, "192.168.3.0", t)
+	addIPString(wl, "2001:db8::1", t)
+	wl.AddLabeled(net.ParseIP("10.0.0.1"), "office")
+
+	nets := ToNet(wl)
+	out, _ := nets.MarshalText()
+	if expected := "10.0.0.1/32,192.168.3.0/32,192.168.3.1/32,2001:db8::1/128"; string(out) != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	if label, _ := nets.Label(net.ParseIP("10.0.0.1")); label != "office" {
+		t.Fatalf("Expected the label to be carried over, but have %q", label)
+	}
+
+	if agg := string(DumpBasicNetAggregated(nets)); agg != "10.0.0.1/32\n192.168.3.0/31\n2001:db8::1/128" {
+		t.Fatalf("Unexpected aggregated networks %q", agg)
+	}
+}
+
+func TestToHosts(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "192.168.3.0/30", t)
+	testAddNet(wl, "192.168.3.2/31", t)
+	wl.AddLabeled(&net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(127, 128)}, "lab")
+
+	hosts, err := ToHosts(wl, 6)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{"192.168.3.0", "192.168.3.1", "192.168.3.2", "192.168.3.3", "2001:db8::", "2001:db8::1"}
+	if entries := hosts.Entries(); !equalStrings(entries, expected) {
+		t.Fatalf("Expected %v, but have %v", expected, entries)
+	}
+
+	if label, _ := hosts.Label(net.ParseIP("2001:db8::1")); label != "lab" {
+		t.Fatalf("Expected the label to be carried over, but have %q", label)
+	}
+
+	if _, err = ToHosts(wl, 5); err == nil {
+		t.Fatal("Expected the limit to be enforced")
+	}
+
+	testAddNet(wl, "10.0.0.0/8", t)
+	if _, err = ToHosts(wl, 0); err == nil {
+		t.Fatal("Expected the default limit to be enforced")
+	}
+
+	wl = NewBasicNet()
+	testAddNet(wl, "255.255.255.254/31", t)
+	if hosts, err = ToHosts(wl, 0); err != nil || len(hosts.whitelist) != 2 {
+		t.Fatalf("Expected the end of the address space to be expanded, have %v", err)
+	}
+}
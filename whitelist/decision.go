@@ -0,0 +1,186 @@
+package whitelist
+
+// This file contains structured logging and counting of whitelisting
+// decisions.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A DecisionEvent is the structured record of a single whitelisting
+// decision. The IP address is passed through the anonymizer, if one
+// has been registered with SetAnonymizer.
+type DecisionEvent struct {
+	Event    string `json:"event"`
+	IP       string `json:"ip"`
+	Decision string `json:"decision"`
+	Path     string `json:"path"`
+}
+
+// Values of the Decision field in a DecisionEvent.
+const (
+	DecisionPermitted = "permitted"
+	DecisionDenied    = "denied"
+)
+
+// A DecisionLog writes whitelisting decisions to a writer as JSON,
+// with one DecisionEvent object per line, so that log aggregators can
+// index them. Writes are serialised, so the underlying writer
+// doesn't need to be safe for concurrent use.
+type DecisionLog struct {
+	lock *sync.Mutex
+	w    io.Writer
+}
+
+// NewDecisionLog returns a new DecisionLog writing to w.
+func NewDecisionLog(w io.Writer) *DecisionLog {
+	return &DecisionLog{
+		lock: new(sync.Mutex),
+		w:    w,
+	}
+}
+
+// Log writes the decision for a request from ip.
+func (dl *DecisionLog) Log(req *http.Request, ip net.IP, permitted bool) {
+	ev := DecisionEvent{
+		Event:    "whitelist.decision",
+		IP:       logIP(ip),
+		Decision: DecisionDenied,
+	}
+
+	if permitted {
+		ev.Decision = DecisionPermitted
+	}
+
+	if req != nil && req.URL != nil {
+		ev.Path = req.URL.Path
+	}
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	json.NewEncoder(dl.w).Encode(ev)
+}
+
+// A Counter is incremented once per event. It can be backed by any
+// metrics system, or by expvar or an atomic integer.
+type Counter interface {
+	Inc()
+}
+
+// DecisionCounters are incremented by a handler for each whitelisting
+// decision. Either counter may be nil.
+type DecisionCounters struct {
+	Permitted Counter
+	Denied    Counter
+}
+
+// count increments the counter for the decision.
+func (dc *DecisionCounters) count(permitted bool) {
+	if permitted && dc.Permitted != nil {
+		dc.Permitted.Inc()
+	} else if !permitted && dc.Denied != nil {
+		dc.Denied.Inc()
+	}
+}
+
+// accessLogLock serialises writes to access logs, so that lines from
+// concurrent requests aren't interleaved.
+var accessLogLock sync.Mutex
+
+// clfTimeFormat is the timestamp format used in Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// writeAccessLog writes a line in the style of the Common Log Format
+// describing the decision for a request. The fields are the client
+// address (passed through the anonymizer), the identity and user
+// fields (always "-"), the time in brackets, the quoted request line,
+// and the decision ("permitted" or "denied") in place of the status
+// and size, which aren't known when the decision is made:
+//
+//	127.0.0.1 - - [10/Oct/2017:13:55:36 -0700] "GET /index.html HTTP/1.1" permitted
+func writeAccessLog(w io.Writer, req *http.Request, ip net.IP, permitted bool) {
+	decision := DecisionDenied
+	if permitted {
+		decision = DecisionPermitted
+	}
+
+	var uri string
+	if req.URL != nil {
+		uri = req.URL.RequestURI()
+	}
+
+	line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %s\n", logIP(ip),
+		time.Now().Format(clfTimeFormat), req.Method, uri, req.Proto,
+		decision)
+
+	accessLogLock.Lock()
+	defer accessLogLock.Unlock()
+	io.WriteString(w, line)
+}
+
+// A DecisionSink receives the whitelisting decision for a single
+// request, such as a function that records it in the request's
+// access log entry.
+type DecisionSink func(ip net.IP, permitted bool)
+
+type decisionSinkKey struct{}
+
+// WithDecisionSink returns a copy of ctx carrying sink. A handler
+// serving a request whose context carries a sink passes its decision
+// to the sink, so that middleware that builds a log entry for each
+// request can attach the decision to it: the middleware installs a
+// sink writing to its entry before calling the handler. Requests
+// without a sink are unaffected.
+func WithDecisionSink(ctx context.Context, sink DecisionSink) context.Context {
+	return context.WithValue(ctx, decisionSinkKey{}, sink)
+}
+
+// requestSink returns the decision sink carried by the request's
+// context, if any.
+func requestSink(req *http.Request) DecisionSink {
+	sink, _ := req.Context().Value(decisionSinkKey{}).(DecisionSink)
+	return sink
+}
+
+// Attributes set on a tracing span for each whitelisting decision.
+const (
+	SpanAttributeDecision = "allowlist.decision"
+	SpanAttributeIP       = "allowlist.ip"
+)
+
+// A Span is a tracing span, such as an OpenTelemetry span, on which
+// a handler records its whitelisting decision as string attributes.
+// The package doesn't depend on any tracing library; callers supply a
+// small adapter for theirs.
+type Span interface {
+	SetAttribute(key, value string)
+}
+
+// A SpanFunc returns the span carried by a request context, or nil
+// if there isn't one.
+type SpanFunc func(ctx context.Context) Span
+
+// annotate records the decision for a request from ip on the span
+// returned by fn, if any. The IP address is passed through the
+// anonymizer, if one has been registered with SetAnonymizer.
+func (fn SpanFunc) annotate(req *http.Request, ip net.IP, permitted bool) {
+	span := fn(req.Context())
+	if span == nil {
+		return
+	}
+
+	decision := DecisionDenied
+	if permitted {
+		decision = DecisionPermitted
+	}
+
+	span.SetAttribute(SpanAttributeDecision, decision)
+	span.SetAttribute(SpanAttributeIP, logIP(ip))
+}
@@ -0,0 +1,217 @@
+package whitelist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecisionLog(t *testing.T) {
+	var buf bytes.Buffer
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.DecisionLog = NewDecisionLog(&buf)
+
+	for _, addr := range []string{"127.0.0.1:4141", "192.168.3.1:4141"} {
+		req := httptest.NewRequest("GET", "/files/a.txt?v=1", nil)
+		req.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var events []DecisionEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev DecisionEvent
+		if err = dec.Decode(&ev); err != nil {
+			t.Fatalf("%v", err)
+		}
+		events = append(events, ev)
+	}
+
+	expected := []DecisionEvent{
+		{"whitelist.decision", "127.0.0.1", DecisionPermitted, "/files/a.txt"},
+		{"whitelist.decision", "192.168.3.1", DecisionDenied, "/files/a.txt"},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, but have %d", len(expected), len(events))
+	}
+
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected event %+v, but have %+v", expected[i], events[i])
+		}
+	}
+}
+
+type testCounter int
+
+func (c *testCounter) Inc() {
+	*c++
+}
+
+func TestDecisionCounters(t *testing.T) {
+	var permitted, denied testCounter
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.Counters = &DecisionCounters{Permitted: &permitted, Denied: &denied}
+
+	for _, addr := range []string{"127.0.0.1:4141", "192.168.3.1:4141", "192.168.3.2:4141"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if permitted != 1 || denied != 2 {
+		t.Fatalf("Expected 1 permitted and 2 denied, but have %d and %d", permitted, denied)
+	}
+
+	h.Counters.Permitted = nil
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.AccessLog = &buf
+
+	for _, addr := range []string{"127.0.0.1:4141", "192.168.3.1:4141"} {
+		req := httptest.NewRequest("POST", "/files/a.txt?v=1", nil)
+		req.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, but have %d", len(lines))
+	}
+
+	expected := []struct{ prefix, suffix string }{
+		{"127.0.0.1 - - [", `] "POST /files/a.txt?v=1 HTTP/1.1" permitted`},
+		{"192.168.3.1 - - [", `] "POST /files/a.txt?v=1 HTTP/1.1" denied`},
+	}
+
+	for i := range expected {
+		if !strings.HasPrefix(lines[i], expected[i].prefix) || !strings.HasSuffix(lines[i], expected[i].suffix) {
+			t.Fatalf("Unexpected access log line %s", lines[i])
+		}
+	}
+}
+
+func TestDecisionSink(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	type logEntry struct {
+		ip        string
+		permitted bool
+	}
+
+	for _, addr := range []string{"127.0.0.1", "192.168.3.1"} {
+		var entry logEntry
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr + ":4141"
+		req = req.WithContext(WithDecisionSink(req.Context(), func(ip net.IP, permitted bool) {
+			entry = logEntry{ip.String(), permitted}
+		}))
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if entry.ip != addr || entry.permitted != (addr == "127.0.0.1") {
+			t.Fatalf("Unexpected decision %+v for %s", entry, addr)
+		}
+	}
+
+	// Requests without a sink are unaffected.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+}
+
+// testSpan is a Span recording its attributes.
+type testSpan map[string]string
+
+func (span testSpan) SetAttribute(key, value string) {
+	span[key] = value
+}
+
+type testSpanKey struct{}
+
+func TestDecisionSpan(t *testing.T) {
+	SetAnonymizer(AnonymizeIP)
+	defer SetAnonymizer(nil)
+
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	h.Span = func(ctx context.Context) Span {
+		span, _ := ctx.Value(testSpanKey{}).(testSpan)
+		if span == nil {
+			return nil
+		}
+		return span
+	}
+
+	tv := map[string]string{
+		"127.0.0.1":   DecisionPermitted,
+		"192.168.3.1": DecisionDenied,
+	}
+
+	for addr, decision := range tv {
+		span := testSpan{}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr + ":4141"
+		req = req.WithContext(context.WithValue(req.Context(), testSpanKey{}, span))
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if span[SpanAttributeDecision] != decision {
+			t.Fatalf("Expected decision %s for %s, but have %v", decision, addr, span)
+		}
+
+		if expected := AnonymizeIP(net.ParseIP(addr)); span[SpanAttributeIP] != expected {
+			t.Fatalf("Expected IP attribute %s, but have %v", expected, span)
+		}
+	}
+
+	// Requests without a span are unaffected.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+}
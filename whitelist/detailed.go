@@ -0,0 +1,76 @@
+package whitelist
+
+// This file contains three-state decisions, which distinguish an ACL
+// that couldn't reach a decision from one that denied an address.
+
+import (
+	"errors"
+	"net"
+)
+
+// A Decision is the outcome of checking an address against an ACL.
+type Decision int
+
+// The possible decisions. The zero value is Indeterminate, so that
+// an unset Decision is never mistaken for Allow.
+const (
+	// Indeterminate means that the ACL couldn't decide, such as
+	// when a lookup it depends on failed. It is accompanied by
+	// the error that prevented a decision.
+	Indeterminate Decision = iota
+
+	// Allow means that the address is whitelisted.
+	Allow
+
+	// Deny means that the address isn't whitelisted.
+	Deny
+)
+
+// String returns "allow", "deny", or "indeterminate".
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return "indeterminate"
+	}
+}
+
+// A DetailedACL is an ACL that can report why it couldn't decide
+// whether an address is permitted. Its Permitted method treats an
+// indeterminate decision as a denial.
+type DetailedACL interface {
+	ACL
+
+	// PermittedDetailed returns the decision for the IP. The
+	// error is non-nil if and only if the decision is
+	// Indeterminate.
+	PermittedDetailed(net.IP) (Decision, error)
+}
+
+// errInvalidIP is returned with an Indeterminate decision for an
+// address that is nil or malformed.
+var errInvalidIP = errors.New("whitelist: invalid IP address")
+
+// PermittedDetailed returns the decision of the ACL for the IP. If
+// the ACL is a DetailedACL, its PermittedDetailed method is used, so
+// that callers can tell failures, which they might alert on, from
+// denials; any other ACL either allows or denies. An invalid address
+// is always Indeterminate. Handlers keep treating anything but Allow
+// as a denial.
+func PermittedDetailed(acl ACL, ip net.IP) (Decision, error) {
+	if !validIP(ip) {
+		return Indeterminate, errInvalidIP
+	}
+
+	if dacl, ok := acl.(DetailedACL); ok {
+		return dacl.PermittedDetailed(ip)
+	}
+
+	if acl.Permitted(ip) {
+		return Allow, nil
+	}
+	return Deny, nil
+}
@@ -0,0 +1,186 @@
+package whitelist
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// flakyNet is a NetACL whose decisions are indeterminate while
+// fail is set.
+type flakyNet struct {
+	*BasicNet
+	fail   bool
+	checks int
+}
+
+func (wl *flakyNet) PermittedDetailed(ip net.IP) (Decision, error) {
+	wl.checks++
+	if wl.fail {
+		return Indeterminate, errors.New("backend unavailable")
+	}
+
+	if wl.BasicNet.Permitted(ip) {
+		return Allow, nil
+	}
+	return Deny, nil
+}
+
+func TestDecisionString(t *testing.T) {
+	tv := map[Decision]string{
+		Allow:         "allow",
+		Deny:          "deny",
+		Indeterminate: "indeterminate",
+		Decision(42):  "indeterminate",
+	}
+
+	for d, s := range tv {
+		if d.String() != s {
+			t.Fatalf("Expected %q, have %q", s, d.String())
+		}
+	}
+
+	var d Decision
+	if d != Indeterminate {
+		t.Fatal("Expected the zero Decision to be Indeterminate")
+	}
+}
+
+func TestPermittedDetailed(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+
+	if d, err := PermittedDetailed(wl, net.IP{127, 0, 0, 1}); d != Allow || err != nil {
+		t.Fatalf("Expected allow, have %v (%v)", d, err)
+	}
+
+	if d, err := PermittedDetailed(wl, net.IP{127, 0, 0, 2}); d != Deny || err != nil {
+		t.Fatalf("Expected deny, have %v (%v)", d, err)
+	}
+
+	if d, err := PermittedDetailed(wl, nil); d != Indeterminate || err == nil {
+		t.Fatalf("Expected an invalid address to be indeterminate, have %v (%v)", d, err)
+	}
+}
+
+func TestCachedNetDetailed(t *testing.T) {
+	flaky := &flakyNet{BasicNet: NewBasicNet(), fail: true}
+	testAddNet(flaky, "10.0.0.0/8", t)
+	wl := NewCachedNet(flaky, 0)
+
+	d, err := PermittedDetailed(wl, net.IP{10, 0, 0, 1})
+	if d != Indeterminate || err == nil {
+		t.Fatalf("Expected indeterminate, have %v (%v)", d, err)
+	}
+
+	if wl.Permitted(net.IP{10, 0, 0, 1}) {
+		t.Fatal("Expected an indeterminate decision to deny the address")
+	}
+
+	// Indeterminate decisions aren't cached.
+	flaky.fail = false
+	for i := 0; i < 2; i++ {
+		if d, err = wl.PermittedDetailed(net.IP{10, 0, 0, 1}); d != Allow || err != nil {
+			t.Fatalf("Expected allow, have %v (%v)", d, err)
+		}
+	}
+
+	if flaky.checks != 3 {
+		t.Fatalf("Expected 3 checks of the wrapped ACL, have %d", flaky.checks)
+	}
+
+	// Nor are they cached by Warmup.
+	flaky.fail = true
+	wl.Warmup([]net.IP{{10, 0, 0, 2}})
+	flaky.fail = false
+	if d, err = wl.PermittedDetailed(net.IP{10, 0, 0, 2}); d != Allow || err != nil {
+		t.Fatalf("Expected allow, have %v (%v)", d, err)
+	}
+
+	if flaky.checks != 5 {
+		t.Fatalf("Expected 5 checks of the wrapped ACL, have %d", flaky.checks)
+	}
+}
+
+func TestPTRSuffixACLDetailed(t *testing.T) {
+	wl, err := NewPTRSuffixACL([]string{"example.com"}, time.Hour)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		switch addr {
+		case "192.168.3.1":
+			return []string{"host.example.com."}, nil
+		case "192.168.3.2":
+			return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+		case "192.168.3.3":
+			return []string{"slow.example.com."}, nil
+		}
+		return nil, &net.DNSError{Err: "i/o timeout", Name: addr, IsTimeout: true}
+	}
+	wl.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "host.example.com." {
+			return []string{"192.168.3.1"}, nil
+		}
+		return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+	}
+
+	tv := map[string]Decision{
+		"192.168.3.1": Allow,
+		"192.168.3.2": Deny,
+		"192.168.3.3": Indeterminate,
+		"192.168.3.4": Indeterminate,
+	}
+
+	for addr, expected := range tv {
+		d, err := PermittedDetailed(wl, net.ParseIP(addr))
+		if d != expected || (err != nil) != (expected == Indeterminate) {
+			t.Fatalf("Expected %v for %s, have %v (%v)", expected, addr, d, err)
+		}
+
+		if wl.Permitted(net.ParseIP(addr)) != (expected == Allow) {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, expected == Allow)
+		}
+	}
+}
+
+func TestPTRSuffixACLRetry(t *testing.T) {
+	wl, err := NewPTRSuffixACL([]string{"example.com"}, time.Hour)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fail := true
+	lookups := 0
+	wl.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if fail {
+			return nil, &net.DNSError{Err: "i/o timeout", Name: addr, IsTimeout: true}
+		}
+		return []string{"host.example.com."}, nil
+	}
+	wl.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.168.3.1"}, nil
+	}
+
+	ip := net.IP{192, 168, 3, 1}
+	if d, err := wl.PermittedDetailed(ip); d != Indeterminate || err == nil {
+		t.Fatalf("Expected indeterminate, have %v (%v)", d, err)
+	}
+
+	// The failure isn't cached, so the next check looks up the
+	// address again; its result is then cached.
+	fail = false
+	for i := 0; i < 2; i++ {
+		if d, err := wl.PermittedDetailed(ip); d != Allow || err != nil {
+			t.Fatalf("Expected allow, have %v (%v)", d, err)
+		}
+	}
+
+	if lookups != 2 {
+		t.Fatalf("Expected 2 lookups, have %d", lookups)
+	}
+}
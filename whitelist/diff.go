@@ -0,0 +1,173 @@
+package whitelist
+
+// This file contains functions for comparing whitelists.
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// canonicalIP returns the 4-byte form of IPv4 addresses and the
+// 16-byte form of IPv6 addresses.
+func canonicalIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// canonicalNet returns the network with its address masked and in
+// the same form as its mask, or nil if the network is invalid.
+func canonicalNet(n *net.IPNet) *net.IPNet {
+	r, ok := networkRange(n)
+	if !ok {
+		return nil
+	}
+
+	ones, bits := n.Mask.Size()
+	return &net.IPNet{IP: r.first, Mask: net.CIDRMask(ones, bits)}
+}
+
+// sortIPs sorts addresses with IPv4 addresses first.
+func sortIPs(ips []net.IP) {
+	sort.Slice(ips, func(i, j int) bool {
+		if len(ips[i]) != len(ips[j]) {
+			return len(ips[i]) < len(ips[j])
+		}
+		return bytes.Compare(ips[i], ips[j]) < 0
+	})
+}
+
+// sortNets sorts networks by address with IPv4 networks first;
+// networks with the same address are sorted by prefix length.
+func sortNets(nets []*net.IPNet) {
+	sort.Slice(nets, func(i, j int) bool {
+		if len(nets[i].IP) != len(nets[j].IP) {
+			return len(nets[i].IP) < len(nets[j].IP)
+		}
+
+		if c := bytes.Compare(nets[i].IP, nets[j].IP); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(nets[i].Mask, nets[j].Mask) < 0
+	})
+}
+
+// hostSet returns the canonical addresses in the whitelist, keyed by
+// their string form.
+func hostSet(wl *Basic) map[string]net.IP {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	set := make(map[string]net.IP, len(wl.whitelist))
+	for addr := range wl.whitelist {
+		ip := net.ParseIP(addr)
+		if ip != nil {
+			ip = canonicalIP(ip)
+			set[ip.String()] = ip
+		}
+	}
+	return set
+}
+
+// netSet returns the canonical networks in the whitelist, keyed by
+// their string form.
+func netSet(wl *BasicNet) map[string]*net.IPNet {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	set := make(map[string]*net.IPNet, len(wl.whitelist))
+	for _, n := range wl.whitelist {
+		if n = canonicalNet(n); n != nil {
+			set[n.String()] = n
+		}
+	}
+	return set
+}
+
+// Diff compares two host whitelists, returning the addresses in b
+// that aren't in a (added) and the addresses in a that aren't in b
+// (removed). Addresses are canonicalised before they are compared,
+// and both lists are sorted with IPv4 addresses first.
+func Diff(a, b *Basic) (added, removed []net.IP) {
+	as, bs := hostSet(a), hostSet(b)
+	for addr, ip := range bs {
+		if _, ok := as[addr]; !ok {
+			added = append(added, ip)
+		}
+	}
+
+	for addr, ip := range as {
+		if _, ok := bs[addr]; !ok {
+			removed = append(removed, ip)
+		}
+	}
+
+	sortIPs(added)
+	sortIPs(removed)
+	return added, removed
+}
+
+// DiffNet compares two network whitelists, returning the networks in
+// b that aren't in a (added) and the networks in a that aren't in b
+// (removed). Networks are canonicalised before they are compared, but
+// are otherwise compared exactly: a network that is covered by a
+// larger one in the other whitelist is still reported.
+func DiffNet(a, b *BasicNet) (added, removed []*net.IPNet) {
+	as, bs := netSet(a), netSet(b)
+	for key, n := range bs {
+		if _, ok := as[key]; !ok {
+			added = append(added, n)
+		}
+	}
+
+	for key, n := range as {
+		if _, ok := bs[key]; !ok {
+			removed = append(removed, n)
+		}
+	}
+
+	sortNets(added)
+	sortNets(removed)
+	return added, removed
+}
+
+// Equal returns true if the two host whitelists contain the same
+// addresses, regardless of the order in which they were added or how
+// they were written. As with Diff, addresses are canonicalised before
+// they are compared, so an IPv4 address is equal to its IPv4-mapped
+// IPv6 form. Labels aren't compared.
+func Equal(a, b *Basic) bool {
+	as, bs := hostSet(a), hostSet(b)
+	if len(as) != len(bs) {
+		return false
+	}
+
+	for addr := range as {
+		if _, ok := bs[addr]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualNet returns true if the two network whitelists contain the
+// same networks, regardless of order and duplicates. As with DiffNet,
+// networks are canonicalised before they are compared, but are
+// otherwise compared exactly: whitelists that permit the same
+// addresses using different networks aren't equal. Labels aren't
+// compared.
+func EqualNet(a, b *BasicNet) bool {
+	as, bs := netSet(a), netSet(b)
+	if len(as) != len(bs) {
+		return false
+	}
+
+	for key := range as {
+		if _, ok := bs[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
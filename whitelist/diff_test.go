@@ -0,0 +1,104 @@
+package whitelist
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, b := NewBasic(), NewBasic()
+	if err := a.UnmarshalText([]byte("127.0.0.1,10.0.1.15,2001:DB8::1,::ffff:192.168.1.5")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := b.UnmarshalText([]byte("192.168.1.5,2001:db8::1,10.0.1.16,::1,127.0.0.2")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	added, removed := Diff(a, b)
+	if s := fmt.Sprint(added); s != "[10.0.1.16 127.0.0.2 ::1]" {
+		t.Fatalf("Unexpected additions %s", s)
+	}
+
+	if s := fmt.Sprint(removed); s != "[10.0.1.15 127.0.0.1]" {
+		t.Fatalf("Unexpected removals %s", s)
+	}
+
+	added, removed = Diff(a, a)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatal("Expected no differences comparing a whitelist with itself")
+	}
+}
+
+func TestDiffNet(t *testing.T) {
+	a, b := NewBasicNet(), NewBasicNet()
+	testAddNet(a, "192.168.0.0/16", t)
+	testAddNet(a, "10.0.0.0/8", t)
+	a.Add(&net.IPNet{IP: net.ParseIP("172.16.1.1"), Mask: net.CIDRMask(12, 32)})
+
+	testAddNet(b, "172.16.0.0/12", t)
+	testAddNet(b, "192.168.3.0/24", t)
+	testAddNet(b, "2001:db8::/32", t)
+	testAddNet(b, "192.168.0.0/24", t)
+
+	added, removed := DiffNet(a, b)
+	if s := fmt.Sprint(added); s != "[192.168.0.0/24 192.168.3.0/24 2001:db8::/32]" {
+		t.Fatalf("Unexpected additions %s", s)
+	}
+
+	if s := fmt.Sprint(removed); s != "[10.0.0.0/8 192.168.0.0/16]" {
+		t.Fatalf("Unexpected removals %s", s)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, b := NewBasic(), NewBasic()
+	if !Equal(a, b) {
+		t.Fatal("Expected empty whitelists to be equal")
+	}
+
+	if err := a.UnmarshalText([]byte("127.0.0.1,2001:DB8::1,::ffff:192.168.1.5")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	b.AddLabeled(net.ParseIP("192.168.1.5"), "office")
+	b.Add(net.ParseIP("2001:0db8::0001"))
+	b.Add(net.IP{127, 0, 0, 1})
+	if !Equal(a, b) || !Equal(b, a) {
+		t.Fatal("Expected whitelists with the same addresses to be equal")
+	}
+
+	b.Add(net.ParseIP("::1"))
+	if Equal(a, b) || Equal(b, a) {
+		t.Fatal("Expected whitelists with different addresses not to be equal")
+	}
+
+	a.Add(net.ParseIP("::2"))
+	if Equal(a, b) {
+		t.Fatal("Expected whitelists of the same size with different addresses not to be equal")
+	}
+}
+
+func TestEqualNet(t *testing.T) {
+	a, b := NewBasicNet(), NewBasicNet()
+	testAddNet(a, "10.0.0.0/8", t)
+	testAddNet(a, "2001:db8::/32", t)
+	a.Add(&net.IPNet{IP: net.ParseIP("172.16.1.1"), Mask: net.CIDRMask(12, 32)})
+
+	testAddNet(b, "2001:db8::/32", t)
+	testAddNet(b, "172.16.0.0/12", t)
+	testAddNet(b, "10.0.0.0/8", t)
+	testAddNet(b, "10.0.0.0/8", t)
+	if !EqualNet(a, b) || !EqualNet(b, a) {
+		t.Fatal("Expected whitelists with the same networks to be equal")
+	}
+
+	// The same addresses, but different networks.
+	testAddNet(a, "192.168.0.0/24", t)
+	testAddNet(b, "192.168.0.0/25", t)
+	testAddNet(b, "192.168.0.128/25", t)
+	if EqualNet(a, b) {
+		t.Fatal("Expected whitelists with different networks not to be equal")
+	}
+}
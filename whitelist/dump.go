@@ -0,0 +1,290 @@
+package whitelist
+
+// This file contains canonical, diff-friendly dumps of whitelists,
+// conversions to and from lists of entries for storage, and
+// compressed dumps.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func canonicalHosts(wl *Basic) []string {
+	set := hostSet(wl)
+	ips := make([]net.IP, 0, len(set))
+	for _, ip := range set {
+		ips = append(ips, ip)
+	}
+	sortIPs(ips)
+
+	ss := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ss = append(ss, ip.String())
+	}
+	return ss
+}
+
+func canonicalNets(wl *BasicNet) []string {
+	var ss []string
+	for _, n := range snapshotNets(wl) {
+		s := n.String()
+		if len(ss) == 0 || ss[len(ss)-1] != s {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// DumpCanonical returns a whitelist as a byte slice with one entry
+// per line, in a canonical form suitable for keeping in version
+// control: entries are normalised, duplicates are dropped, and
+// entries are sorted by address with IPv4 before IPv6. For an ACL
+// built by NewFromStrings, hosts are listed before networks. Only
+// Basic, BasicNet, and ACLs built by NewFromStrings are supported;
+// nil is returned for other ACLs.
+func DumpCanonical(acl ACL) []byte {
+	ss, ok := canonicalEntries(acl)
+	if !ok {
+		return nil
+	}
+
+	return []byte(strings.Join(ss, "\n"))
+}
+
+// canonicalEntries returns the entries of an ACL supported by
+// DumpCanonical, in the same order.
+func canonicalEntries(acl ACL) ([]string, bool) {
+	switch wl := acl.(type) {
+	case *Basic:
+		return canonicalHosts(wl), true
+	case *BasicNet:
+		return canonicalNets(wl), true
+	case hostsAndNets:
+		return append(canonicalHosts(wl.hosts), canonicalNets(wl.nets)...), true
+	default:
+		return nil, false
+	}
+}
+
+// dumpJSON returns the ACL as JSON for NewDumpHandler.
+func dumpJSON(acl ACL) ([]byte, error) {
+	var ss []string
+	switch wl := acl.(type) {
+	case *Basic:
+		ss = canonicalHosts(wl)
+	case *BasicNet:
+		ss = canonicalNets(wl)
+	case hostsAndNets:
+		// There is no MarshalJSON method; an array of entries
+		// can be passed back to NewFromStrings.
+		ss, _ = canonicalEntries(wl)
+		if ss == nil {
+			ss = []string{}
+		}
+		return json.Marshal(ss)
+	}
+
+	m, ok := acl.(json.Marshaler)
+	if !ok {
+		return nil, errors.New("whitelist: ACL can't be serialised")
+	}
+
+	out, err := m.MarshalJSON()
+	if err != nil || ss == nil || len(out) == 0 || out[0] != '"' {
+		// Labelled whitelists are serialised as an object,
+		// whose keys are already sorted.
+		return out, err
+	}
+
+	// A whitelist without labels is serialised as a string,
+	// which lists its entries in canonical order instead.
+	return json.Marshal(strings.Join(ss, ","))
+}
+
+// NewDumpHandler returns a handler that serves the ACL as JSON.
+// Basic and BasicNet whitelists are served in the format of their
+// MarshalJSON methods, so that the dump can be loaded back with
+// UnmarshalJSON, labels included, but with their entries in
+// canonical order. ACLs built by NewFromStrings are served as an
+// array of their entries, in canonical order. Other ACLs are served
+// using their own MarshalJSON method, if they have one, and fail
+// with a 500 otherwise. The handler doesn't restrict access, so it
+// should be wrapped with suitable authentication or a whitelist of
+// its own.
+func NewDumpHandler(acl ACL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		out, err := dumpJSON(acl)
+
+		if err != nil {
+			log.Printf("whitelist: failed to dump whitelist: %v", err)
+			status := http.StatusInternalServerError
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	})
+}
+
+// Entries returns the addresses in the whitelist in canonical form,
+// sorted as for DumpCanonical, e.g. for storing one row per entry.
+func (wl *Basic) Entries() []string {
+	return canonicalHosts(wl)
+}
+
+// Entries returns the networks in the whitelist in canonical form,
+// sorted as for DumpCanonical and without duplicates, e.g. for
+// storing one row per entry.
+func (wl *BasicNet) Entries() []string {
+	return canonicalNets(wl)
+}
+
+// LoadBasicEntries builds a host whitelist from a list of addresses,
+// such as those returned by Entries.
+func LoadBasicEntries(entries []string) (*Basic, error) {
+	wl := NewBasic()
+	for _, entry := range entries {
+		ip := net.ParseIP(strings.TrimSpace(entry))
+		if ip == nil {
+			return nil, fmt.Errorf("whitelist: invalid address %q", entry)
+		}
+		wl.Add(canonicalIP(ip))
+	}
+	return wl, nil
+}
+
+// LoadBasicNetEntries builds a network whitelist from a list of
+// networks, such as those returned by Entries.
+func LoadBasicNetEntries(entries []string) (*BasicNet, error) {
+	wl := NewBasicNet()
+	for _, entry := range entries {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, fmt.Errorf("whitelist: invalid network %q", entry)
+		}
+		wl.Add(n)
+	}
+	return wl, nil
+}
+
+// gzipMagic is the two-byte header that begins every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// scanMaybeGzip calls scanLines with the contents of r, decompressing
+// them as they are read if r begins with the gzip header.
+func scanMaybeGzip(r io.Reader, fn func(entry, comment string) error) error {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) {
+		return scanLines("", br, fn)
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return scanLines("", zr, fn)
+}
+
+// labeledLines returns the entries with one per line, each followed
+// by its label, if it has one, as an inline comment in the format
+// read by scanLines. Runs of whitespace in a label, including
+// newlines, are collapsed to a single space so that the label stays
+// on its entry's line.
+func labeledLines(entries []string, labels map[string]string) []byte {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(entry)
+
+		if label := strings.Join(strings.Fields(labels[entry]), " "); label != "" {
+			buf.WriteString(" # ")
+			buf.WriteString(label)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeGzip writes out to w, compressed with gzip.
+func writeGzip(w io.Writer, out []byte) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(out); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// SaveBasicGzip writes the host whitelist to w in the format of
+// DumpBasic, compressed with gzip, with each label written as an
+// inline comment after its address. It can be read back, labels
+// included, with LoadBasicGzip.
+func SaveBasicGzip(w io.Writer, wl *Basic) error {
+	wl.lock.Lock()
+	addrs := make([]string, 0, len(wl.whitelist))
+	for addr := range wl.whitelist {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	out := labeledLines(addrs, wl.labels)
+	wl.lock.Unlock()
+
+	return writeGzip(w, out)
+}
+
+// LoadBasicGzip reads a host whitelist with one address per line
+// from r, in the format read by LoadBasicDir: comments beginning
+// with '#' are allowed, and an inline comment becomes the address's
+// label. The input may be either plain or compressed with gzip,
+// which is detected from its header, and is read as a stream.
+func LoadBasicGzip(r io.Reader) (*Basic, error) {
+	wl := NewBasic()
+	if err := scanMaybeGzip(r, addHostLine(wl)); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
+
+// SaveBasicNetGzip writes the network whitelist to w in the
+// canonical form of DumpCanonical, compressed with gzip, with each
+// label written as an inline comment after its network. It can be
+// read back, labels included, with LoadBasicNetGzip.
+func SaveBasicNetGzip(w io.Writer, wl *BasicNet) error {
+	nets := canonicalNets(wl)
+	wl.lock.Lock()
+	out := labeledLines(nets, wl.labels)
+	wl.lock.Unlock()
+
+	return writeGzip(w, out)
+}
+
+// LoadBasicNetGzip reads a network whitelist with one network per
+// line from r, in the format read by LoadBasicNetDir: comments
+// beginning with '#' are allowed, and an inline comment becomes the
+// network's label. The input may be either plain or compressed with
+// gzip, which is detected from its header, and is read as a stream.
+func LoadBasicNetGzip(r io.Reader) (*BasicNet, error) {
+	wl := NewBasicNet()
+	if err := scanMaybeGzip(r, addNetLine(wl)); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
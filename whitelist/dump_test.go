@@ -0,0 +1,291 @@
+package whitelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDumpCanonical(t *testing.T) {
+	hosts := NewBasic()
+	if err := hosts.UnmarshalText([]byte("192.168.1.5,10.0.1.15,2001:DB8::1,::ffff:9.9.9.9,9.9.9.9")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "9.9.9.9\n10.0.1.15\n192.168.1.5\n2001:db8::1"
+	if out := string(DumpCanonical(hosts)); out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	nets := NewBasicNet()
+	for _, ns := range []string{"192.168.0.0/16", "2001:db8::/32", "10.0.0.0/8", "10.1.0.0/16", "10.0.0.0/8"} {
+		testAddNet(nets, ns, t)
+	}
+
+	expected = "10.0.0.0/8\n10.1.0.0/16\n192.168.0.0/16\n2001:db8::/32"
+	if out := string(DumpCanonical(nets)); out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	acl, err := NewFromStrings([]string{"10.0.0.0/8", "127.0.0.1", "::1", "10.*"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected = "127.0.0.1\n::1\n10.0.0.0/8"
+	if out := string(DumpCanonical(acl)); out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	if DumpCanonical(NewHostStub()) != nil {
+		t.Fatal("Expected no dump for an unsupported ACL")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	hosts, err := LoadBasicEntries([]string{"192.168.1.5", " 2001:DB8::1", "::ffff:10.0.1.15"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "10.0.1.15,192.168.1.5,2001:db8::1"
+	if out := strings.Join(hosts.Entries(), ","); out != expected {
+		t.Fatalf("Expected %s, but got %s", expected, out)
+	}
+
+	if !checkIPString(hosts, "2001:db8::1", t) || !checkIPString(hosts, "10.0.1.15", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	nets, err := LoadBasicNetEntries([]string{"192.168.1.5/16", "10.0.0.0/8", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected = "10.0.0.0/8,192.168.0.0/16"
+	if out := strings.Join(nets.Entries(), ","); out != expected {
+		t.Fatalf("Expected %s, but got %s", expected, out)
+	}
+
+	if _, err = LoadBasicEntries([]string{"10.0.0.0/8"}); err == nil {
+		t.Fatal("Expected failure loading an invalid address.")
+	}
+
+	if _, err = LoadBasicNetEntries([]string{"10.0.0.1"}); err == nil {
+		t.Fatal("Expected failure loading an invalid network.")
+	}
+}
+
+func TestSaveLoadGzip(t *testing.T) {
+	hosts, err := LoadBasicEntries([]string{"192.168.1.5", "2001:db8::1", "10.0.1.15"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var zipped bytes.Buffer
+	if err = SaveBasicGzip(&zipped, hosts); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.HasPrefix(zipped.Bytes(), gzipMagic) {
+		t.Fatal("Expected gzip output")
+	}
+
+	plain := bytes.NewReader(DumpBasic(hosts))
+	for _, in := range []io.Reader{&zipped, plain} {
+		loaded, err := LoadBasicGzip(in)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if out := strings.Join(loaded.Entries(), ","); out != "10.0.1.15,192.168.1.5,2001:db8::1" {
+			t.Fatalf("Unexpected entries %s", out)
+		}
+	}
+
+	nets, err := LoadBasicNetEntries([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	zipped.Reset()
+	if err = SaveBasicNetGzip(&zipped, nets); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loadedNets, err := LoadBasicNetGzip(&zipped)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if out := strings.Join(loadedNets.Entries(), ","); out != "10.0.0.0/8,2001:db8::/32" {
+		t.Fatalf("Unexpected entries %s", out)
+	}
+
+	zipped.Reset()
+	if err = SaveBasicGzip(&zipped, NewBasic()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = LoadBasicGzip(&zipped); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = LoadBasicGzip(bytes.NewReader([]byte{0x1f, 0x8b, 0})); err == nil {
+		t.Fatal("Expected failure loading a truncated gzip stream.")
+	}
+
+	if _, err = LoadBasicNetGzip(strings.NewReader("10.0.0.1\n")); err == nil {
+		t.Fatal("Expected failure loading an invalid network.")
+	}
+}
+
+func TestSaveLoadGzipLabels(t *testing.T) {
+	hosts := NewBasic()
+	hosts.AddLabeled(net.IP{192, 168, 1, 5}, "printer")
+	hosts.AddLabeled(net.ParseIP("2001:db8::1"), "build\nserver")
+	hosts.Add(net.IP{10, 0, 1, 15})
+
+	var zipped bytes.Buffer
+	if err := SaveBasicGzip(&zipped, hosts); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loaded, err := LoadBasicGzip(&zipped)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := map[string]string{
+		"192.168.1.5": "printer",
+		"2001:db8::1": "build server",
+		"10.0.1.15":   "",
+	}
+	for addr, expected := range tv {
+		if label, _ := loaded.Label(net.ParseIP(addr)); label != expected {
+			t.Fatalf("Expected %s to be labelled %q, but have %q", addr, expected, label)
+		}
+	}
+
+	nets := NewBasicNet()
+	_, n, _ := net.ParseCIDR("10.0.0.0/8")
+	nets.AddLabeled(n, "datacenter # A")
+
+	zipped.Reset()
+	if err = SaveBasicNetGzip(&zipped, nets); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	loadedNets, err := LoadBasicNetGzip(&zipped)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if label, _ := loadedNets.Label(net.IP{10, 1, 2, 3}); label != "datacenter # A" {
+		t.Fatalf("Expected the network's label to be kept, but have %q", label)
+	}
+}
+
+func TestDumpHandlerRoundTrip(t *testing.T) {
+	dump := func(acl ACL) []byte {
+		w := httptest.NewRecorder()
+		NewDumpHandler(acl).ServeHTTP(w, httptest.NewRequest("GET", "/dump", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected HTTP 200, but got HTTP %d", w.Code)
+		}
+		return w.Body.Bytes()
+	}
+
+	wl := NewBasic()
+	for _, addr := range []string{"192.168.1.5", "::1", "10.0.1.15"} {
+		addIPString(wl, addr, t)
+	}
+
+	if out := string(dump(wl)); out != `"10.0.1.15,192.168.1.5,::1"` {
+		t.Fatalf("Unexpected dump %s", out)
+	}
+
+	wl.AddLabeled(net.IP{127, 0, 0, 1}, "loopback")
+	wl2 := new(Basic)
+	if err := json.Unmarshal(dump(wl), wl2); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !Equal(wl, wl2) {
+		t.Fatal("Expected the dump to load back to the same whitelist")
+	}
+
+	if label, _ := wl2.Label(net.IP{127, 0, 0, 1}); label != "loopback" {
+		t.Fatalf("Expected the label to be kept, have %q", label)
+	}
+
+	wlNet := NewBasicNet()
+	testAddNet(wlNet, "192.168.0.0/16", t)
+	testAddNet(wlNet, "10.0.0.0/8", t)
+	if out := string(dump(wlNet)); out != `"10.0.0.0/8,192.168.0.0/16"` {
+		t.Fatalf("Unexpected dump %s", out)
+	}
+
+	wlNet.AddLabeled(&net.IPNet{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)}, "lab")
+	wlNet2 := new(BasicNet)
+	if err := json.Unmarshal(dump(wlNet), wlNet2); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !EqualNet(wlNet, wlNet2) {
+		t.Fatal("Expected the dump to load back to the same whitelist")
+	}
+
+	if label, _ := wlNet2.Label(net.IP{172, 16, 0, 1}); label != "lab" {
+		t.Fatalf("Expected the label to be kept, have %q", label)
+	}
+}
+
+type marshalingACL struct{}
+
+func (marshalingACL) Permitted(net.IP) bool { return false }
+
+func (marshalingACL) MarshalJSON() ([]byte, error) { return []byte(`"custom"`), nil }
+
+func TestDumpHandler(t *testing.T) {
+	acl, err := NewFromStrings([]string{"192.168.1.5", "10.0.0.0/8", "10.0.1.15"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		acl      ACL
+		status   int
+		expected string
+	}{
+		{acl, http.StatusOK, `["10.0.1.15","192.168.1.5","10.0.0.0/8"]`},
+		{NewBasic(), http.StatusOK, `""`},
+		{marshalingACL{}, http.StatusOK, `"custom"`},
+		{NewHostStub(), http.StatusInternalServerError, ""},
+	}
+
+	for _, tc := range tv {
+		w := httptest.NewRecorder()
+		NewDumpHandler(tc.acl).ServeHTTP(w, httptest.NewRequest("GET", "/dump", nil))
+		if w.Code != tc.status {
+			t.Fatalf("Expected HTTP %d, but got HTTP %d", tc.status, w.Code)
+		}
+
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Unexpected content type %s", ct)
+		}
+
+		if body := w.Body.String(); body != tc.expected {
+			t.Fatalf("Expected %s, but got %s", tc.expected, body)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package whitelist
+
+// This file contains a helper for checking an ACL against a list of
+// sample addresses.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// A Result is the outcome of evaluating one line of a sample file.
+type Result struct {
+	// Line is the line number in the sample file, counting from
+	// one.
+	Line int
+
+	// Input is the line's contents, with surrounding whitespace
+	// removed.
+	Input string
+
+	// IP is the parsed address. It is nil if the line couldn't be
+	// parsed.
+	IP net.IP
+
+	// Permitted records whether the ACL permitted the address.
+	Permitted bool
+
+	// Err is set if the line isn't a valid address.
+	Err error
+}
+
+// EvaluateFile runs each address in r through the ACL, for example
+// to check in CI that known-good addresses are still permitted and
+// known-bad ones are still denied after a configuration change. r
+// holds one address per line; blank lines and lines beginning with
+// '#' are skipped. A line that isn't a valid address is reported in
+// its Result rather than stopping the evaluation. An error is
+// returned only if r can't be read.
+func EvaluateFile(acl ACL, r io.Reader) ([]Result, error) {
+	var results []Result
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		res := Result{Line: lineno, Input: line}
+		if res.IP = net.ParseIP(line); res.IP == nil {
+			res.Err = fmt.Errorf("whitelist: line %d: invalid address %q", lineno, line)
+		} else {
+			res.Permitted = acl.Permitted(res.IP)
+		}
+		results = append(results, res)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
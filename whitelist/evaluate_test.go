@@ -0,0 +1,34 @@
+package whitelist
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateFile(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+
+	in := "# known good\n127.0.0.1\n\n# known bad\n192.168.3.1\nnot-an-ip\n"
+	results, err := EvaluateFile(wl, strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, but have %d", len(results))
+	}
+
+	if r := results[0]; r.Line != 2 || r.Input != "127.0.0.1" || !r.Permitted || r.Err != nil {
+		t.Fatalf("Unexpected result %+v", r)
+	}
+
+	if r := results[1]; r.Line != 5 || r.Permitted || r.Err != nil {
+		t.Fatalf("Unexpected result %+v", r)
+	}
+
+	if r := results[2]; r.Line != 6 || r.IP != nil || r.Permitted || r.Err == nil {
+		t.Fatalf("Unexpected result %+v", r)
+	}
+}
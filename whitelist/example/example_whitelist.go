@@ -7,17 +7,50 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/cloudflare/cfssl/whitelist"
 )
 
 var wl = whitelist.NewBasic()
+var netWL = whitelist.NewBasicNet()
+
+// acl permits an address if it is in either the host or the network
+// whitelist.
+var acl = whitelist.FuncACL(func(ip net.IP) bool {
+	return wl.Permitted(ip) || netWL.Permitted(ip)
+})
+
+// parseEntry parses a submitted value as either a network in CIDR
+// notation or a single IP address; exactly one of the return values
+// is non-nil on success.
+func parseEntry(addr string) (net.IP, *net.IPNet, error) {
+	if strings.Contains(addr, "/") {
+		_, n, err := net.ParseCIDR(addr)
+		return nil, n, err
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, nil, fmt.Errorf("invalid address %s", addr)
+	}
+	return ip, nil, nil
+}
 
 func addIP(w http.ResponseWriter, r *http.Request) {
 	addr := r.FormValue("ip")
 
-	ip := net.ParseIP(addr)
-	wl.Add(ip)
+	ip, n, err := parseEntry(addr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if n != nil {
+		netWL.Add(n)
+	} else {
+		wl.Add(ip)
+	}
 	log.Printf("request to add %s to the whitelist", addr)
 	w.Write([]byte(fmt.Sprintf("Added %s to whitelist.\n", addr)))
 }
@@ -25,14 +58,26 @@ func addIP(w http.ResponseWriter, r *http.Request) {
 func delIP(w http.ResponseWriter, r *http.Request) {
 	addr := r.FormValue("ip")
 
-	ip := net.ParseIP(addr)
-	wl.Remove(ip)
+	ip, n, err := parseEntry(addr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if n != nil {
+		netWL.Remove(n)
+	} else {
+		wl.Remove(ip)
+	}
 	log.Printf("request to remove %s from the whitelist", addr)
-	w.Write([]byte(fmt.Sprintf("Removed %s from whitelist.\n", ip)))
+	w.Write([]byte(fmt.Sprintf("Removed %s from whitelist.\n", addr)))
 }
 
 func dumpWhitelist(w http.ResponseWriter, r *http.Request) {
-	out, err := json.Marshal(wl)
+	out, err := json.Marshal(map[string]interface{}{
+		"hosts":    wl,
+		"networks": netWL,
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	} else {
@@ -64,7 +109,7 @@ func main() {
 	adminWL.Add(net.IP{127, 0, 0, 1})
 	adminWL.Add(net.ParseIP("::1"))
 
-	protFiles, err := whitelist.NewHandler(fileServer, nil, wl)
+	protFiles, err := whitelist.NewHandler(fileServer, nil, acl)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
@@ -0,0 +1,112 @@
+package whitelist
+
+// This file contains a host whitelist persisted to a file.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileBackedBasic is a Basic host whitelist persisted to a file, with
+// one address per line in the format written by DumpBasic. Changes
+// made through the embedded Basic are held in memory until Save is
+// called. Comments in a hand-edited file are accepted, and become
+// labels when it is loaded, but labels aren't persisted, so Save
+// drops them.
+type FileBackedBasic struct {
+	*Basic
+
+	path     string
+	saveLock *sync.Mutex
+}
+
+// OpenFileBasic loads the host whitelist stored at path. If the file
+// doesn't exist, it is created with an empty whitelist, so that the
+// returned whitelist is always backed by a file.
+func OpenFileBasic(path string) (*FileBackedBasic, error) {
+	wl := &FileBackedBasic{
+		path:     path,
+		saveLock: new(sync.Mutex),
+	}
+
+	in, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		wl.Basic = NewBasic()
+		if err = wl.Save(); err != nil {
+			return nil, err
+		}
+		return wl, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	in = bytes.TrimSpace(in)
+	if len(in) == 0 {
+		wl.Basic = NewBasic()
+		return wl, nil
+	}
+
+	if wl.Basic, err = LoadBasic(in); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
+
+// Path returns the path of the file backing the whitelist.
+func (wl *FileBackedBasic) Path() string {
+	return wl.path
+}
+
+// fileMode returns the permissions of the file at path, so that a
+// replacement can keep them, or 0644 if it doesn't exist yet.
+func fileMode(path string) os.FileMode {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0644
+	}
+	return fi.Mode().Perm()
+}
+
+// Save writes the whitelist to its file. The whitelist is written to
+// a temporary file in the same directory, which then replaces the
+// original, so that the file always holds either the old or the new
+// whitelist, even if the process dies partway through. The file
+// keeps its permissions, and is created with mode 0644 if it doesn't
+// exist. Concurrent calls to Save are serialised.
+func (wl *FileBackedBasic) Save() error {
+	wl.saveLock.Lock()
+	defer wl.saveLock.Unlock()
+
+	out := DumpBasic(wl.Basic)
+	if len(out) > 0 {
+		out = append(out, '\n')
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(wl.path), "."+filepath.Base(wl.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// Once the rename has succeeded, this fails harmlessly.
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(out); err == nil {
+		err = tmp.Sync()
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fileMode(wl.path))
+	}
+
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), wl.path)
+}
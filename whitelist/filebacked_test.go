@@ -0,0 +1,105 @@
+package whitelist
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileBackedBasic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts")
+	wl, err := OpenFileBasic(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = os.Stat(path); err != nil {
+		t.Fatalf("Expected the file to be created: %v", err)
+	}
+
+	addIPString(wl, "127.0.0.1", t)
+	addIPString(wl, "2001:db8::1", t)
+	if err = wl.Save(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	reopened, err := OpenFileBasic(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !Equal(wl.Basic, reopened.Basic) {
+		t.Fatal("Expected the reopened whitelist to match the saved one")
+	}
+
+	// Concurrent saves leave a complete whitelist and no temporary
+	// files behind.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			wl.Add(net.IP{10, 0, 0, byte(i)})
+			if err := wl.Save(); err != nil {
+				t.Errorf("%v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if reopened, err = OpenFileBasic(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !Equal(wl.Basic, reopened.Basic) || len(reopened.whitelist) != 10 {
+		t.Fatalf("Expected 10 saved hosts, but have %d", len(reopened.whitelist))
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Expected only the whitelist file, but have %d files", len(files))
+	}
+
+	if mode := files[0].Mode().Perm(); mode != 0644 {
+		t.Fatalf("Expected a new file to have mode 0644, have %v", mode)
+	}
+
+	// A file kept private stays private when saved.
+	if err = os.Chmod(path, 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = wl.Save(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Fatalf("Expected the file to keep mode 0600, have %v", mode)
+	}
+
+	if err = ioutil.WriteFile(path, []byte("not an address\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = OpenFileBasic(path); err == nil {
+		t.Fatal("Expected an invalid whitelist file to be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package whitelist
+
+// This file contains an exporter of whitelists as firewall rules.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// FirewallOptions control the rules generated by IPTablesRules.
+type FirewallOptions struct {
+	// Table is the table the rules are added to. It defaults to
+	// "filter".
+	Table string
+
+	// Chain is the chain the rules are appended to. It defaults
+	// to "INPUT".
+	Chain string
+
+	// Protocol is the protocol matched by the rules when Port is
+	// set. It defaults to "tcp".
+	Protocol string
+
+	// Port, if positive, restricts the rules to traffic to that
+	// destination port.
+	Port int
+}
+
+// aclNetworks returns the networks covering the addresses permitted
+// by a Basic, BasicNet, or an ACL built by NewFromStrings. Hosts are
+// converted to single-host networks. It returns false for other
+// ACLs.
+func aclNetworks(acl ACL) ([]*net.IPNet, bool) {
+	hostNets := func(wl *Basic) []*net.IPNet {
+		var nets []*net.IPNet
+		for _, ip := range hostSet(wl) {
+			nets = append(nets, hostNet(ip))
+		}
+		return nets
+	}
+
+	switch wl := acl.(type) {
+	case *Basic:
+		return hostNets(wl), true
+	case *BasicNet:
+		return snapshotNets(wl), true
+	case hostsAndNets:
+		return append(hostNets(wl.hosts), snapshotNets(wl.nets)...), true
+	default:
+		return nil, false
+	}
+}
+
+// validRuleName returns true if name can be used as a table, chain,
+// or protocol name without changing the meaning of a rule.
+func validRuleName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n\"'")
+}
+
+// writeIPTablesRules writes an iptables-restore document that
+// accepts traffic from each network.
+func writeIPTablesRules(buf *bytes.Buffer, nets []*net.IPNet, opts FirewallOptions) {
+	fmt.Fprintf(buf, "*%s\n", opts.Table)
+	for _, n := range nets {
+		fmt.Fprintf(buf, "-A %s -s %s", opts.Chain, n)
+		if opts.Port > 0 {
+			fmt.Fprintf(buf, " -p %s --dport %d", opts.Protocol, opts.Port)
+		}
+		buf.WriteString(" -j ACCEPT\n")
+	}
+	buf.WriteString("COMMIT\n")
+}
+
+// IPTablesRules renders a whitelist as firewall rules accepting
+// traffic from the whitelisted addresses, for keeping a host
+// firewall in sync with the whitelist. The networks are aggregated
+// first, so that the minimum number of rules is generated.
+//
+// The rules are returned as two documents in the format read by
+// iptables-restore: v4 for iptables-restore, and v6 for
+// ip6tables-restore. The rules are appended to the chain, so the
+// documents should normally be loaded with --noflush.
+//
+// Only Basic, BasicNet, and ACLs built by NewFromStrings are
+// supported.
+func IPTablesRules(acl ACL, opts FirewallOptions) (v4, v6 []byte, err error) {
+	if opts.Table == "" {
+		opts.Table = "filter"
+	}
+
+	if opts.Chain == "" {
+		opts.Chain = "INPUT"
+	}
+
+	if opts.Protocol == "" {
+		opts.Protocol = "tcp"
+	}
+
+	for _, name := range []string{opts.Table, opts.Chain, opts.Protocol} {
+		if !validRuleName(name) {
+			return nil, nil, fmt.Errorf("whitelist: invalid firewall name %q", name)
+		}
+	}
+
+	if opts.Port > 65535 {
+		return nil, nil, fmt.Errorf("whitelist: invalid port %d", opts.Port)
+	}
+
+	nets, ok := aclNetworks(acl)
+	if !ok {
+		return nil, nil, errors.New("whitelist: unsupported ACL for firewall rules")
+	}
+
+	var nets4, nets6 []*net.IPNet
+	for _, n := range aggregateNetworks(nets) {
+		if len(n.IP) == net.IPv4len {
+			nets4 = append(nets4, n)
+		} else {
+			nets6 = append(nets6, n)
+		}
+	}
+
+	var buf4, buf6 bytes.Buffer
+	writeIPTablesRules(&buf4, nets4, opts)
+	writeIPTablesRules(&buf6, nets6, opts)
+	return buf4.Bytes(), buf6.Bytes(), nil
+}
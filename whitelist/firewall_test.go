@@ -0,0 +1,58 @@
+package whitelist
+
+import "testing"
+
+func TestIPTablesRules(t *testing.T) {
+	acl, err := NewFromStrings([]string{
+		"10.0.0.0/25", "10.0.0.128/25", "192.168.3.1", "2001:db8::1", "2001:db8::/32",
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	v4, v6, err := IPTablesRules(acl, FirewallOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "*filter\n" +
+		"-A INPUT -s 10.0.0.0/24 -j ACCEPT\n" +
+		"-A INPUT -s 192.168.3.1/32 -j ACCEPT\n" +
+		"COMMIT\n"
+	if string(v4) != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, v4)
+	}
+
+	expected = "*filter\n" +
+		"-A INPUT -s 2001:db8::/32 -j ACCEPT\n" +
+		"COMMIT\n"
+	if string(v6) != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, v6)
+	}
+
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+	v4, _, err = IPTablesRules(wl, FirewallOptions{Table: "mangle", Chain: "APP", Port: 443})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected = "*mangle\n" +
+		"-A APP -s 127.0.0.1/32 -p tcp --dport 443 -j ACCEPT\n" +
+		"COMMIT\n"
+	if string(v4) != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, v4)
+	}
+
+	if _, _, err = IPTablesRules(wl, FirewallOptions{Chain: "INPUT -j DROP"}); err == nil {
+		t.Fatal("Expected an invalid chain name to be rejected")
+	}
+
+	if _, _, err = IPTablesRules(wl, FirewallOptions{Port: 65536}); err == nil {
+		t.Fatal("Expected an invalid port to be rejected")
+	}
+
+	if _, _, err = IPTablesRules(NewHostStub(), FirewallOptions{}); err == nil {
+		t.Fatal("Expected an unsupported ACL to be rejected")
+	}
+}
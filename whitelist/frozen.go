@@ -0,0 +1,62 @@
+package whitelist
+
+// This file contains immutable snapshots of whitelists.
+
+import "net"
+
+type frozenHosts map[string]bool
+
+func (wl frozenHosts) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+	return wl[hostKey(ip)]
+}
+
+type frozenNets []*net.IPNet
+
+func (wl frozenNets) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	for i := range wl {
+		if wl[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Frozen returns an immutable snapshot of a Basic or BasicNet
+// whitelist. The snapshot doesn't take any locks in Permitted, which
+// makes it suitable for read-heavy workloads where the whitelist
+// doesn't change after it's loaded. Later changes to the original
+// whitelist are not reflected in the snapshot, and the snapshot has
+// no methods to change it. Other ACLs are returned unchanged.
+func Frozen(acl ACL) ACL {
+	switch wl := acl.(type) {
+	case *Basic:
+		wl.lock.Lock()
+		defer wl.lock.Unlock()
+
+		hosts := make(frozenHosts, len(wl.whitelist))
+		for addr, ok := range wl.whitelist {
+			hosts[addr] = ok
+		}
+		return hosts
+	case *BasicNet:
+		wl.lock.Lock()
+		defer wl.lock.Unlock()
+
+		nets := make(frozenNets, 0, len(wl.whitelist))
+		for _, n := range wl.whitelist {
+			if n != nil {
+				nets = append(nets, n)
+			}
+		}
+		return nets
+	default:
+		return acl
+	}
+}
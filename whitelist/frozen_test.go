@@ -0,0 +1,47 @@
+package whitelist
+
+import "testing"
+
+func TestFrozen(t *testing.T) {
+	hosts := NewBasic()
+	addIPString(hosts, "127.0.0.1", t)
+
+	nets := NewBasicNet()
+	testAddNet(nets, "192.168.3.0/24", t)
+
+	frozenHosts := Frozen(hosts)
+	frozenNets := Frozen(nets)
+
+	addIPString(hosts, "127.0.0.2", t)
+	testAddNet(nets, "10.0.0.0/8", t)
+
+	if !checkIPString(frozenHosts, "127.0.0.1", t) || !checkIPString(frozenNets, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if checkIPString(frozenHosts, "127.0.0.2", t) || checkIPString(frozenNets, "10.0.0.1", t) {
+		t.Fatal("snapshot should not reflect later changes")
+	}
+
+	if frozenHosts.Permitted(nil) || frozenNets.Permitted(nil) {
+		t.Fatal("whitelist should have denied an invalid address")
+	}
+
+	stub := NewHostStub()
+	if Frozen(stub) != stub {
+		t.Fatal("Expected other ACLs to be returned unchanged")
+	}
+}
+
+func BenchmarkFrozenNet(b *testing.B) {
+	wl := NewBasicNet()
+	wl.UnmarshalText([]byte("10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"))
+	acl := Frozen(wl)
+	ip := []byte{192, 168, 3, 1}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			acl.Permitted(ip)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package whitelist
+
+import (
+	"sort"
+	"testing"
+)
+
+var unmarshalSeeds = []string{
+	``,
+	` `,
+	`"`,
+	`{`,
+	`null`,
+	`""`,
+	`"  ,  "`,
+	`{}`,
+	`"127.0.0.1,::1"`,
+	`"10.0.0.0/8, 2001:db8::/32"`,
+	`{"127.0.0.1":"loopback","::1":""}`,
+	`{"10.0.0.0/8":"internal"}`,
+	`[1,2,3]`,
+}
+
+// uniqueSorted returns the distinct strings in ss, sorted.
+func uniqueSorted(ss []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FuzzBasicUnmarshalJSON checks that UnmarshalJSON never panics, and
+// that anything it accepts survives a round trip through MarshalJSON.
+func FuzzBasicUnmarshalJSON(f *testing.F) {
+	for _, seed := range unmarshalSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var wl Basic
+		if err := wl.UnmarshalJSON(in); err != nil {
+			return
+		}
+
+		out, err := wl.MarshalJSON()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		var wl2 Basic
+		if err = wl2.UnmarshalJSON(out); err != nil {
+			t.Fatalf("failed to reload %q: %v", out, err)
+		}
+
+		if !equalStrings(uniqueSorted(wl.Entries()), uniqueSorted(wl2.Entries())) {
+			t.Fatalf("round trip of %q changed the whitelist", in)
+		}
+	})
+}
+
+// FuzzBasicNetUnmarshalJSON is FuzzBasicUnmarshalJSON for network
+// whitelists.
+func FuzzBasicNetUnmarshalJSON(f *testing.F) {
+	for _, seed := range unmarshalSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var wl BasicNet
+		if err := wl.UnmarshalJSON(in); err != nil {
+			return
+		}
+
+		out, err := wl.MarshalJSON()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		var wl2 BasicNet
+		if err = wl2.UnmarshalJSON(out); err != nil {
+			t.Fatalf("failed to reload %q: %v", out, err)
+		}
+
+		if !equalStrings(uniqueSorted(wl.Entries()), uniqueSorted(wl2.Entries())) {
+			t.Fatalf("round trip of %q changed the whitelist", in)
+		}
+	})
+}
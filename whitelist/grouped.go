@@ -0,0 +1,182 @@
+package whitelist
+
+// This file contains a host whitelist whose entries belong to named
+// groups.
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+)
+
+// GroupedACL is a host whitelist whose entries are tagged with a
+// group, such as the team that requested them, so that a group's
+// entries can be revoked at once. An address is permitted if it is
+// in any group, and an address may be in several groups. Entries are
+// compared in the same way as in a Basic whitelist.
+//
+// A GroupedACL is serialised to JSON as an object mapping each group
+// to a sorted list of its entries.
+type GroupedACL struct {
+	lock   *sync.Mutex
+	groups map[string]map[string]bool
+
+	// count holds the number of groups each address is in, so
+	// that Permitted needn't check every group.
+	count map[string]int
+}
+
+// NewGroupedACL returns a new initialised GroupedACL.
+func NewGroupedACL() *GroupedACL {
+	return &GroupedACL{
+		lock:   new(sync.Mutex),
+		groups: map[string]map[string]bool{},
+		count:  map[string]int{},
+	}
+}
+
+// Permitted returns true if the IP is whitelisted in any group.
+func (wl *GroupedACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	wl.lock.Lock()
+	permitted := wl.count[hostKey(ip)] > 0
+	wl.lock.Unlock()
+	return permitted
+}
+
+// Add whitelists the IP as part of the group.
+func (wl *GroupedACL) Add(group string, ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.add(group, hostKey(ip))
+}
+
+// add adds the address to the group. The caller must hold the lock.
+func (wl *GroupedACL) add(group, addr string) {
+	entries := wl.groups[group]
+	if entries == nil {
+		entries = map[string]bool{}
+		wl.groups[group] = entries
+	}
+
+	if !entries[addr] {
+		entries[addr] = true
+		wl.count[addr]++
+	}
+}
+
+// Remove drops the IP from the group. It stays whitelisted if it is
+// in any other group.
+func (wl *GroupedACL) Remove(group string, ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	addr := hostKey(ip)
+	entries := wl.groups[group]
+	if !entries[addr] {
+		return
+	}
+
+	delete(entries, addr)
+	wl.uncount(addr)
+	if len(entries) == 0 {
+		delete(wl.groups, group)
+	}
+}
+
+// RemoveGroup drops every entry in the group. Entries that are also
+// in other groups stay whitelisted.
+func (wl *GroupedACL) RemoveGroup(group string) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	for addr := range wl.groups[group] {
+		wl.uncount(addr)
+	}
+	delete(wl.groups, group)
+}
+
+// uncount records that the address has been removed from a group.
+// The caller must hold the lock.
+func (wl *GroupedACL) uncount(addr string) {
+	if wl.count[addr]--; wl.count[addr] <= 0 {
+		delete(wl.count, addr)
+	}
+}
+
+// Groups returns the names of the groups with at least one entry, in
+// sorted order.
+func (wl *GroupedACL) Groups() []string {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	groups := make([]string, 0, len(wl.groups))
+	for group := range wl.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// MarshalJSON serialises the whitelist as an object mapping each
+// group to a sorted list of its entries, implementing the
+// json.Marshaler interface.
+func (wl *GroupedACL) MarshalJSON() ([]byte, error) {
+	wl.lock.Lock()
+	groups := make(map[string][]string, len(wl.groups))
+	for group, entries := range wl.groups {
+		addrs := make([]string, 0, len(entries))
+		for addr := range entries {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		groups[group] = addrs
+	}
+	wl.lock.Unlock()
+
+	return json.Marshal(groups)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, taking an
+// object mapping each group to a list of its entries. It replaces
+// the current contents of the whitelist; if any entry is invalid,
+// the whitelist is left unchanged.
+func (wl *GroupedACL) UnmarshalJSON(in []byte) error {
+	var groups map[string][]string
+	if err := json.Unmarshal(in, &groups); err != nil {
+		return err
+	}
+
+	parsed := &GroupedACL{
+		groups: map[string]map[string]bool{},
+		count:  map[string]int{},
+	}
+	for group, addrs := range groups {
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return errors.New("whitelist: invalid IP address " + addr)
+			}
+			parsed.add(group, hostKey(ip))
+		}
+	}
+
+	initLock(&wl.lock)
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.groups, wl.count = parsed.groups, parsed.count
+	return nil
+}
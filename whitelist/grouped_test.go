@@ -0,0 +1,83 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestGroupedACL(t *testing.T) {
+	wl := NewGroupedACL()
+	wl.Add("ops", net.IP{192, 168, 3, 1})
+	wl.Add("ops", net.ParseIP("2001:DB8::1"))
+	wl.Add("dev", net.IP{192, 168, 3, 1})
+	wl.Add("dev", net.IP{10, 0, 0, 1})
+	wl.Add("dev", nil)
+
+	if groups := wl.Groups(); !reflect.DeepEqual(groups, []string{"dev", "ops"}) {
+		t.Fatalf("Unexpected groups %v", groups)
+	}
+
+	for _, addr := range []string{"192.168.3.1", "2001:db8::1", "10.0.0.1"} {
+		if !wl.Permitted(net.ParseIP(addr)) {
+			t.Fatalf("Expected %s to be permitted", addr)
+		}
+	}
+
+	out, err := json.Marshal(wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := `{"dev":["10.0.0.1","192.168.3.1"],"ops":["192.168.3.1","2001:db8::1"]}`
+	if string(out) != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	// 192.168.3.1 is still in ops once dev is revoked.
+	wl.RemoveGroup("dev")
+	if !wl.Permitted(net.IP{192, 168, 3, 1}) || wl.Permitted(net.IP{10, 0, 0, 1}) {
+		t.Fatal("Expected only the dev group's own entries to be revoked")
+	}
+
+	wl.Remove("ops", net.IP{192, 168, 3, 1})
+	wl.Remove("missing", net.ParseIP("2001:db8::1"))
+	if wl.Permitted(net.IP{192, 168, 3, 1}) || !wl.Permitted(net.ParseIP("2001:db8::1")) {
+		t.Fatal("Expected only 192.168.3.1 to be removed")
+	}
+
+	wl.Remove("ops", net.ParseIP("2001:db8::1"))
+	if groups := wl.Groups(); len(groups) != 0 {
+		t.Fatalf("Expected no groups, but have %v", groups)
+	}
+
+	var wl2 GroupedACL
+	if err = json.Unmarshal(out, &wl2); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl2.RemoveGroup("ops")
+	if !wl2.Permitted(net.IP{192, 168, 3, 1}) || wl2.Permitted(net.ParseIP("2001:db8::1")) {
+		t.Fatal("Unexpected whitelist after unmarshaling")
+	}
+
+	if err = json.Unmarshal([]byte(`{"ops":["not an address"]}`), &wl2); err == nil {
+		t.Fatal("Expected an invalid address to be rejected")
+	}
+
+	// A failed unmarshal leaves the whitelist usable and unchanged.
+	if !wl2.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected the whitelist to be unchanged")
+	}
+
+	wl2.Add("ops", net.IP{10, 0, 0, 1})
+	if !wl2.Permitted(net.IP{10, 0, 0, 1}) {
+		t.Fatal("Expected the address to be added")
+	}
+
+	var wl3 GroupedACL
+	if err = json.Unmarshal([]byte(`{"ops":["not an address"]}`), &wl3); err == nil {
+		t.Fatal("Expected an invalid address to be rejected")
+	}
+}
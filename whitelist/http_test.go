@@ -1,12 +1,15 @@
 package whitelist
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type testHandler struct {
@@ -410,8 +413,394 @@ func TestHandlerFunc(t *testing.T) {
 	}
 
 	acl = NewBasic()
-	_, err = NewHandler(nil, testDenyHandler, acl)
+	h, err := NewHandler(nil, testDenyHandler, acl)
 	if err == nil || err.Error() != "whitelist: allow cannot be nil" {
 		t.Fatal("Expected error with nil ACL.")
 	}
+
+	if h != nil {
+		t.Fatal("Expected a nil handler on error.")
+	}
+}
+
+func TestNewHandlerWithOptions(t *testing.T) {
+	wl := NewBasic()
+	h, err := NewHandlerWithOptions(testAllowHandler, nil, wl, HandlerOptions{RetryAfter: time.Second})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.3.1:4141"
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Expected the options to be applied, have headers %v", w.Header())
+	}
+
+	if _, err = NewHandlerWithOptions(testAllowHandler, nil, nil, HandlerOptions{}); err == nil {
+		t.Fatal("Expected error with nil ACL.")
+	}
+}
+
+func TestRedirectDeny(t *testing.T) {
+	if _, err := NewRedirect("", ""); err == nil {
+		t.Fatal("Expected failure with an empty redirect target.")
+	}
+
+	if _, err := NewRedirect("http://[::1", ""); err == nil {
+		t.Fatal("Expected failure with an invalid redirect target.")
+	}
+
+	rd, err := NewRedirect("https://example.com/challenge?src=wl", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl := NewBasic()
+	h, err := NewHandler(testAllowHandler, rd, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/files/a.txt?v=1", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expect HTTP 302, but got HTTP %d", w.Code)
+	}
+
+	expected := "https://example.com/challenge?next=%2Ffiles%2Fa.txt%3Fv%3D1&src=wl"
+	if loc := w.Header().Get("Location"); loc != expected {
+		t.Fatalf("Expected redirect to %s, but got %s", expected, loc)
+	}
+
+	addIPString(wl, "127.0.0.1", t)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got HTTP %d", w.Code)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	allow := func(w http.ResponseWriter, r *http.Request) {
+		if Untrusted(r) {
+			w.Write([]byte("UNTRUSTED"))
+		} else {
+			w.Write([]byte("OK"))
+		}
+	}
+
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	h, err := NewHandlerFunc(allow, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.DryRun = true
+
+	tv := map[string]string{
+		"127.0.0.1:4141":   "OK",
+		"192.168.3.1:4141": "UNTRUSTED",
+	}
+
+	for addr, expected := range tv {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		h.ServeHTTP(w, req)
+		if w.Body.String() != expected {
+			t.Fatalf("Expected %s, but got %s", expected, w.Body.String())
+		}
+	}
+
+	h.DryRun = false
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.3.1:4141"
+	h.ServeHTTP(w, req)
+	if w.Body.String() != "NO" {
+		t.Fatalf("Expected NO, but got %s", w.Body.String())
+	}
+}
+
+func TestEnforcePercent(t *testing.T) {
+	allow := func(w http.ResponseWriter, r *http.Request) {
+		if Untrusted(r) {
+			w.Write([]byte("UNTRUSTED"))
+		} else {
+			w.Write([]byte("OK"))
+		}
+	}
+
+	h, err := NewHandlerFunc(allow, testDenyHandlerFunc, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	serve := func(addr string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr + ":4141"
+		h.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	denied := func(percent int) map[string]bool {
+		h.EnforcePercent = percent
+		out := map[string]bool{}
+		for i := 0; i < 200; i++ {
+			addr := fmt.Sprintf("10.0.%d.%d", i/100, i%100)
+			switch serve(addr) {
+			case "NO":
+				out[addr] = true
+			case "UNTRUSTED":
+			default:
+				t.Fatalf("Unexpected response for %s", addr)
+			}
+		}
+		return out
+	}
+
+	if n := len(denied(0)); n != 200 {
+		t.Fatalf("Expected every address to be denied, have %d", n)
+	}
+
+	if n := len(denied(100)); n != 200 {
+		t.Fatalf("Expected every address to be denied, have %d", n)
+	}
+
+	low, high := denied(10), denied(50)
+	if len(low) == 0 || len(low) >= len(high) || len(high) == 200 {
+		t.Fatalf("Expected a partial rollout, have %d and %d denied", len(low), len(high))
+	}
+
+	// Raising the percentage only adds addresses.
+	for addr := range low {
+		if !high[addr] {
+			t.Fatalf("Expected %s to stay enforced", addr)
+		}
+	}
+
+	if again := denied(10); len(again) != len(low) {
+		t.Fatalf("Expected a stable rollout, have %d and %d denied", len(low), len(again))
+	}
+
+	if rolloutBucket(net.IP{10, 0, 0, 1}) != rolloutBucket(net.ParseIP("::ffff:10.0.0.1")) {
+		t.Fatal("Expected both forms of an IPv4 address to hash the same")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	wl := NewBasic()
+	h, err := NewHandlerWithOptions(testAllowHandler, nil, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.RetryAfter = 1500 * time.Millisecond
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.3.1:4141"
+
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expect HTTP 401, but got HTTP %d", w.Code)
+	}
+
+	if ra := w.Header().Get("Retry-After"); ra != "2" {
+		t.Fatalf("Expected Retry-After of 2, but have %q", ra)
+	}
+
+	hf, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hf.RetryAfter = time.Minute
+
+	w = httptest.NewRecorder()
+	if hf.ServeHTTP(w, req); w.Header().Get("Retry-After") != "" {
+		t.Fatal("Retry-After should not be set with a custom deny handler")
+	}
+}
+
+func TestFailOpenHTTP(t *testing.T) {
+	wl := NewBasic()
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.FailOpen = true
+
+	w := httptest.NewRecorder()
+	req := new(http.Request)
+	if h.ServeHTTP(w, req); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got HTTP %d", w.Code)
+	}
+
+	hf, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	hf.FailOpen = true
+
+	w = httptest.NewRecorder()
+	if hf.ServeHTTP(w, req); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got HTTP %d", w.Code)
+	}
+
+	// A host that isn't an address is a lookup failure too.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "garbage:80"
+	w = httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got HTTP %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	if hf.ServeHTTP(w, req); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got HTTP %d", w.Code)
+	}
+
+	h.FailOpen = false
+	w = httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected HTTP 500, but got HTTP %d", w.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	if _, err := NewMiddleware(nil, nil); err == nil {
+		t.Fatal("Expected error with nil ACL.")
+	}
+
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+	mw, err := NewMiddleware(nil, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	mw.RetryAfter = time.Second
+	h := mw.Wrap(testAllowHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Body.String() != "OK" {
+		t.Fatalf("Expected OK, but got %s", w.Body.String())
+	}
+
+	req.RemoteAddr = "192.168.3.1:4141"
+	w = httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expect HTTP 401, but got HTTP %d", w.Code)
+	}
+
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatal("Expected the middleware's options to be used")
+	}
+
+	mw, err = NewMiddleware(testDenyHandler, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w = httptest.NewRecorder()
+	if mw.Wrap(testAllowHandler).ServeHTTP(w, req); w.Body.String() != "NO" {
+		t.Fatalf("Expected NO, but got %s", w.Body.String())
+	}
+}
+
+func TestMethodsHTTP(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	hf, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := []struct {
+		method, addr, expected string
+	}{
+		{"GET", "192.168.3.1", "OK"},
+		{"HEAD", "192.168.3.1", "OK"},
+		{"POST", "192.168.3.1", "NO"},
+		{"DELETE", "192.168.3.1", "NO"},
+		{"POST", "127.0.0.1", "OK"},
+	}
+
+	for _, handler := range []http.Handler{h, hf} {
+		// By default, every method is checked.
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.3.1:4141"
+		w := httptest.NewRecorder()
+		if handler.ServeHTTP(w, req); w.Body.String() != "NO" {
+			t.Fatalf("Expected NO, but got %s", w.Body.String())
+		}
+	}
+
+	h.Methods = []string{"POST", "PUT", "DELETE"}
+	hf.Methods = h.Methods
+	for _, handler := range []http.Handler{h, hf} {
+		for _, tc := range tv {
+			req := httptest.NewRequest(tc.method, "/", nil)
+			req.RemoteAddr = tc.addr + ":4141"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Body.String() != tc.expected {
+				t.Fatalf("Expected %s for %s from %s, but got %s", tc.expected, tc.method, tc.addr, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestAllowLoopbackHTTP(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{192, 168, 3, 1})
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	hf, err := NewHandlerFunc(testAllowHandlerFunc, testDenyHandlerFunc, wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := map[string]string{
+		"127.0.0.1":   "OK",
+		"127.1.2.3":   "OK",
+		"[::1]":       "OK",
+		"192.168.3.1": "OK",
+		"192.168.3.2": "NO",
+	}
+
+	for _, handler := range []http.Handler{h, hf} {
+		// By default, loopback addresses must be whitelisted.
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "127.0.0.1:4141"
+		w := httptest.NewRecorder()
+		if handler.ServeHTTP(w, req); w.Body.String() != "NO" {
+			t.Fatalf("Expected NO, but got %s", w.Body.String())
+		}
+	}
+
+	h.AllowLoopback = true
+	hf.AllowLoopback = true
+	for _, handler := range []http.Handler{h, hf} {
+		for addr, expected := range tv {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = addr + ":4141"
+			w := httptest.NewRecorder()
+			if handler.ServeHTTP(w, req); w.Body.String() != expected {
+				t.Fatalf("Expected %s for %s, but got %s", expected, addr, w.Body.String())
+			}
+		}
+	}
 }
@@ -0,0 +1,67 @@
+package whitelist
+
+// This file contains an ACL backed by a kernel ipset.
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os/exec"
+	"time"
+)
+
+// ipsetTimeout bounds each invocation of the ipset tool.
+const ipsetTimeout = time.Second
+
+// IPSet is an ACL that checks membership of a named kernel ipset by
+// running the ipset tool. It is intended as a defence-in-depth check
+// alongside an application whitelist, confirming that an address is
+// also permitted by the kernel's configuration. Each check runs the
+// tool, so it is considerably slower than the in-memory ACLs. IPSet
+// is only supported on Linux.
+type IPSet struct {
+	name string
+	tool string
+}
+
+// NewIPSet returns an ACL checking membership of the named ipset. An
+// error is returned if the ipset tool can't be found or the set
+// doesn't exist.
+func NewIPSet(name string) (*IPSet, error) {
+	tool, err := exec.LookPath("ipset")
+	if err != nil {
+		return nil, errors.New("whitelist: ipset tool not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipsetTimeout)
+	defer cancel()
+
+	if err = exec.CommandContext(ctx, tool, "-n", "list", name).Run(); err != nil {
+		return nil, errors.New("whitelist: ipset " + name + " is not available: " + err.Error())
+	}
+
+	return &IPSet{name: name, tool: tool}, nil
+}
+
+// Permitted returns true if the IP is a member of the ipset. If the
+// tool fails, the failure is logged and the IP is not permitted.
+func (wl *IPSet) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipsetTimeout)
+	defer cancel()
+
+	err := exec.CommandContext(ctx, wl.tool, "-q", "test", wl.name, ip.String()).Run()
+	if err == nil {
+		return true
+	}
+
+	// The tool exits with status 1 if the address isn't a member.
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		log.Printf("whitelist: failed to check ipset %s for %s: %v", wl.name, logIP(ip), err)
+	}
+	return false
+}
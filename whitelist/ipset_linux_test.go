@@ -0,0 +1,70 @@
+package whitelist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFakeIPSet installs a fake ipset tool at the front of the PATH
+// that knows about a single set, "allowed", containing 127.0.0.1.
+func testFakeIPSet(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	script := `#!/bin/sh
+case "$*" in
+"-n list allowed") echo allowed; exit 0 ;;
+"-q test allowed 127.0.0.1") exit 0 ;;
+"-q test allowed "*) exit 1 ;;
+*) exit 2 ;;
+esac
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "ipset"), []byte(script), 0755)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIPSet(t *testing.T) {
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	_, err := NewIPSet("allowed")
+	os.Setenv("PATH", path)
+	if err == nil {
+		t.Fatal("Expected failure without the ipset tool.")
+	}
+
+	defer testFakeIPSet(t)()
+
+	if _, err = NewIPSet("missing"); err == nil {
+		t.Fatal("Expected failure with a missing ipset.")
+	}
+
+	wl, err := NewIPSet("allowed")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(wl, "127.0.0.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	if wl.Permitted(nil) {
+		t.Fatal("whitelist should have denied an invalid address")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package whitelist
+
+import (
+	"errors"
+	"net"
+)
+
+// IPSet is an ACL that checks membership of a named kernel ipset. It
+// is only supported on Linux; on other platforms, NewIPSet always
+// returns an error.
+type IPSet struct{}
+
+// NewIPSet returns an error, as ipsets are only supported on Linux.
+func NewIPSet(name string) (*IPSet, error) {
+	return nil, errors.New("whitelist: ipset is only supported on Linux")
+}
+
+// Permitted always returns false.
+func (wl *IPSet) Permitted(ip net.IP) bool {
+	return false
+}
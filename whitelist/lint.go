@@ -0,0 +1,88 @@
+package whitelist
+
+// This file contains checks for redundant whitelist entries.
+
+import (
+	"fmt"
+	"net"
+)
+
+// snapshotNets returns the canonical form of each valid network in
+// the whitelist, sorted.
+func snapshotNets(wl *BasicNet) []*net.IPNet {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	nets := make([]*net.IPNet, 0, len(wl.whitelist))
+	for _, n := range wl.whitelist {
+		if n = canonicalNet(n); n != nil {
+			nets = append(nets, n)
+		}
+	}
+
+	sortNets(nets)
+	return nets
+}
+
+// LintNet returns a human-readable finding for each redundant entry
+// in a network whitelist: networks listed more than once, and
+// networks that are covered by a broader entry. The whitelist is not
+// modified.
+func LintNet(wl *BasicNet) []string {
+	var findings []string
+	nets := snapshotNets(wl)
+	for i, n := range nets {
+		if i > 0 && n.String() == nets[i-1].String() {
+			if i == 1 || n.String() != nets[i-2].String() {
+				findings = append(findings, fmt.Sprintf("%s is listed more than once", n))
+			}
+			continue
+		}
+
+		nr, _ := networkRange(n)
+		for _, cover := range nets {
+			cr, _ := networkRange(cover)
+			if cover.String() != n.String() && cr.contains(nr) {
+				findings = append(findings, fmt.Sprintf("%s is redundant; covered by %s", n, cover))
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+// Lint returns a human-readable finding for each redundant entry in
+// a pair of host and network whitelists used together: the findings
+// of LintNet, followed by hosts that are covered by a network. Either
+// whitelist may be nil. Neither whitelist is modified.
+func Lint(hosts *Basic, nets *BasicNet) []string {
+	var findings []string
+	var netList []*net.IPNet
+	if nets != nil {
+		findings = LintNet(nets)
+		netList = snapshotNets(nets)
+	}
+
+	if hosts == nil {
+		return findings
+	}
+
+	hostSet := hostSet(hosts)
+	hostList := make([]net.IP, 0, len(hostSet))
+	for _, ip := range hostSet {
+		hostList = append(hostList, ip)
+	}
+	sortIPs(hostList)
+
+	for _, ip := range hostList {
+		for _, n := range netList {
+			if n.Contains(ip) {
+				findings = append(findings, fmt.Sprintf("%s is redundant; covered by %s", ip, n))
+				break
+			}
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,43 @@
+package whitelist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	nets := NewBasicNet()
+	for _, ns := range []string{"10.1.0.0/16", "10.0.0.0/8", "192.168.3.0/24", "10.0.0.0/8", "10.0.0.0/8", "10.1.2.0/24", "2001:db8::/32"} {
+		testAddNet(nets, ns, t)
+	}
+
+	hosts := NewBasic()
+	addIPString(hosts, "10.9.9.9", t)
+	addIPString(hosts, "127.0.0.1", t)
+	addIPString(hosts, "2001:db8::1", t)
+
+	expected := []string{
+		"10.0.0.0/8 is listed more than once",
+		"10.1.0.0/16 is redundant; covered by 10.0.0.0/8",
+		"10.1.2.0/24 is redundant; covered by 10.0.0.0/8",
+		"10.9.9.9 is redundant; covered by 10.0.0.0/8",
+		"2001:db8::1 is redundant; covered by 2001:db8::/32",
+	}
+
+	findings := Lint(hosts, nets)
+	if strings.Join(findings, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected findings\n%s\nbut have\n%s", strings.Join(expected, "\n"), strings.Join(findings, "\n"))
+	}
+
+	if len(nets.whitelist) != 7 || len(hosts.whitelist) != 3 {
+		t.Fatal("Linting should not modify the whitelists")
+	}
+
+	if findings = Lint(hosts, nil); len(findings) != 0 {
+		t.Fatalf("Expected no findings, but have %v", findings)
+	}
+
+	if findings = LintNet(NewBasicNet()); len(findings) != 0 {
+		t.Fatalf("Expected no findings, but have %v", findings)
+	}
+}
@@ -0,0 +1,319 @@
+package whitelist
+
+// This file contains functions for parsing whitelist entries and
+// loading whitelists from directories of fragment files and CSV
+// feeds.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParseNet parses a network in CIDR notation, or in the wildcard
+// shorthand for IPv4 networks where trailing octets are replaced by
+// '*': 10.* is 10.0.0.0/8, 10.1.* and 10.1.*.* are 10.1.0.0/16, and
+// 10.1.2.* is 10.1.2.0/24. Wildcards must be whole, trailing octets,
+// and at least one octet must be given.
+func ParseNet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "*") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > net.IPv4len {
+		return nil, fmt.Errorf("whitelist: too many octets in %q", s)
+	}
+
+	ip := make(net.IP, net.IPv4len)
+	ones := -1
+	for i, part := range parts {
+		if part == "*" {
+			if ones == -1 {
+				ones = i * 8
+			}
+			continue
+		}
+
+		if ones != -1 {
+			return nil, fmt.Errorf("whitelist: wildcards must be trailing octets in %q", s)
+		}
+
+		// ParseUint rejects a sign, so "-0" and "+1" aren't octets.
+		octet, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("whitelist: invalid octet %q in %q", part, s)
+		}
+		ip[i] = byte(octet)
+	}
+
+	if ones == 0 {
+		return nil, fmt.Errorf("whitelist: wildcard %q would match every address", s)
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 32)}, nil
+}
+
+// ParseNetList builds a network whitelist from a comma-separated list
+// of networks in CIDR notation, such as the value of a Kubernetes
+// annotation or ConfigMap key. Unlike UnmarshalJSON, the list isn't
+// quoted. Whitespace around each network is ignored and empty entries
+// are skipped. If any entry can't be parsed, the error describes each
+// such entry along with its position in the list.
+func ParseNetList(s string) (*BasicNet, error) {
+	var nets []*net.IPNet
+	var invalid []string
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("entry %d (%q): %v", i+1, entry, err))
+			continue
+		}
+		nets = append(nets, n)
+	}
+
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("whitelist: invalid network list: %s", strings.Join(invalid, "; "))
+	}
+
+	wl := NewBasicNet()
+	wl.ReplaceAll(nets)
+	return wl, nil
+}
+
+// splitComment splits a line into the entry and any comment
+// following a '#', trimming the whitespace around each. A line
+// consisting only of a comment has an empty entry.
+func splitComment(line string) (entry, comment string) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		comment = strings.TrimSpace(line[i+1:])
+		line = line[:i]
+	}
+	return strings.TrimSpace(line), comment
+}
+
+// scanLines calls fn with each entry in the input, along with the
+// comment following it on its line, if any. There is one entry per
+// line; blank lines and lines beginning with '#' are skipped, an
+// inline comment beginning with '#' is split from the entry, and
+// surrounding whitespace is ignored. Errors returned by fn are
+// annotated with the line number, and with the name of the input
+// if it isn't empty. The input is read a line at a time, so it needn't
+// fit in memory.
+func scanLines(name string, r io.Reader, fn func(entry, comment string) error) error {
+	prefix := "whitelist: "
+	if name != "" {
+		prefix += name + ":"
+	} else {
+		prefix += "line "
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		entry, comment := splitComment(scanner.Text())
+		if entry == "" {
+			continue
+		}
+
+		if err := fn(entry, comment); err != nil {
+			return fmt.Errorf("%s%d: %v", prefix, lineno, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if name == "" {
+			return fmt.Errorf("whitelist: %v", err)
+		}
+		return fmt.Errorf("whitelist: %s: %v", name, err)
+	}
+	return nil
+}
+
+// readFileLines calls scanLines with the contents of the file at
+// path.
+func readFileLines(path string, fn func(entry, comment string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanLines(path, f, fn)
+}
+
+// readDirLines calls readFileLines for each regular file in dir, in
+// lexical order of filename.
+func readDirLines(dir string, fn func(entry, comment string) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+
+		// Stat the file to follow symlinks.
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		if err = readFileLines(path, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadBasicDir loads a host whitelist from every regular file in a
+// directory, merging them into a single whitelist. Each file lists
+// one address per line; blank lines and lines beginning with '#'
+// are ignored. An address may be followed by a comment beginning
+// with '#', which becomes its label:
+//
+//	192.168.3.1 # build server
+func LoadBasicDir(dir string) (*Basic, error) {
+	wl := NewBasic()
+	if err := readDirLines(dir, addHostLine(wl)); err != nil {
+		return nil, err
+	}
+
+	return wl, nil
+}
+
+// addHostLine returns a line handler for scanLines that adds each
+// address to wl, labelled with its comment.
+func addHostLine(wl *Basic) func(entry, comment string) error {
+	return func(entry, comment string) error {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", entry)
+		}
+
+		if comment != "" {
+			wl.AddLabeled(ip, comment)
+		} else {
+			wl.Add(ip)
+		}
+		return nil
+	}
+}
+
+// LoadBasicNetDir loads a network whitelist from every regular file
+// in a directory, merging them into a single whitelist. Each file
+// lists one network per line, in CIDR notation or the wildcard
+// shorthand accepted by ParseNet; blank lines and lines beginning
+// with '#' are ignored. A network may be followed by a comment
+// beginning with '#', which becomes its label:
+//
+//	10.0.0.0/8 # datacenter A
+func LoadBasicNetDir(dir string) (*BasicNet, error) {
+	wl := NewBasicNet()
+	if err := readDirLines(dir, addNetLine(wl)); err != nil {
+		return nil, err
+	}
+
+	return wl, nil
+}
+
+// LoadBasicNetFile loads a network whitelist from a single file, in
+// the format read by LoadBasicNetDir.
+func LoadBasicNetFile(path string) (*BasicNet, error) {
+	wl := NewBasicNet()
+	if err := readFileLines(path, addNetLine(wl)); err != nil {
+		return nil, err
+	}
+
+	return wl, nil
+}
+
+// addNetLine returns a line handler for scanLines that adds each
+// network to wl, labelled with its comment.
+func addNetLine(wl *BasicNet) func(entry, comment string) error {
+	return func(entry, comment string) error {
+		n, err := ParseNet(entry)
+		if err != nil {
+			return fmt.Errorf("invalid network %q", entry)
+		}
+
+		if comment != "" {
+			wl.AddLabeled(n, comment)
+		} else {
+			wl.Add(n)
+		}
+		return nil
+	}
+}
+
+// CSVOptions control how LoadBasicNetCSV parses a feed.
+type CSVOptions struct {
+	// Header indicates that the first row is a header and should
+	// be skipped.
+	Header bool
+
+	// Strict causes malformed rows, including rows without the
+	// requested column, to fail the load. Otherwise they are
+	// skipped.
+	Strict bool
+}
+
+// LoadBasicNetCSV loads a network whitelist from the given column
+// (counting from zero) of each row of a CSV feed. Entries are parsed
+// with ParseNet.
+func LoadBasicNetCSV(r io.Reader, column int, opts CSVOptions) (*BasicNet, error) {
+	if column < 0 {
+		return nil, fmt.Errorf("whitelist: invalid CSV column %d", column)
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	wl := NewBasicNet()
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if row == 1 && opts.Header {
+			continue
+		}
+
+		if column >= len(record) {
+			if opts.Strict {
+				return nil, fmt.Errorf("whitelist: CSV row %d has no column %d", row, column)
+			}
+			continue
+		}
+
+		n, err := ParseNet(strings.TrimSpace(record[column]))
+		if err != nil {
+			if opts.Strict {
+				return nil, fmt.Errorf("whitelist: CSV row %d: invalid network %q", row, record[column])
+			}
+			continue
+		}
+		wl.Add(n)
+	}
+
+	return wl, nil
+}
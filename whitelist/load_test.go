@@ -0,0 +1,270 @@
+package whitelist
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testWriteDir(files map[string]string, t *testing.T) string {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for name, contents := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if err = os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return dir
+}
+
+func TestLoadBasicDir(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"00-local": "# loopback\n127.0.0.1\n\n::1\n",
+		"10-ops":   "  10.0.1.15  \n192.168.1.5",
+	}, t)
+	defer os.RemoveAll(dir)
+
+	wl, err := LoadBasicDir(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "10.0.1.15\n127.0.0.1\n192.168.1.5\n::1"
+	if out := string(DumpBasic(wl)); out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "20-bad"), []byte("127.0.0.2\n192.168.2\n"), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	_, err = LoadBasicDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "20-bad:2:") {
+		t.Fatalf("Expected error naming the file and line, but have %v", err)
+	}
+
+	if _, err = LoadBasicDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("Expected failure loading a missing directory.")
+	}
+}
+
+func TestLoadInlineComments(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"00-local": "127.0.0.1   #  local\n::1#loopback\n192.168.1.5 #\n",
+	}, t)
+	defer os.RemoveAll(dir)
+
+	wl, err := LoadBasicDir(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "127.0.0.1\n192.168.1.5\n::1"
+	if out := string(DumpBasic(wl)); out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	if label, _ := wl.Label(net.IPv4(127, 0, 0, 1)); label != "local" {
+		t.Fatalf("Expected label %q, have %q", "local", label)
+	}
+
+	if label, _ := wl.Label(net.ParseIP("::1")); label != "loopback" {
+		t.Fatalf("Expected label %q, have %q", "loopback", label)
+	}
+
+	if label, _ := wl.Label(net.ParseIP("192.168.1.5")); label != "" {
+		t.Fatalf("Expected no label for an empty comment, have %q", label)
+	}
+
+	dir2 := testWriteDir(map[string]string{
+		"00-dc": "10.0.0.0/8 # datacenter A\n172.16.0.0/12#dc-b\n  # 192.168.0.0/16\n",
+	}, t)
+	defer os.RemoveAll(dir2)
+
+	wlNet, err := LoadBasicNetDir(dir2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(wlNet.whitelist) != 2 {
+		t.Fatalf("Expected 2 networks, but have %d", len(wlNet.whitelist))
+	}
+
+	if label, _ := wlNet.Label(net.ParseIP("10.2.0.1")); label != "datacenter A" {
+		t.Fatalf("Expected label %q, have %q", "datacenter A", label)
+	}
+
+	if label, _ := wlNet.Label(net.ParseIP("172.16.0.1")); label != "dc-b" {
+		t.Fatalf("Expected label %q, have %q", "dc-b", label)
+	}
+
+	if checkIPString(wlNet, "192.168.0.1", t) {
+		t.Fatal("whitelist should not have permitted a commented-out network")
+	}
+
+	// The feed loaders accept the same format.
+	wl, err = LoadBasicGzip(strings.NewReader("127.0.0.1   #  local\n# comment\n::1#loopback\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if label, _ := wl.Label(net.ParseIP("::1")); label != "loopback" || !checkIPString(wl, "127.0.0.1", t) {
+		t.Fatalf("Unexpected whitelist %s", DumpBasic(wl))
+	}
+
+	wlNet, err = LoadBasicNetGzip(strings.NewReader("10.0.0.0/8 # datacenter A\n172.16.0.0/12#dc-b\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if label, _ := wlNet.Label(net.ParseIP("10.2.0.1")); label != "datacenter A" {
+		t.Fatalf("Expected label %q, have %q", "datacenter A", label)
+	}
+
+	if label, _ := wlNet.Label(net.ParseIP("172.16.0.1")); label != "dc-b" {
+		t.Fatalf("Expected label %q, have %q", "dc-b", label)
+	}
+
+	if _, err = LoadBasicNetGzip(strings.NewReader("10.0.0.0/8\n10.0.0.0/33 # bad\n")); err == nil || !strings.Contains(err.Error(), "line 2:") {
+		t.Fatalf("Expected an error naming the line, have %v", err)
+	}
+}
+
+func TestLoadBasicNetDir(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"00-local": "# loopback\n127.0.0.0/8\n",
+		"10-ops":   "10.0.0.0/8\n\n192.168.*\n",
+	}, t)
+	defer os.RemoveAll(dir)
+
+	wl, err := LoadBasicNetDir(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(wl.whitelist) != 3 {
+		t.Fatalf("Expected 3 networks, but have %d", len(wl.whitelist))
+	}
+
+	if !checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "20-bad"), []byte("10.0.0.1\n"), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	_, err = LoadBasicNetDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "20-bad:1:") {
+		t.Fatalf("Expected error naming the file and line, but have %v", err)
+	}
+}
+
+func TestParseNet(t *testing.T) {
+	tv := map[string]string{
+		"10.*":           "10.0.0.0/8",
+		"10.1.*":         "10.1.0.0/16",
+		"10.1.*.*":       "10.1.0.0/16",
+		"192.168.1.*":    "192.168.1.0/24",
+		"192.168.1.0/24": "192.168.1.0/24",
+		"2001:db8::/32":  "2001:db8::/32",
+	}
+
+	for in, expected := range tv {
+		n, err := ParseNet(in)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if n.String() != expected {
+			t.Fatalf("Expected %s to parse as %s, but have %s", in, expected, n)
+		}
+	}
+
+	for _, in := range []string{"*", "*.*.*.*", "10.*.1.*", "10.1*", "10.1.2.3.*", "10.256.*", "10.+1.*", "10.-0.*", "-0.*", "10..*", "2001:db8::*"} {
+		if _, err := ParseNet(in); err == nil {
+			t.Fatalf("Expected failure parsing %s", in)
+		}
+	}
+}
+
+func TestParseNetList(t *testing.T) {
+	wl, err := ParseNetList(" 10.0.0.0/8, ,192.168.3.0/24,2001:db8::/32,")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, _ := wl.MarshalText()
+	if expected := "10.0.0.0/8,192.168.3.0/24,2001:db8::/32"; string(out) != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	if !checkIPString(wl, "192.168.3.1", t) || checkIPString(wl, "192.168.4.1", t) {
+		t.Fatal("Unexpected lookup result")
+	}
+
+	if wl, err = ParseNetList(""); err != nil || len(wl.whitelist) != 0 {
+		t.Fatalf("Expected an empty whitelist, have %v and %v", wl, err)
+	}
+
+	_, err = ParseNetList("10.0.0.0/8,10.0.0.0/33, 192.168.3.1")
+	if err == nil {
+		t.Fatal("Expected invalid networks to be rejected")
+	}
+
+	for _, s := range []string{`entry 2 ("10.0.0.0/33")`, `entry 3 ("192.168.3.1")`} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("Expected the error to describe %s, but have %v", s, err)
+		}
+	}
+}
+
+func TestLoadBasicNetCSV(t *testing.T) {
+	feed := "id,network,source\n1,10.0.0.0/8,a\n2,192.168.*,b\n3,bogus,c\n4\n5,\"2001:db8::/32\",d\n"
+
+	wl, err := LoadBasicNetCSV(strings.NewReader(feed), 1, CSVOptions{Header: true})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := "10.0.0.0/8,192.168.0.0/16,2001:db8::/32"
+	if string(out) != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	_, err = LoadBasicNetCSV(strings.NewReader(feed), 1, CSVOptions{Header: true, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "row 4") {
+		t.Fatalf("Expected error naming row 4, but have %v", err)
+	}
+
+	_, err = LoadBasicNetCSV(strings.NewReader(feed), 1, CSVOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "row 1") {
+		t.Fatalf("Expected error naming the header row, but have %v", err)
+	}
+
+	if _, err = LoadBasicNetCSV(strings.NewReader(feed), -1, CSVOptions{}); err == nil {
+		t.Fatal("Expected failure with an invalid column.")
+	}
+
+	if _, err = LoadBasicNetCSV(strings.NewReader("\"10.0.0.0/8\n"), 0, CSVOptions{}); err == nil {
+		t.Fatal("Expected failure with malformed CSV.")
+	}
+}
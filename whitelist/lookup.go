@@ -1,10 +1,16 @@
 package whitelist
 
 import (
+	"context"
 	"errors"
+	"hash/fnv"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 // NetConnLookup extracts an IP from the remote address in the
@@ -25,6 +31,9 @@ func NetConnLookup(conn net.Conn) (net.IP, error) {
 	}
 
 	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.AddrError{Err: "whitelist: invalid address", Addr: addr}
+	}
 	return ip, nil
 }
 
@@ -41,8 +50,240 @@ func HTTPRequestLookup(req *http.Request) (net.IP, error) {
 	}
 
 	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.AddrError{Err: "whitelist: invalid address", Addr: addr}
+	}
 	return ip, nil
+}
+
+// HandlerOptions contains the optional settings shared by Handler
+// and HandlerFunc. They must be set before the handler is used.
+type HandlerOptions struct {
+	// ReverseLookup, if set, is used to log the hostnames of
+	// denied clients. It is opt-in as it generates DNS traffic.
+	ReverseLookup *ReverseLookup
+
+	// DecisionLog, if set, receives a structured event for each
+	// whitelisting decision.
+	DecisionLog *DecisionLog
+
+	// AccessLog, if set, receives a line in the style of the Common
+	// Log Format for each whitelisting decision; the decision takes
+	// the place of the status and size fields. See the package
+	// README for the field list.
+	AccessLog io.Writer
+
+	// Counters, if set, are incremented for each whitelisting
+	// decision. Requests denied in dry-run mode count as denied.
+	Counters *DecisionCounters
+
+	// Span, if set, returns the tracing span of each request, on
+	// which the decision is recorded as the allowlist.decision and
+	// allowlist.ip attributes. Requests without a span are
+	// unaffected.
+	Span SpanFunc
+
+	// TopDenied, if set, tracks the most frequently denied
+	// client addresses.
+	TopDenied *TopDenied
+
+	// Recent, if set, keeps the most recent whitelisting decisions
+	// for live debugging. It is disabled by default.
+	Recent *RecentDecisions
+
+	// Concurrency, if set, caps the number of requests from each
+	// permitted address that are served at once. Requests over the
+	// cap are refused with a 503.
+	Concurrency *ConcurrencyLimit
+
+	// Methods, if not empty, restricts whitelisting to requests
+	// using one of the listed HTTP methods, such as "POST", "PUT",
+	// and "DELETE" for an API whose reads are public. Requests
+	// using other methods are passed to the allow handler without
+	// a check. By default, every request is checked.
+	Methods []string
+
+	// Tarpit, if set, delays the responses to clients that have
+	// been denied repeatedly. Requests denied in dry-run mode
+	// aren't delayed.
+	Tarpit *Tarpit
+
+	// AllowLoopback, if true, permits requests from loopback
+	// addresses (those in 127.0.0.0/8, and ::1) without consulting
+	// the ACL, as LoopbackOr does.
+	AllowLoopback bool
+
+	// DryRun, if true, runs the whitelist in observe mode: requests
+	// that would have been denied are logged and marked as
+	// untrusted (see Untrusted), but are still passed to the allow
+	// handler. This is useful for vetting a new whitelist before
+	// enforcing it.
+	DryRun bool
+
+	// EnforcePercent, if between 1 and 99, enforces the whitelist
+	// for only that percentage of client addresses, for a gradual
+	// rollout: requests from the remaining addresses that would
+	// have been denied are handled as in dry-run mode. Addresses
+	// are chosen by a hash, so each client is consistently either
+	// enforced or not, and raising the percentage only adds
+	// clients. Any other value enforces the whitelist for every
+	// client; use DryRun to enforce it for none.
+	EnforcePercent int
+
+	// RetryAfter, if positive, is sent in a Retry-After header
+	// (rounded up to whole seconds) when a request is refused. It
+	// is only used when no deny handler is given.
+	RetryAfter time.Duration
 
+	// FailOpen, if true, passes requests whose address can't be
+	// determined to the allow handler with a logged warning. By
+	// default, such requests fail with a 500.
+	FailOpen bool
+}
+
+// exempt returns true if the request's method isn't subject to
+// whitelisting.
+func (opts *HandlerOptions) exempt(req *http.Request) bool {
+	if len(opts.Methods) == 0 {
+		return false
+	}
+
+	for _, method := range opts.Methods {
+		if req.Method == method {
+			return false
+		}
+	}
+	return true
+}
+
+// permitted returns true if the request from ip is permitted by the
+// ACL, or is from a loopback address and AllowLoopback is set.
+func (opts *HandlerOptions) permitted(acl ACL, ip net.IP) bool {
+	if opts.AllowLoopback && isLoopback(ip) {
+		return true
+	}
+	return acl.Permitted(ip)
+}
+
+// lookupFailed handles a request whose address couldn't be
+// determined. It returns true if the request should be allowed;
+// otherwise, the error response has been written.
+func (opts *HandlerOptions) lookupFailed(w http.ResponseWriter, err error) bool {
+	if opts.FailOpen {
+		log.Printf("WARNING: failed to lookup request address, permitting request: %v", logError(err))
+		return true
+	}
+
+	log.Printf("failed to lookup request address: %v", logError(err))
+	status := http.StatusInternalServerError
+	http.Error(w, http.StatusText(status), status)
+	return false
+}
+
+// refuse writes the response for a denied request when no deny
+// handler is given.
+func (opts *HandlerOptions) refuse(w http.ResponseWriter) {
+	if opts.RetryAfter > 0 {
+		secs := (opts.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(secs), 10))
+	}
+
+	status := http.StatusUnauthorized
+	http.Error(w, http.StatusText(status), status)
+}
+
+// acquire takes a concurrency slot for a permitted request from ip.
+// It returns false, having written the error response, if the
+// address is at its limit; otherwise, the caller must call release.
+func (opts *HandlerOptions) acquire(w http.ResponseWriter, ip net.IP) bool {
+	if opts.Concurrency == nil || opts.Concurrency.Acquire(ip) {
+		return true
+	}
+
+	log.Printf("whitelist: too many concurrent requests from %s", logIP(ip))
+	status := http.StatusServiceUnavailable
+	http.Error(w, http.StatusText(status), status)
+	return false
+}
+
+// release returns the concurrency slot taken by acquire.
+func (opts *HandlerOptions) release(ip net.IP) {
+	if opts.Concurrency != nil {
+		opts.Concurrency.Release(ip)
+	}
+}
+
+type untrustedKey struct{}
+
+// Untrusted returns true if the request would have been denied by a
+// handler running in dry-run mode.
+func Untrusted(req *http.Request) bool {
+	untrusted, _ := req.Context().Value(untrustedKey{}).(bool)
+	return untrusted
+}
+
+// observing returns true if a denied request from ip should be
+// observed rather than denied, because the handler is in dry-run
+// mode or ip is outside the EnforcePercent rollout.
+func (opts *HandlerOptions) observing(ip net.IP) bool {
+	if opts.DryRun {
+		return true
+	}
+
+	if opts.EnforcePercent <= 0 || opts.EnforcePercent >= 100 {
+		return false
+	}
+	return rolloutBucket(ip) >= opts.EnforcePercent
+}
+
+// rolloutBucket hashes ip to a number from 0 to 99. IPv4 addresses
+// hash the same in either of their forms.
+func rolloutBucket(ip net.IP) int {
+	h := fnv.New32a()
+	h.Write(ip.To16())
+	return int(h.Sum32() % 100)
+}
+
+// observe handles a denied request in dry-run mode, returning the
+// request marked as untrusted.
+func (opts *HandlerOptions) observe(req *http.Request, ip net.IP) *http.Request {
+	log.Printf("whitelist: dry run: request from %s would have been denied", logIP(ip))
+	return req.WithContext(context.WithValue(req.Context(), untrustedKey{}, true))
+}
+
+// decided records the decision for a request.
+func (opts *HandlerOptions) decided(req *http.Request, ip net.IP, permitted bool) {
+	if opts.Counters != nil {
+		opts.Counters.count(permitted)
+	}
+
+	if opts.DecisionLog != nil {
+		opts.DecisionLog.Log(req, ip, permitted)
+	}
+
+	if opts.AccessLog != nil {
+		writeAccessLog(opts.AccessLog, req, ip, permitted)
+	}
+
+	if sink := requestSink(req); sink != nil {
+		sink(ip, permitted)
+	}
+
+	if opts.Span != nil {
+		opts.Span.annotate(req, ip, permitted)
+	}
+
+	if opts.Recent != nil {
+		opts.Recent.Record(req, ip, permitted)
+	}
+
+	if !permitted && opts.TopDenied != nil {
+		opts.TopDenied.Record(ip)
+	}
+
+	if !permitted && opts.ReverseLookup != nil {
+		opts.ReverseLookup.LogDenied(ip)
+	}
 }
 
 // Handler wraps an HTTP handler with IP whitelisting.
@@ -50,13 +291,27 @@ type Handler struct {
 	allowHandler http.Handler
 	denyHandler  http.Handler
 	whitelist    ACL
+
+	HandlerOptions
 }
 
 // NewHandler returns a new whitelisting-wrapped HTTP handler. The
 // allow handler should contain a handler that will be called if the
 // request is whitelisted; the deny handler should contain a handler
-// that will be called in the request is not whitelisted.
+// that will be called in the request is not whitelisted. To set any
+// of the HandlerOptions, use NewHandlerWithOptions.
 func NewHandler(allow, deny http.Handler, acl ACL) (http.Handler, error) {
+	h, err := NewHandlerWithOptions(allow, deny, acl, HandlerOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// NewHandlerWithOptions is like NewHandler, but takes a copy of opts
+// as the handler's options. The options may also be changed through
+// the returned Handler before it is used.
+func NewHandlerWithOptions(allow, deny http.Handler, acl ACL, opts HandlerOptions) (*Handler, error) {
 	if allow == nil {
 		return nil, errors.New("whitelist: allow cannot be nil")
 	}
@@ -66,34 +321,144 @@ func NewHandler(allow, deny http.Handler, acl ACL) (http.Handler, error) {
 	}
 
 	return &Handler{
-		allowHandler: allow,
-		denyHandler:  deny,
-		whitelist:    acl,
+		allowHandler:   allow,
+		denyHandler:    deny,
+		whitelist:      acl,
+		HandlerOptions: opts,
 	}, nil
 }
 
 // ServeHTTP wraps the request in a whitelist check.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.exempt(req) {
+		h.allowHandler.ServeHTTP(w, req)
+		return
+	}
+
 	ip, err := HTTPRequestLookup(req)
 	if err != nil {
-		log.Printf("failed to lookup request address: %v", err)
-		status := http.StatusInternalServerError
-		http.Error(w, http.StatusText(status), status)
+		if h.lookupFailed(w, err) {
+			h.allowHandler.ServeHTTP(w, req)
+		}
 		return
 	}
 
-	if h.whitelist.Permitted(ip) {
+	permitted := h.permitted(h.whitelist, ip)
+	h.decided(req, ip, permitted)
+	if !permitted && h.observing(ip) {
+		req = h.observe(req, ip)
+		permitted = true
+	}
+
+	if permitted {
+		if !h.acquire(w, ip) {
+			return
+		}
+		defer h.release(ip)
 		h.allowHandler.ServeHTTP(w, req)
 	} else {
+		if h.Tarpit != nil {
+			h.Tarpit.wait(req.Context(), ip)
+		}
+
 		if h.denyHandler == nil {
-			status := http.StatusUnauthorized
-			http.Error(w, http.StatusText(status), status)
+			h.refuse(w)
 		} else {
 			h.denyHandler.ServeHTTP(w, req)
 		}
 	}
 }
 
+// Middleware adapts whitelisting to the standard middleware model,
+// in which the allow action is to call the next handler in the
+// chain. Its Wrap method has the func(http.Handler) http.Handler
+// signature used by most routers.
+type Middleware struct {
+	denyHandler http.Handler
+	whitelist   ACL
+
+	HandlerOptions
+}
+
+// NewMiddleware returns a new whitelisting middleware. Denied
+// requests are passed to the deny handler; if it is nil, they are
+// refused as by a Handler.
+func NewMiddleware(deny http.Handler, acl ACL) (*Middleware, error) {
+	if acl == nil {
+		return nil, errors.New("whitelist: ACL cannot be nil")
+	}
+
+	return &Middleware{
+		denyHandler: deny,
+		whitelist:   acl,
+	}, nil
+}
+
+// Wrap returns a Handler that passes whitelisted requests to next.
+// The Handler takes a copy of the middleware's options when Wrap is
+// called, so options should be set beforehand. Wrap panics if next
+// is nil.
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	if next == nil {
+		panic("whitelist: next handler cannot be nil")
+	}
+
+	return &Handler{
+		allowHandler:   next,
+		denyHandler:    m.denyHandler,
+		whitelist:      m.whitelist,
+		HandlerOptions: m.HandlerOptions,
+	}
+}
+
+// DefaultRedirectParam is the query parameter used by a Redirect to
+// carry the original request path if no other parameter is given.
+const DefaultRedirectParam = "next"
+
+// Redirect is a deny handler that sends non-whitelisted clients to a
+// challenge page (such as a captcha) with a 302 Found, rather than
+// refusing them outright. The original request path and query are
+// passed to the challenge page in a query parameter so that the
+// client can be returned there after passing the challenge.
+type Redirect struct {
+	target *url.URL
+	param  string
+}
+
+// NewRedirect returns a new Redirect to the target URL. The original
+// request path is passed in the param query parameter; if param is
+// empty, DefaultRedirectParam is used. The Redirect may be used as
+// the deny handler for a Handler, or its ServeHTTP method as the
+// deny function for a HandlerFunc.
+func NewRedirect(target, param string) (*Redirect, error) {
+	if target == "" {
+		return nil, errors.New("whitelist: redirect target cannot be empty")
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if param == "" {
+		param = DefaultRedirectParam
+	}
+
+	return &Redirect{
+		target: u,
+		param:  param,
+	}, nil
+}
+
+// ServeHTTP redirects the request to the challenge page.
+func (rd *Redirect) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u := *rd.target
+	q := u.Query()
+	q.Set(rd.param, req.URL.RequestURI())
+	u.RawQuery = q.Encode()
+	http.Redirect(w, req, u.String(), http.StatusFound)
+}
+
 // A HandlerFunc contains a pair of http.HandleFunc-handler functions
 // that will be called depending on whether a request is allowed or
 // denied.
@@ -101,6 +466,8 @@ type HandlerFunc struct {
 	allow     func(http.ResponseWriter, *http.Request)
 	deny      func(http.ResponseWriter, *http.Request)
 	whitelist ACL
+
+	HandlerOptions
 }
 
 // NewHandlerFunc returns a new basic whitelisting handler.
@@ -123,20 +490,39 @@ func NewHandlerFunc(allow, deny func(http.ResponseWriter, *http.Request), acl AC
 // ServeHTTP checks the incoming request to see whether it is permitted,
 // and calls the appropriate handle function.
 func (h *HandlerFunc) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.exempt(req) {
+		h.allow(w, req)
+		return
+	}
+
 	ip, err := HTTPRequestLookup(req)
 	if err != nil {
-		log.Printf("failed to lookup request address: %v", err)
-		status := http.StatusInternalServerError
-		http.Error(w, http.StatusText(status), status)
+		if h.lookupFailed(w, err) {
+			h.allow(w, req)
+		}
 		return
 	}
 
-	if h.whitelist.Permitted(ip) {
+	permitted := h.permitted(h.whitelist, ip)
+	h.decided(req, ip, permitted)
+	if !permitted && h.observing(ip) {
+		req = h.observe(req, ip)
+		permitted = true
+	}
+
+	if permitted {
+		if !h.acquire(w, ip) {
+			return
+		}
+		defer h.release(ip)
 		h.allow(w, req)
 	} else {
+		if h.Tarpit != nil {
+			h.Tarpit.wait(req.Context(), ip)
+		}
+
 		if h.deny == nil {
-			status := http.StatusUnauthorized
-			http.Error(w, http.StatusText(status), status)
+			h.refuse(w)
 		} else {
 			h.deny(w, req)
 		}
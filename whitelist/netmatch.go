@@ -0,0 +1,86 @@
+package whitelist
+
+// This file contains a precomputed form of networks for fast
+// matching.
+
+import "net"
+
+// A netMatcher is a network with its address already masked, for
+// matching addresses without repeating the conversions done by
+// net.IPNet.Contains on every lookup. It matches exactly the same
+// addresses as the network it was compiled from.
+type netMatcher struct {
+	// n is the number of significant bytes: 4 for an IPv4
+	// network, 16 for an IPv6 network, and 0 for a network that
+	// matches nothing.
+	n    int
+	addr [net.IPv6len]byte
+	mask [net.IPv6len]byte
+}
+
+// compileNet returns the matcher for a network. It follows the
+// rules of net.IPNet.Contains, including for networks mixing 4-byte
+// and 16-byte addresses and masks.
+func compileNet(n *net.IPNet) netMatcher {
+	var m netMatcher
+	if n == nil {
+		return m
+	}
+
+	ip := n.IP.To4()
+	if ip == nil {
+		ip = n.IP
+		if len(ip) != net.IPv6len {
+			return m
+		}
+	}
+
+	mask := n.Mask
+	switch len(mask) {
+	case net.IPv4len:
+		if len(ip) != net.IPv4len {
+			return m
+		}
+	case net.IPv6len:
+		if len(ip) == net.IPv4len {
+			mask = mask[12:]
+		}
+	default:
+		return m
+	}
+
+	m.n = len(ip)
+	for i := 0; i < m.n; i++ {
+		m.mask[i] = mask[i]
+		m.addr[i] = ip[i] & mask[i]
+	}
+	return m
+}
+
+// compileNets appends the matchers for the networks to ms.
+func compileNets(ms []netMatcher, nets []*net.IPNet) []netMatcher {
+	for _, n := range nets {
+		if m := compileNet(n); m.n != 0 {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// contains returns true if the network contains ip.
+func (m *netMatcher) contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if len(ip) != m.n {
+		return false
+	}
+
+	for i := 0; i < m.n; i++ {
+		if ip[i]&m.mask[i] != m.addr[i] {
+			return false
+		}
+	}
+	return true
+}
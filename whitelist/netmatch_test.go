@@ -0,0 +1,55 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetMatcher(t *testing.T) {
+	nets := []*net.IPNet{
+		{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+		{IP: net.IP{10, 1, 2, 3}, Mask: net.CIDRMask(16, 32)},
+		{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(16, 32)},
+		{IP: net.ParseIP("192.168.0.0"), Mask: net.CIDRMask(112, 128)},
+		{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+		{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)},
+		{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(8, 32)},
+		{IP: net.IP{1, 2, 3}, Mask: net.CIDRMask(8, 32)},
+		{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}},
+	}
+
+	ips := []net.IP{
+		{10, 1, 2, 3},
+		net.ParseIP("10.1.2.3"),
+		{10, 2, 0, 1},
+		net.ParseIP("192.168.3.1"),
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("2001:db9::1"),
+		net.ParseIP("::1"),
+		{1, 2, 3},
+		nil,
+	}
+
+	for _, n := range nets {
+		m := compileNet(n)
+		for _, ip := range ips {
+			if m.contains(ip) != n.Contains(ip) {
+				t.Fatalf("Matcher for %v disagrees with Contains for %v", n, ip)
+			}
+		}
+	}
+}
+
+func TestBasicNetRecompile(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "10.0.0.0/8", t)
+	if !checkIPString(wl, "10.1.2.3", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	testDelNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+	if checkIPString(wl, "10.1.2.3", t) || !checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("Expected lookups to see the modified whitelist")
+	}
+}
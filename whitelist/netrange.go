@@ -0,0 +1,218 @@
+package whitelist
+
+// This file contains helpers for treating networks as ranges of
+// addresses. They are used to aggregate network whitelists into the
+// smallest equivalent set of networks.
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// An ipRange is an inclusive range of addresses. Both ends are
+// either 4 bytes (IPv4) or 16 bytes (IPv6) long.
+type ipRange struct {
+	first net.IP
+	last  net.IP
+}
+
+// networkRange returns the range of addresses covered by the
+// network. It returns false if the network is invalid, i.e. if it
+// has a non-canonical mask or the address doesn't match the mask.
+func networkRange(n *net.IPNet) (ipRange, bool) {
+	if n == nil {
+		return ipRange{}, false
+	}
+
+	_, bits := n.Mask.Size()
+	if bits == 0 {
+		return ipRange{}, false
+	}
+
+	first := n.IP.Mask(n.Mask)
+	if first == nil {
+		return ipRange{}, false
+	}
+
+	if bits == 32 {
+		first = first.To4()
+	} else {
+		first = first.To16()
+	}
+
+	if first == nil || len(first) != len(n.Mask) {
+		return ipRange{}, false
+	}
+
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^n.Mask[i]
+	}
+
+	return ipRange{first: first, last: last}, true
+}
+
+// contains returns true if r covers every address in other.
+func (r ipRange) contains(other ipRange) bool {
+	if len(r.first) != len(other.first) {
+		return false
+	}
+
+	return bytes.Compare(r.first, other.first) <= 0 &&
+		bytes.Compare(other.last, r.last) <= 0
+}
+
+// nextIP returns the address following ip. The second return value
+// is false if ip was the last address in its address space.
+func nextIP(ip net.IP) (net.IP, bool) {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next, true
+		}
+	}
+	return nil, false
+}
+
+// prevIP returns the address preceding ip. The second return value
+// is false if ip was the first address in its address space.
+func prevIP(ip net.IP) (net.IP, bool) {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			return prev, true
+		}
+	}
+	return nil, false
+}
+
+// mergeRanges sorts the ranges and coalesces any that overlap or
+// are adjacent. IPv4 ranges sort before IPv6 ranges, and the two
+// are never merged with each other.
+func mergeRanges(ranges []ipRange) []ipRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		if len(ranges[i].first) != len(ranges[j].first) {
+			return len(ranges[i].first) < len(ranges[j].first)
+		}
+		return bytes.Compare(ranges[i].first, ranges[j].first) < 0
+	})
+
+	var merged []ipRange
+	for _, r := range ranges {
+		if len(merged) == 0 {
+			merged = append(merged, r)
+			continue
+		}
+
+		cur := &merged[len(merged)-1]
+		if len(cur.first) != len(r.first) {
+			merged = append(merged, r)
+			continue
+		}
+
+		next, ok := nextIP(cur.last)
+		if !ok {
+			// cur already runs to the end of the address
+			// space, so it covers r.
+			continue
+		}
+
+		if bytes.Compare(r.first, next) > 0 {
+			merged = append(merged, r)
+			continue
+		}
+
+		if bytes.Compare(r.last, cur.last) > 0 {
+			cur.last = r.last
+		}
+	}
+
+	return merged
+}
+
+// rangeNetworks returns the smallest set of networks that exactly
+// covers the range, in ascending order.
+func rangeNetworks(r ipRange) []*net.IPNet {
+	var nets []*net.IPNet
+	bits := len(r.first) * 8
+	start := r.first
+	for {
+		// Find the largest network that begins at start
+		// and doesn't extend past the end of the range.
+		var n *net.IPNet
+		var last net.IP
+		for ones := 0; ones <= bits; ones++ {
+			mask := net.CIDRMask(ones, bits)
+			if !start.Mask(mask).Equal(start) {
+				continue
+			}
+
+			cand := &net.IPNet{IP: start, Mask: mask}
+			cr, _ := networkRange(cand)
+			if bytes.Compare(cr.last, r.last) <= 0 {
+				n, last = cand, cr.last
+				break
+			}
+		}
+
+		nets = append(nets, n)
+		if bytes.Equal(last, r.last) {
+			return nets
+		}
+
+		start, _ = nextIP(last)
+	}
+}
+
+// aggregateNetworks returns the smallest set of networks covering
+// exactly the same addresses as the input, sorted with IPv4
+// networks first. Invalid networks are ignored.
+func aggregateNetworks(nets []*net.IPNet) []*net.IPNet {
+	ranges := make([]ipRange, 0, len(nets))
+	for _, n := range nets {
+		r, ok := networkRange(n)
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+
+	var out []*net.IPNet
+	for _, r := range mergeRanges(ranges) {
+		out = append(out, rangeNetworks(r)...)
+	}
+	return out
+}
+
+// complementRanges returns the parts of parent that aren't covered by
+// any of the merged ranges, in ascending order.
+func complementRanges(parent ipRange, merged []ipRange) []ipRange {
+	var gaps []ipRange
+	cur := parent.first
+	for _, r := range merged {
+		if len(r.first) != len(parent.first) || bytes.Compare(r.last, cur) < 0 {
+			continue
+		}
+
+		if bytes.Compare(r.first, parent.last) > 0 {
+			break
+		}
+
+		if bytes.Compare(r.first, cur) > 0 {
+			last, _ := prevIP(r.first)
+			gaps = append(gaps, ipRange{first: cur, last: last})
+		}
+
+		next, ok := nextIP(r.last)
+		if !ok || bytes.Compare(next, parent.last) > 0 {
+			return gaps
+		}
+		cur = next
+	}
+
+	return append(gaps, ipRange{first: cur, last: parent.last})
+}
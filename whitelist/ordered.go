@@ -0,0 +1,72 @@
+package whitelist
+
+// This file contains an ACL that consults several ACLs in priority
+// order.
+
+import (
+	"net"
+	"sort"
+	"sync"
+)
+
+type orderedMember struct {
+	acl      ACL
+	priority int
+}
+
+// Ordered permits an address if any of its member ACLs does,
+// consulting the members in priority order and stopping at the first
+// that permits the address. Giving cheap or frequently matching
+// members a higher priority than expensive ones, such as a remote
+// lookup, avoids consulting the expensive members for most
+// addresses.
+type Ordered struct {
+	lock    *sync.Mutex
+	members []orderedMember
+}
+
+// NewOrdered returns a new Ordered with no members, which denies
+// every address.
+func NewOrdered() *Ordered {
+	return &Ordered{
+		lock: new(sync.Mutex),
+	}
+}
+
+// Register adds a member ACL. Members with a higher priority are
+// consulted first; members with the same priority are consulted in
+// the order in which they were registered.
+func (o *Ordered) Register(acl ACL, priority int) {
+	if acl == nil {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// Copy the members so that lookups using the old slice
+	// aren't affected.
+	members := make([]orderedMember, len(o.members), len(o.members)+1)
+	copy(members, o.members)
+	members = append(members, orderedMember{acl: acl, priority: priority})
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].priority > members[j].priority
+	})
+	o.members = members
+}
+
+// Permitted returns true if any member ACL permits the IP. The lock
+// isn't held while members are consulted, so a slow member doesn't
+// block registration.
+func (o *Ordered) Permitted(ip net.IP) bool {
+	o.lock.Lock()
+	members := o.members
+	o.lock.Unlock()
+
+	for _, m := range members {
+		if m.acl.Permitted(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestOrdered(t *testing.T) {
+	var consulted []string
+	member := func(name string, permitted bool) ACL {
+		return FuncACL(func(net.IP) bool {
+			consulted = append(consulted, name)
+			return permitted
+		})
+	}
+
+	o := NewOrdered()
+	if o.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected an empty Ordered to deny every address")
+	}
+
+	o.Register(member("remote", true), 0)
+	o.Register(member("cache", false), 10)
+	o.Register(member("static", false), 10)
+	o.Register(nil, 100)
+
+	if !o.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected the address to be permitted")
+	}
+
+	if len(consulted) != 3 || consulted[0] != "cache" || consulted[1] != "static" || consulted[2] != "remote" {
+		t.Fatalf("Unexpected evaluation order %v", consulted)
+	}
+
+	consulted = nil
+	o.Register(member("first", true), 20)
+	if !o.Permitted(net.IP{127, 0, 0, 1}) || len(consulted) != 1 || consulted[0] != "first" {
+		t.Fatalf("Expected evaluation to stop at the first permit, but consulted %v", consulted)
+	}
+}
@@ -0,0 +1,155 @@
+package whitelist
+
+// This file contains incremental updates to whitelists.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// A Patch is an incremental change to a whitelist, as accepted by
+// ApplyPatch, such as from a REST admin endpoint. In JSON, it is an
+// object with optional "add" and "remove" lists of entries:
+//
+//	{"add":["192.168.3.1"],"remove":["10.0.0.1"]}
+type Patch struct {
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// decodePatch parses a JSON patch document. Unknown fields are
+// rejected, so that a misspelt list isn't silently ignored.
+func decodePatch(in []byte) (*Patch, error) {
+	var patch Patch
+	dec := json.NewDecoder(bytes.NewReader(in))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		return nil, fmt.Errorf("whitelist: invalid patch: %v", err)
+	}
+	return &patch, nil
+}
+
+// patchError returns the error for a patch with invalid entries.
+func patchError(invalid []string) error {
+	return fmt.Errorf("whitelist: invalid entries in patch %s", strings.Join(invalid, ", "))
+}
+
+// ApplyPatch applies a JSON patch document (see Patch) to the
+// whitelist, adding and then removing hosts, so that a host in both
+// lists ends up removed. The patch is applied atomically: if any
+// entry is invalid, the whitelist is left unchanged and the error
+// lists every such entry. It returns the number of hosts in the
+// whitelist after the patch.
+func (wl *Basic) ApplyPatch(in []byte) (int, error) {
+	patch, err := decodePatch(in)
+	if err != nil {
+		return 0, err
+	}
+
+	var invalid []string
+	parse := func(entries []string) []string {
+		keys := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ip := net.ParseIP(strings.TrimSpace(entry))
+			if ip == nil {
+				invalid = append(invalid, fmt.Sprintf("%q", entry))
+				continue
+			}
+			keys = append(keys, hostKey(ip))
+		}
+		return keys
+	}
+
+	add, remove := parse(patch.Add), parse(patch.Remove)
+	if len(invalid) > 0 {
+		return 0, patchError(invalid)
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	for _, addr := range add {
+		wl.whitelist[addr] = true
+	}
+
+	for _, addr := range remove {
+		delete(wl.whitelist, addr)
+		delete(wl.labels, addr)
+	}
+
+	return len(wl.whitelist), nil
+}
+
+// ApplyPatch applies a JSON patch document (see Patch) to the
+// whitelist, adding and then removing networks in CIDR notation, so
+// that a network in both lists ends up removed. Networks that are
+// already present aren't added again, and removing a network removes
+// every entry equal to it; as with Remove, subnets of a removed
+// network are kept. The patch is applied atomically: if any entry is
+// invalid, the whitelist is left unchanged and the error lists every
+// such entry. It returns the number of networks in the whitelist
+// after the patch.
+func (wl *BasicNet) ApplyPatch(in []byte) (int, error) {
+	patch, err := decodePatch(in)
+	if err != nil {
+		return 0, err
+	}
+
+	var invalid []string
+	parse := func(entries []string) []*net.IPNet {
+		nets := make([]*net.IPNet, 0, len(entries))
+		for _, entry := range entries {
+			_, n, err := net.ParseCIDR(strings.TrimSpace(entry))
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%q", entry))
+				continue
+			}
+			nets = append(nets, n)
+		}
+		return nets
+	}
+
+	add, remove := parse(patch.Add), parse(patch.Remove)
+	if len(invalid) > 0 {
+		return 0, patchError(invalid)
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+
+	present := make(map[string]bool, len(wl.whitelist))
+	for _, n := range wl.whitelist {
+		present[netKey(n)] = true
+	}
+
+	for _, n := range add {
+		if key := netKey(n); !present[key] {
+			present[key] = true
+			wl.whitelist = append(wl.whitelist, n)
+		}
+	}
+
+	if len(remove) > 0 {
+		drop := make(map[string]bool, len(remove))
+		for _, n := range remove {
+			key := netKey(n)
+			drop[key] = true
+			delete(wl.labels, key)
+		}
+
+		kept := wl.whitelist[:0]
+		for _, n := range wl.whitelist {
+			if !drop[netKey(n)] {
+				kept = append(kept, n)
+			}
+		}
+		wl.whitelist = kept
+	}
+
+	return len(wl.whitelist), nil
+}
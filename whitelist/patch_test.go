@@ -0,0 +1,84 @@
+package whitelist
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestBasicApplyPatch(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+	wl.AddLabeled(net.ParseIP("10.0.0.1"), "old")
+
+	count, err := wl.ApplyPatch([]byte(`{"add":["192.168.3.1","2001:DB8::1","10.0.0.2"],"remove":["10.0.0.1","10.0.0.2"]}`))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if count != 3 {
+		t.Fatalf("Expected 3 entries, but have %d", count)
+	}
+
+	tv := map[string]bool{
+		"127.0.0.1":   true,
+		"192.168.3.1": true,
+		"2001:db8::1": true,
+		"10.0.0.1":    false,
+		"10.0.0.2":    false,
+	}
+
+	for addr, permitted := range tv {
+		if checkIPString(wl, addr, t) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if _, ok := wl.labels["10.0.0.1"]; ok {
+		t.Fatal("Expected the removed host's label to be dropped")
+	}
+
+	_, err = wl.ApplyPatch([]byte(`{"add":["192.168.3.2","bogus"],"remove":["127.0.0.1","10.0.0.0/8"]}`))
+	if err == nil || !strings.Contains(err.Error(), `"bogus", "10.0.0.0/8"`) {
+		t.Fatalf("Expected every invalid entry to be reported, but have %v", err)
+	}
+
+	if checkIPString(wl, "192.168.3.2", t) || !checkIPString(wl, "127.0.0.1", t) {
+		t.Fatal("Expected a failed patch to leave the whitelist unchanged")
+	}
+
+	for _, in := range []string{`{"adds":["192.168.3.2"]}`, `["192.168.3.2"]`, ``} {
+		if _, err = wl.ApplyPatch([]byte(in)); err == nil {
+			t.Fatalf("Expected patch %q to be rejected", in)
+		}
+	}
+}
+
+func TestBasicNetApplyPatch(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+
+	count, err := wl.ApplyPatch([]byte(`{"add":["10.0.0.0/8","172.16.0.0/12","2001:db8::/32"],"remove":["192.168.0.0/16"]}`))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, _ := wl.MarshalText()
+	if expected := "10.0.0.0/8,172.16.0.0/12,2001:db8::/32"; count != 3 || string(out) != expected {
+		t.Fatalf("Expected %s, but have %d entries %s", expected, count, out)
+	}
+
+	if !checkIPString(wl, "172.16.1.1", t) || checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("Unexpected lookup result after patching")
+	}
+
+	if _, err = wl.ApplyPatch([]byte(`{"add":["192.168.3.0/24","192.168.3.1"]}`)); err == nil {
+		t.Fatal("Expected a patch with an invalid network to be rejected")
+	}
+
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("Expected a failed patch to leave the whitelist unchanged")
+	}
+}
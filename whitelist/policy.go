@@ -0,0 +1,200 @@
+package whitelist
+
+// This file contains a firewall-style policy combining an allow list
+// and a deny list, and a parser for policies given as a list of
+// ordered rules.
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// A Policy combines an allow list and a deny list, in the manner of
+// a firewall: an address in the deny list is always denied, even if
+// it is also in the allow list; otherwise, an address in the allow
+// list is permitted, and any other address gets the default
+// decision.
+//
+// Both lists are NetACLs of the networks they contain, such as
+// BasicNets, so that an address is in the deny list if the deny
+// list's Permitted method returns true for it. Note that this is the
+// opposite of a TrieDenylist, which permits the addresses outside
+// its networks.
+type Policy struct {
+	allow         NetACL
+	deny          NetACL
+	defaultPermit bool
+}
+
+// NewPolicy returns a new Policy from the allow and deny lists. If
+// either is nil, an empty BasicNet is used in its place.
+// defaultPermit is the decision for addresses in neither list.
+func NewPolicy(allow, deny NetACL, defaultPermit bool) *Policy {
+	if allow == nil {
+		allow = NewBasicNet()
+	}
+
+	if deny == nil {
+		deny = NewBasicNet()
+	}
+
+	return &Policy{
+		allow:         allow,
+		deny:          deny,
+		defaultPermit: defaultPermit,
+	}
+}
+
+// Allow returns the policy's allow list, so that networks can be
+// added to or removed from it.
+func (p *Policy) Allow() NetACL {
+	return p.allow
+}
+
+// Deny returns the policy's deny list, so that networks can be added
+// to or removed from it.
+func (p *Policy) Deny() NetACL {
+	return p.deny
+}
+
+// Permitted returns false if the IP is in the deny list, true if it
+// is in the allow list, and the default decision otherwise. Invalid
+// addresses are always denied.
+func (p *Policy) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	if p.deny.Permitted(ip) {
+		return false
+	}
+
+	if p.allow.Permitted(ip) {
+		return true
+	}
+
+	return p.defaultPermit
+}
+
+// A policyRule is a single allow or deny rule in a parsed policy. A
+// rule with a nil network matches loopback addresses.
+type policyRule struct {
+	permit bool
+	n      *net.IPNet
+}
+
+func (r policyRule) matches(ip net.IP) bool {
+	if r.n == nil {
+		return isLoopback(ip)
+	}
+	return r.n.Contains(ip)
+}
+
+// A rulePolicy is an ACL built by ParsePolicy: its rules are
+// evaluated in order, and the first that matches an address decides
+// it.
+type rulePolicy struct {
+	rules         []policyRule
+	defaultPermit bool
+}
+
+// Permitted returns the decision of the first rule matching the IP,
+// or the default decision if none does. Invalid addresses are always
+// denied.
+func (p *rulePolicy) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	for _, r := range p.rules {
+		if r.matches(ip) {
+			return r.permit
+		}
+	}
+	return p.defaultPermit
+}
+
+// ParsePolicy builds an ACL from a compact policy string, such as a
+// configuration value:
+//
+//	deny; deny 10.1.0.0/16; allow 10.0.0.0/8; allow-loopback
+//
+// A policy is a list of statements separated by semicolons or
+// newlines; empty statements are skipped. Each statement is one of:
+//
+//	allow | deny                  the default decision
+//	allow NETWORK | deny NETWORK  a rule for a network or address
+//	allow-loopback | deny-loopback
+//	                              a rule for loopback addresses
+//
+// NETWORK is an address, or a network as accepted by ParseNet. The
+// default decision must be given exactly once, and may appear
+// anywhere. The rules are evaluated in the order given, and the
+// first rule matching an address decides it; an address matching
+// no rule gets the default decision. Errors give the line and the
+// offending statement.
+func ParsePolicy(s string) (ACL, error) {
+	p := &rulePolicy{}
+	var haveDefault bool
+
+	for lineno, line := range strings.Split(s, "\n") {
+		for _, stmt := range strings.Split(line, ";") {
+			fields := strings.Fields(stmt)
+			if len(fields) == 0 {
+				continue
+			}
+
+			fail := func(format string, args ...interface{}) error {
+				return fmt.Errorf("whitelist: policy line %d: %q: %s", lineno+1,
+					strings.Join(fields, " "), fmt.Sprintf(format, args...))
+			}
+
+			var permit bool
+			switch fields[0] {
+			case "allow", "allow-loopback":
+				permit = true
+			case "deny", "deny-loopback":
+			default:
+				return nil, fail("unknown action %q", fields[0])
+			}
+
+			switch {
+			case strings.HasSuffix(fields[0], "-loopback"):
+				if len(fields) != 1 {
+					return nil, fail("unexpected %q after %s", fields[1], fields[0])
+				}
+				p.rules = append(p.rules, policyRule{permit: permit})
+			case len(fields) == 1:
+				if haveDefault {
+					return nil, fail("default decision given more than once")
+				}
+				haveDefault = true
+				p.defaultPermit = permit
+			case len(fields) == 2:
+				n, err := parsePolicyNet(fields[1])
+				if err != nil {
+					return nil, fail("invalid network %q", fields[1])
+				}
+				p.rules = append(p.rules, policyRule{permit: permit, n: n})
+			default:
+				return nil, fail("unexpected %q after the network", fields[2])
+			}
+		}
+	}
+
+	if !haveDefault {
+		return nil, errors.New("whitelist: policy has no default decision")
+	}
+	return p, nil
+}
+
+// parsePolicyNet parses a network in a policy rule, which may also
+// be a single address.
+func parsePolicyNet(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return hostNet(ip), nil
+	}
+	return ParseNet(s)
+}
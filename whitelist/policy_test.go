@@ -0,0 +1,105 @@
+package whitelist
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	p := NewPolicy(nil, nil, false)
+	testAddNet(p.Allow(), "10.0.0.0/8", t)
+	testAddNet(p.Deny(), "10.1.0.0/16", t)
+	testAddNet(p.Deny(), "192.168.3.0/24", t)
+
+	tv := map[string]bool{
+		"10.2.0.1":    true,
+		"10.1.0.1":    false,
+		"192.168.3.1": false,
+		"192.168.4.1": false,
+	}
+
+	for addr, permitted := range tv {
+		if p.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	p = NewPolicy(p.Allow(), p.Deny(), true)
+	tv["192.168.4.1"] = true
+	for addr, permitted := range tv {
+		if p.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v with a default permit", addr, permitted)
+		}
+	}
+
+	if p.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	acl, err := ParsePolicy("deny; deny 10.1.0.0/16; allow 10.0.0.0/8; allow 192.168.*\nallow 2001:db8::1 ;; allow-loopback")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv := map[string]bool{
+		"10.2.0.1":    true,
+		"10.1.0.1":    false,
+		"192.168.3.1": true,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"127.0.0.1":   true,
+		"::1":         true,
+		"172.16.0.1":  false,
+	}
+
+	for addr, permitted := range tv {
+		if acl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	// The first matching rule decides, so this denies 10.1.0.0/16.
+	acl, err = ParsePolicy("deny 10.1.0.0/16; deny-loopback; allow 10.0.0.0/8; allow 127.0.0.0/8; allow")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tv = map[string]bool{
+		"10.2.0.1":   true,
+		"10.1.0.1":   false,
+		"127.0.0.1":  false,
+		"172.16.0.1": true,
+	}
+
+	for addr, permitted := range tv {
+		if acl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tv := map[string]string{
+		"":                                  "no default decision",
+		"allow 10.0.0.0/8":                  "no default decision",
+		"deny; allow":                       "more than once",
+		"deny; alow 10.0.0.0/8":             `line 1: "alow 10.0.0.0/8": unknown action "alow"`,
+		"deny\nallow 10.0.0.0/33":           `line 2: "allow 10.0.0.0/33": invalid network`,
+		"deny; allow 10.0.0.0/8 10.1.0.0/8": `unexpected "10.1.0.0/8"`,
+		"deny; allow-loopback 127.0.0.1":    `unexpected "127.0.0.1" after allow-loopback`,
+	}
+
+	for policy, msg := range tv {
+		_, err := ParsePolicy(policy)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("Expected an error containing %q for %q, have %v", msg, policy, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package whitelist
+
+// This file contains an ACL permitting addresses by the domain of
+// their verified reverse DNS names.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ptrEntry struct {
+	decision Decision
+	expires  time.Time
+}
+
+// A PTRSuffixACL permits addresses whose reverse DNS name is under
+// one of a list of domains, for partners with stable PTR records but
+// rotating addresses. As anyone controlling an address's reverse
+// zone can claim any name, each name is forward-confirmed: it is
+// only trusted if it resolves back to the address being checked.
+//
+// Lookups are made synchronously from Permitted, and each is
+// abandoned after DefaultReverseTimeout. A name that doesn't exist
+// is a denial, but any other lookup failure, such as a timeout, is
+// reported by PermittedDetailed as Indeterminate. Allow and Deny
+// decisions are cached for a TTL, and up to DefaultReverseCacheSize
+// of them are kept; failures aren't cached, so that a transient
+// resolver error doesn't lock a partner out until the TTL expires.
+type PTRSuffixACL struct {
+	suffixes   []string
+	ttl        time.Duration
+	lock       *sync.Mutex
+	cache      map[string]ptrEntry
+	lookupAddr func(context.Context, string) ([]string, error)
+	lookupHost func(context.Context, string) ([]string, error)
+}
+
+// NewPTRSuffixACL returns a new PTRSuffixACL permitting addresses
+// with a verified hostname in one of the domains in suffixes, such
+// as "trusted-partner.com" (a leading "*." or "." is ignored). A
+// domain matches itself and any name beneath it. Decisions are
+// cached for ttl; if it is not positive, DefaultReverseCacheTTL is
+// used.
+func NewPTRSuffixACL(suffixes []string, ttl time.Duration) (*PTRSuffixACL, error) {
+	var normalized []string
+	for _, s := range suffixes {
+		s = strings.TrimPrefix(s, "*")
+		s = strings.ToLower(strings.Trim(s, "."))
+		if s != "" {
+			normalized = append(normalized, s)
+		}
+	}
+
+	if len(normalized) == 0 {
+		return nil, errors.New("whitelist: no domain suffixes given")
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultReverseCacheTTL
+	}
+
+	return &PTRSuffixACL{
+		suffixes:   normalized,
+		ttl:        ttl,
+		lock:       new(sync.Mutex),
+		cache:      map[string]ptrEntry{},
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		lookupHost: net.DefaultResolver.LookupHost,
+	}, nil
+}
+
+// matches returns true if host is one of the domains, or beneath
+// one.
+func (wl *PTRSuffixACL) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, s := range wl.suffixes {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// notFound returns true if err is a DNS lookup failure because the
+// name doesn't exist, which is a denial rather than a failure.
+func notFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
+
+// confirmed returns true if host resolves to ip.
+func (wl *PTRSuffixACL) confirmed(ctx context.Context, host string, ip net.IP) (bool, error) {
+	addrs, err := wl.lookupHost(ctx, host)
+	if err != nil {
+		if notFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, addr := range addrs {
+		if ip.Equal(net.ParseIP(addr)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verify looks up the names of ip, allowing it if one of them is
+// under a configured domain and resolves back to ip. If no name can
+// be confirmed because a lookup failed, the decision is
+// Indeterminate.
+func (wl *PTRSuffixACL) verify(ip net.IP) (Decision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReverseTimeout)
+	defer cancel()
+
+	names, err := wl.lookupAddr(ctx, ip.String())
+	if err != nil {
+		if notFound(err) {
+			return Deny, nil
+		}
+		return Indeterminate, err
+	}
+
+	var lookupErr error
+	for _, name := range names {
+		if !wl.matches(name) {
+			continue
+		}
+
+		ok, err := wl.confirmed(ctx, name, ip)
+		if ok {
+			return Allow, nil
+		}
+
+		if err != nil {
+			lookupErr = err
+		}
+	}
+
+	if lookupErr != nil {
+		return Indeterminate, lookupErr
+	}
+	return Deny, nil
+}
+
+// cached returns the cached decision for addr, if any.
+func (wl *PTRSuffixACL) cached(addr string) (ptrEntry, bool) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	ent, ok := wl.cache[addr]
+	if !ok || time.Now().After(ent.expires) {
+		return ptrEntry{}, false
+	}
+	return ent, true
+}
+
+func (wl *PTRSuffixACL) store(addr string, d Decision) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	if _, ok := wl.cache[addr]; !ok && len(wl.cache) >= DefaultReverseCacheSize {
+		for k := range wl.cache {
+			delete(wl.cache, k)
+			break
+		}
+	}
+
+	wl.cache[addr] = ptrEntry{
+		decision: d,
+		expires:  time.Now().Add(wl.ttl),
+	}
+}
+
+// Permitted returns true if the IP has a forward-confirmed reverse
+// DNS name under one of the configured domains. Invalid addresses,
+// and addresses whose names couldn't be looked up, are denied.
+func (wl *PTRSuffixACL) Permitted(ip net.IP) bool {
+	d, _ := wl.PermittedDetailed(ip)
+	return d == Allow
+}
+
+// PermittedDetailed returns Allow if the IP has a forward-confirmed
+// reverse DNS name under one of the configured domains, Deny if it
+// doesn't, and Indeterminate if a lookup failed for a reason other
+// than the name not existing. Indeterminate decisions aren't cached,
+// so the lookup is retried on the next check.
+func (wl *PTRSuffixACL) PermittedDetailed(ip net.IP) (Decision, error) {
+	if !validIP(ip) {
+		return Indeterminate, errInvalidIP
+	}
+
+	addr := ip.String()
+	if ent, ok := wl.cached(addr); ok {
+		return ent.decision, nil
+	}
+
+	d, err := wl.verify(ip)
+	if err != nil {
+		return d, err
+	}
+
+	wl.store(addr, d)
+	return d, nil
+}
@@ -0,0 +1,109 @@
+package whitelist
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPTRSuffixACL(t *testing.T) {
+	if _, err := NewPTRSuffixACL([]string{"", "."}, 0); err == nil {
+		t.Fatal("Expected a PTRSuffixACL without suffixes to fail")
+	}
+
+	wl, err := NewPTRSuffixACL([]string{"*.Trusted-Partner.com."}, time.Hour)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ptr := map[string][]string{
+		"192.168.3.1": {"a.trusted-partner.com."},
+		"192.168.3.2": {"spoofed.trusted-partner.com."},
+		"192.168.3.3": {"eviltrusted-partner.com."},
+		"192.168.3.4": {"other.example.com.", "B.TRUSTED-PARTNER.COM."},
+		"2001:db8::1": {"v6.trusted-partner.com."},
+	}
+
+	hosts := map[string][]string{
+		"a.trusted-partner.com":       {"192.168.3.1"},
+		"spoofed.trusted-partner.com": {"192.168.3.99"},
+		"eviltrusted-partner.com":     {"192.168.3.3"},
+		"B.TRUSTED-PARTNER.COM":       {"192.168.3.4"},
+		"v6.trusted-partner.com":      {"2001:db8::1"},
+	}
+
+	lookups := 0
+	wl.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if names, ok := ptr[addr]; ok {
+			return names, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	wl.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if addrs, ok := hosts[strings.TrimSuffix(host, ".")]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	tv := map[string]bool{
+		"192.168.3.1": true,
+		"192.168.3.2": false,
+		"192.168.3.3": false,
+		"192.168.3.4": true,
+		"192.168.3.5": false,
+		"2001:db8::1": true,
+	}
+
+	for addr, permitted := range tv {
+		if wl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	// Both permitted and denied decisions are cached.
+	for addr, permitted := range tv {
+		if wl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if lookups != len(tv) {
+		t.Fatalf("Expected %d lookups, have %d", len(tv), lookups)
+	}
+
+	if wl.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+}
+
+func TestPTRSuffixACLExpiry(t *testing.T) {
+	wl, err := NewPTRSuffixACL([]string{"example.com"}, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	lookups := 0
+	wl.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		return []string{"example.com."}, nil
+	}
+	wl.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.168.3.1"}, nil
+	}
+
+	ip := net.IP{192, 168, 3, 1}
+	for i := 0; i < 2; i++ {
+		if !wl.Permitted(ip) {
+			t.Fatal("Expected the address to be permitted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if lookups != 2 {
+		t.Fatalf("Expected an expired decision to be looked up again, have %d lookups", lookups)
+	}
+}
@@ -0,0 +1,192 @@
+package whitelist
+
+// This file contains a set of address ranges supporting set
+// operations.
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+)
+
+// IPRangeSet is a set of addresses, stored as a sorted list of
+// disjoint, non-adjacent ranges. It is intended for building
+// whitelists from heterogeneous sources, such as address ranges,
+// networks, and single addresses, and supports union, intersection,
+// and subtraction with other sets. The minimal list of networks
+// covering the set is given by Prefixes.
+//
+// An IPRangeSet is an ACL; Permitted runs in time logarithmic in the
+// number of ranges. IPv4 addresses in their IPv4-mapped IPv6 form are
+// treated as IPv4 addresses.
+type IPRangeSet struct {
+	lock   *sync.Mutex
+	ranges []ipRange
+}
+
+// NewIPRangeSet returns a new, empty IPRangeSet.
+func NewIPRangeSet() *IPRangeSet {
+	return &IPRangeSet{lock: new(sync.Mutex)}
+}
+
+// rangeIP returns the IP in the form stored in an ipRange: 4 bytes
+// for IPv4 addresses, and 16 bytes otherwise.
+func rangeIP(ip net.IP) net.IP {
+	if !validIP(ip) {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// compareIP orders addresses with every IPv4 address before every
+// IPv6 address, matching the order produced by mergeRanges.
+func compareIP(a, b net.IP) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return bytes.Compare(a, b)
+}
+
+// AddRange adds the inclusive range of addresses from first to last.
+// An error is returned if either address is invalid, if they belong
+// to different address families, or if last precedes first.
+func (s *IPRangeSet) AddRange(first, last net.IP) error {
+	first, last = rangeIP(first), rangeIP(last)
+	if first == nil || last == nil {
+		return errors.New("whitelist: invalid IP address in range")
+	}
+
+	if len(first) != len(last) {
+		return errors.New("whitelist: range mixes IPv4 and IPv6 addresses")
+	}
+
+	if bytes.Compare(first, last) > 0 {
+		return errors.New("whitelist: range ends before it starts")
+	}
+
+	s.add([]ipRange{{first: first, last: last}})
+	return nil
+}
+
+// AddPrefix adds every address in the network. An error is returned
+// if the network is invalid.
+func (s *IPRangeSet) AddPrefix(n *net.IPNet) error {
+	r, ok := networkRange(n)
+	if !ok {
+		return errors.New("whitelist: invalid network")
+	}
+
+	if first := r.first.To4(); first != nil && len(r.first) == net.IPv6len {
+		r = ipRange{first: first, last: r.last.To4()}
+	}
+
+	s.add([]ipRange{r})
+	return nil
+}
+
+// AddIP adds a single address. An error is returned if the address
+// is invalid.
+func (s *IPRangeSet) AddIP(ip net.IP) error {
+	return s.AddRange(ip, ip)
+}
+
+// add merges the ranges into the set.
+func (s *IPRangeSet) add(ranges []ipRange) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ranges = mergeRanges(append(ranges, s.ranges...))
+}
+
+// snapshot returns the set's current ranges. The ranges are never
+// modified in place, so they may be read without holding the lock.
+func (s *IPRangeSet) snapshot() []ipRange {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ranges
+}
+
+// Union adds every address in other to the set.
+func (s *IPRangeSet) Union(other *IPRangeSet) {
+	ranges := other.snapshot()
+	s.add(append([]ipRange(nil), ranges...))
+}
+
+// Intersect removes every address that isn't also in other from the
+// set.
+func (s *IPRangeSet) Intersect(other *IPRangeSet) {
+	b := other.snapshot()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var out []ipRange
+	a := s.ranges
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case compareIP(a[i].last, b[j].first) < 0:
+			i++
+		case compareIP(b[j].last, a[i].first) < 0:
+			j++
+		default:
+			r := ipRange{first: a[i].first, last: a[i].last}
+			if compareIP(b[j].first, r.first) > 0 {
+				r.first = b[j].first
+			}
+
+			if compareIP(b[j].last, r.last) < 0 {
+				r.last = b[j].last
+				j++
+			} else {
+				i++
+			}
+			out = append(out, r)
+		}
+	}
+
+	s.ranges = out
+}
+
+// Subtract removes every address in other from the set.
+func (s *IPRangeSet) Subtract(other *IPRangeSet) {
+	b := other.snapshot()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var out []ipRange
+	for _, r := range s.ranges {
+		out = append(out, complementRanges(r, b)...)
+	}
+	s.ranges = out
+}
+
+// Prefixes returns the smallest list of networks covering exactly
+// the addresses in the set, with IPv4 networks first and each family
+// in ascending order.
+func (s *IPRangeSet) Prefixes() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, r := range s.snapshot() {
+		nets = append(nets, rangeNetworks(r)...)
+	}
+	return nets
+}
+
+// Permitted returns true if the IP is in the set.
+func (s *IPRangeSet) Permitted(ip net.IP) bool {
+	ip = rangeIP(ip)
+	if ip == nil {
+		return false
+	}
+
+	ranges := s.snapshot()
+	i := sort.Search(len(ranges), func(i int) bool {
+		return compareIP(ranges[i].last, ip) >= 0
+	})
+	return i < len(ranges) && compareIP(ranges[i].first, ip) <= 0
+}
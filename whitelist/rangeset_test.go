@@ -0,0 +1,132 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+var _ ACL = NewIPRangeSet()
+
+func testParseNet(ns string, t *testing.T) *net.IPNet {
+	_, n, err := net.ParseCIDR(ns)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return n
+}
+
+func prefixStrings(nets []*net.IPNet) []string {
+	out := make([]string, 0, len(nets))
+	for _, n := range nets {
+		out = append(out, n.String())
+	}
+	return out
+}
+
+func TestIPRangeSet(t *testing.T) {
+	s := NewIPRangeSet()
+	if err := s.AddRange(net.ParseIP("192.168.3.0"), net.ParseIP("192.168.3.127")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := s.AddPrefix(testParseNet("192.168.3.128/25", t)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := s.AddIP(net.ParseIP("::ffff:10.0.0.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := s.AddPrefix(testParseNet("2001:db8::/32", t)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{"10.0.0.1/32", "192.168.3.0/24", "2001:db8::/32"}
+	if nets := prefixStrings(s.Prefixes()); !equalStrings(nets, expected) {
+		t.Fatalf("Expected %v, but have %v", expected, nets)
+	}
+
+	tv := map[string]bool{
+		"10.0.0.1":        true,
+		"10.0.0.2":        false,
+		"192.168.2.255":   false,
+		"192.168.3.0":     true,
+		"192.168.3.200":   true,
+		"192.168.4.0":     false,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::ffff:10.0.0.1": true,
+	}
+
+	for addr, permitted := range tv {
+		if s.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if s.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+
+	other := NewIPRangeSet()
+	other.AddRange(net.ParseIP("192.168.3.64"), net.ParseIP("192.168.4.255"))
+	other.AddPrefix(testParseNet("2001:db8:1::/48", t))
+
+	union := NewIPRangeSet()
+	union.Union(s)
+	union.Union(other)
+	expected = []string{"10.0.0.1/32", "192.168.3.0/24", "192.168.4.0/24", "2001:db8::/32"}
+	if nets := prefixStrings(union.Prefixes()); !equalStrings(nets, expected) {
+		t.Fatalf("Expected union %v, but have %v", expected, nets)
+	}
+
+	inter := NewIPRangeSet()
+	inter.Union(s)
+	inter.Intersect(other)
+	expected = []string{"192.168.3.64/26", "192.168.3.128/25", "2001:db8:1::/48"}
+	if nets := prefixStrings(inter.Prefixes()); !equalStrings(nets, expected) {
+		t.Fatalf("Expected intersection %v, but have %v", expected, nets)
+	}
+
+	s.Subtract(other)
+	expected = []string{"10.0.0.1/32", "192.168.3.0/26", "2001:db8::/48", "2001:db8:2::/47",
+		"2001:db8:4::/46", "2001:db8:8::/45", "2001:db8:10::/44", "2001:db8:20::/43",
+		"2001:db8:40::/42", "2001:db8:80::/41", "2001:db8:100::/40", "2001:db8:200::/39",
+		"2001:db8:400::/38", "2001:db8:800::/37", "2001:db8:1000::/36", "2001:db8:2000::/35",
+		"2001:db8:4000::/34", "2001:db8:8000::/33"}
+	if nets := prefixStrings(s.Prefixes()); !equalStrings(nets, expected) {
+		t.Fatalf("Expected difference %v, but have %v", expected, nets)
+	}
+
+	// Subtracting a set from itself empties it.
+	union.Subtract(union)
+	if nets := union.Prefixes(); len(nets) != 0 {
+		t.Fatalf("Expected an empty set, but have %v", nets)
+	}
+}
+
+func TestIPRangeSetInvalid(t *testing.T) {
+	s := NewIPRangeSet()
+	if err := s.AddRange(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")); err == nil {
+		t.Fatal("Expected a reversed range to be rejected")
+	}
+
+	if err := s.AddRange(net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")); err == nil {
+		t.Fatal("Expected a mixed range to be rejected")
+	}
+
+	if err := s.AddIP(nil); err == nil {
+		t.Fatal("Expected an invalid address to be rejected")
+	}
+
+	if err := s.AddPrefix(&net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.IPMask{255, 0, 255, 0}}); err == nil {
+		t.Fatal("Expected an invalid network to be rejected")
+	}
+
+	// The whole IPv4 address space is aggregated to a single network.
+	s.AddRange(net.ParseIP("0.0.0.0"), net.ParseIP("127.255.255.255"))
+	s.AddRange(net.ParseIP("128.0.0.0"), net.ParseIP("255.255.255.255"))
+	if nets := prefixStrings(s.Prefixes()); !equalStrings(nets, []string{"0.0.0.0/0"}) {
+		t.Fatalf("Unexpected networks %v", nets)
+	}
+}
@@ -0,0 +1,100 @@
+package whitelist
+
+// This file contains a fixed-size record of recent whitelisting
+// decisions.
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRecentSize is the number of decisions kept by a
+// RecentDecisions constructed with a non-positive size.
+const DefaultRecentSize = 256
+
+// A RecentDecision is a single entry in a RecentDecisions. The IP
+// address is passed through the anonymizer, if one has been
+// registered with SetAnonymizer.
+type RecentDecision struct {
+	Time     time.Time `json:"time"`
+	IP       string    `json:"ip"`
+	Path     string    `json:"path"`
+	Decision string    `json:"decision"`
+}
+
+// RecentDecisions keeps the most recent whitelisting decisions in a
+// ring buffer of fixed size, for a live view of why clients are
+// being denied, such as on a debug endpoint. Once the buffer is
+// full, each new decision overwrites the oldest.
+type RecentDecisions struct {
+	lock    *sync.Mutex
+	entries []RecentDecision
+	next    int
+	full    bool
+}
+
+// NewRecentDecisions returns a new RecentDecisions keeping up to
+// size decisions. If size is not positive, DefaultRecentSize is
+// used.
+func NewRecentDecisions(size int) *RecentDecisions {
+	if size <= 0 {
+		size = DefaultRecentSize
+	}
+
+	return &RecentDecisions{
+		lock:    new(sync.Mutex),
+		entries: make([]RecentDecision, size),
+	}
+}
+
+// Record adds the decision for a request from ip.
+func (rd *RecentDecisions) Record(req *http.Request, ip net.IP, permitted bool) {
+	d := RecentDecision{
+		Time:     time.Now(),
+		IP:       logIP(ip),
+		Decision: DecisionDenied,
+	}
+
+	if permitted {
+		d.Decision = DecisionPermitted
+	}
+
+	if req != nil && req.URL != nil {
+		d.Path = req.URL.Path
+	}
+
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	rd.entries[rd.next] = d
+	rd.next++
+	if rd.next == len(rd.entries) {
+		rd.next = 0
+		rd.full = true
+	}
+}
+
+// Snapshot returns a copy of the recorded decisions, oldest first.
+func (rd *RecentDecisions) Snapshot() []RecentDecision {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	if !rd.full {
+		return append([]RecentDecision(nil), rd.entries[:rd.next]...)
+	}
+
+	snapshot := make([]RecentDecision, 0, len(rd.entries))
+	snapshot = append(snapshot, rd.entries[rd.next:]...)
+	return append(snapshot, rd.entries[:rd.next]...)
+}
+
+// Reset discards every recorded decision.
+func (rd *RecentDecisions) Reset() {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	for i := range rd.entries {
+		rd.entries[i] = RecentDecision{}
+	}
+	rd.next, rd.full = 0, false
+}
@@ -0,0 +1,75 @@
+package whitelist
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecentDecisions(t *testing.T) {
+	rd := NewRecentDecisions(3)
+	if len(rd.Snapshot()) != 0 {
+		t.Fatal("Expected no decisions to have been recorded")
+	}
+
+	for i, path := range []string{"/a", "/b"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rd.Record(req, net.IP{192, 168, 3, byte(i)}, i == 0)
+	}
+
+	recent := rd.Snapshot()
+	if len(recent) != 2 || recent[0].Path != "/a" || recent[1].Path != "/b" {
+		t.Fatalf("Unexpected decisions %+v", recent)
+	}
+
+	if recent[0].Decision != DecisionPermitted || recent[1].Decision != DecisionDenied {
+		t.Fatalf("Unexpected decisions %+v", recent)
+	}
+
+	if recent[1].IP != "192.168.3.1" || recent[1].Time.IsZero() {
+		t.Fatalf("Unexpected decision %+v", recent[1])
+	}
+
+	for _, path := range []string{"/c", "/d"} {
+		rd.Record(httptest.NewRequest("GET", path, nil), net.IP{192, 168, 3, 1}, false)
+	}
+
+	recent = rd.Snapshot()
+	if len(recent) != 3 || recent[0].Path != "/b" || recent[2].Path != "/d" {
+		t.Fatalf("Expected the oldest decision to be overwritten, have %+v", recent)
+	}
+
+	rd.Reset()
+	if len(rd.Snapshot()) != 0 {
+		t.Fatal("Expected no decisions after a reset")
+	}
+}
+
+func TestRecentDecisionsHandler(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.Recent = NewRecentDecisions(0)
+
+	for _, addr := range []string{"127.0.0.1", "192.168.3.1"} {
+		req := httptest.NewRequest("GET", "/debug", nil)
+		req.RemoteAddr = addr + ":4141"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recent := h.Recent.Snapshot()
+	if len(recent) != 2 {
+		t.Fatalf("Expected 2 decisions, have %d", len(recent))
+	}
+
+	if recent[0].IP != "127.0.0.1" || recent[0].Decision != DecisionPermitted {
+		t.Fatalf("Unexpected decision %+v", recent[0])
+	}
+
+	if recent[1].IP != "192.168.3.1" || recent[1].Decision != DecisionDenied || recent[1].Path != "/debug" {
+		t.Fatalf("Unexpected decision %+v", recent[1])
+	}
+}
@@ -0,0 +1,230 @@
+package whitelist
+
+// This file contains an ACL that is periodically fetched from a URL.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRemoteInterval is the refresh interval used by a RemoteACL
+// constructed with a non-positive interval.
+const DefaultRemoteInterval = 5 * time.Minute
+
+// A RemoteACL is an ACL that is fetched from a URL, such as a
+// central configuration service, and refreshed periodically. The
+// document may be either a list of entries, one per line, with blank
+// lines and comments beginning with '#' skipped, or a JSON array of
+// entry strings. Each entry is a host or network, as accepted by
+// NewFromStrings.
+//
+// Refreshes are conditional on the ETag and Last-Modified headers
+// of the previous response, so that an unchanged whitelist isn't
+// downloaded again. If a refresh fails, the error is logged and the
+// last good whitelist stays in effect.
+//
+// The refresh runs in a background goroutine, which must be stopped
+// with Close when the RemoteACL is no longer needed.
+type RemoteACL struct {
+	url      string
+	client   *http.Client
+	lock     *sync.Mutex
+	acl      ACL
+	etag     string
+	modified string
+	updated  time.Time
+	errors   uint64
+	exited   chan struct{}
+
+	// ctx is cancelled by Stop, which ends the refresh loop and
+	// abandons any fetch in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRemoteACL fetches the whitelist at url and returns a RemoteACL
+// that refreshes it every interval until Stop is called. If interval
+// is not positive, DefaultRemoteInterval is used. An error is
+// returned if the initial fetch fails, as there is no whitelist to
+// fall back to.
+func NewRemoteACL(url string, interval time.Duration) (*RemoteACL, error) {
+	if interval <= 0 {
+		interval = DefaultRemoteInterval
+	}
+
+	wl := &RemoteACL{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+		lock:   new(sync.Mutex),
+		exited: make(chan struct{}),
+	}
+	wl.ctx, wl.cancel = context.WithCancel(context.Background())
+
+	if err := wl.Refresh(); err != nil {
+		return nil, err
+	}
+
+	go wl.refresh(interval)
+	return wl, nil
+}
+
+func (wl *RemoteACL) refresh(interval time.Duration) {
+	defer close(wl.exited)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wl.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := wl.Refresh(); err != nil && wl.ctx.Err() == nil {
+				log.Printf("whitelist: failed to refresh %s, keeping the previous whitelist: %v", wl.url, err)
+			}
+		}
+	}
+}
+
+// Refresh fetches the whitelist immediately, replacing the current
+// whitelist if the fetch succeeds and the whitelist has changed. Once
+// the RemoteACL has been stopped, Refresh fails, and a fetch that is
+// in progress is abandoned.
+func (wl *RemoteACL) Refresh() error {
+	err := wl.fetch()
+	if err != nil && wl.ctx.Err() == nil {
+		wl.lock.Lock()
+		wl.errors++
+		wl.lock.Unlock()
+	}
+	return err
+}
+
+// fetch performs a single conditional fetch of the whitelist.
+func (wl *RemoteACL) fetch() error {
+	req, err := http.NewRequest("GET", wl.url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(wl.ctx)
+
+	wl.lock.Lock()
+	if wl.etag != "" {
+		req.Header.Set("If-None-Match", wl.etag)
+	}
+	if wl.modified != "" {
+		req.Header.Set("If-Modified-Since", wl.modified)
+	}
+	wl.lock.Unlock()
+
+	resp, err := wl.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("whitelist: fetching %s: %s", wl.url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseRemote(body)
+	if err != nil {
+		return err
+	}
+
+	acl, err := NewFromStrings(entries)
+	if err != nil {
+		return err
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.acl = acl
+	wl.updated = time.Now()
+	wl.etag = resp.Header.Get("ETag")
+	wl.modified = resp.Header.Get("Last-Modified")
+	return nil
+}
+
+// parseRemote returns the entries in a fetched whitelist.
+func parseRemote(body []byte) ([]string, error) {
+	var entries []string
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			entry, _ := splitComment(line)
+			if entry == "" {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("whitelist: fetched whitelist is empty")
+	}
+	return entries, nil
+}
+
+// Permitted returns true if the IP is permitted by the most recently
+// fetched whitelist.
+func (wl *RemoteACL) Permitted(ip net.IP) bool {
+	wl.lock.Lock()
+	acl := wl.acl
+	wl.lock.Unlock()
+	return acl.Permitted(ip)
+}
+
+// Stats returns the number of entries in the most recently fetched
+// whitelist, the time it was fetched, and the number of failed
+// refreshes.
+func (wl *RemoteACL) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	stats := aclStats(wl.acl)
+	stats.Modified = wl.updated
+	stats.ReloadErrors = wl.errors
+	return stats
+}
+
+// Stop stops the periodic refresh, abandoning any fetch in progress,
+// without waiting for the background goroutine to exit. The last
+// fetched whitelist stays in effect.
+func (wl *RemoteACL) Stop() {
+	wl.cancel()
+}
+
+// Close stops the periodic refresh and waits for the background
+// goroutine to exit. A fetch in progress is abandoned rather than
+// waited for. Callers must call Close (or Stop) once the
+// RemoteACL is no longer needed, such as when it is replaced on
+// reconfiguration, or the goroutine and its ticker are leaked. The
+// last fetched whitelist stays in effect. It implements io.Closer,
+// and always returns nil.
+func (wl *RemoteACL) Close() error {
+	wl.Stop()
+	<-wl.exited
+	return nil
+}
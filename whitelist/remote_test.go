@@ -0,0 +1,209 @@
+package whitelist
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type remoteServer struct {
+	lock        sync.Mutex
+	body        string
+	etag        string
+	fail        bool
+	fetches     int
+	notModified int
+}
+
+func (s *remoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	s.fetches++
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.body))
+}
+
+func (s *remoteServer) set(body, etag string, fail bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.body, s.etag, s.fail = body, etag, fail
+}
+
+func TestRemoteACL(t *testing.T) {
+	rs := &remoteServer{}
+	rs.set("# office\n192.168.3.1 # front desk\n\n10.0.0.0/8#lab\n", `"v1"`, false)
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	wl, err := NewRemoteACL(srv.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer wl.Stop()
+
+	if !wl.Permitted(net.ParseIP("192.168.3.1")) || !wl.Permitted(net.ParseIP("10.1.2.3")) {
+		t.Fatal("Expected the fetched entries to be permitted")
+	}
+
+	if err = wl.Refresh(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	rs.lock.Lock()
+	fetches, notModified := rs.fetches, rs.notModified
+	rs.lock.Unlock()
+	if fetches != 1 || notModified != 1 {
+		t.Fatalf("Expected a conditional refresh, have %d fetches and %d not modified", fetches, notModified)
+	}
+
+	rs.set(`["192.168.3.2", "2001:db8::/32"]`, `"v2"`, false)
+	if err = wl.Refresh(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if wl.Permitted(net.ParseIP("192.168.3.1")) || !wl.Permitted(net.ParseIP("192.168.3.2")) {
+		t.Fatal("Expected the whitelist to be replaced")
+	}
+
+	rs.set("", `"v3"`, true)
+	if err = wl.Refresh(); err == nil {
+		t.Fatal("Expected the refresh to fail")
+	}
+
+	rs.set("not an address", `"v4"`, false)
+	if err = wl.Refresh(); err == nil {
+		t.Fatal("Expected an invalid whitelist to be rejected")
+	}
+
+	for i, body := range []string{"[]", " [ ] ", "# nothing\n\n"} {
+		rs.set(body, fmt.Sprintf(`"v5-%d"`, i), false)
+		if err = wl.Refresh(); err == nil {
+			t.Fatalf("Expected an empty whitelist %q to be rejected", body)
+		}
+	}
+
+	if !wl.Permitted(net.ParseIP("2001:db8::1")) {
+		t.Fatal("Expected the last good whitelist to be kept")
+	}
+
+	stats := wl.Stats()
+	if stats.Entries != 2 || stats.ReloadErrors != 5 || stats.Modified.IsZero() {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+
+	wl.Stop()
+	wl.Stop()
+}
+
+func TestRemoteACLInitialFailure(t *testing.T) {
+	rs := &remoteServer{}
+	rs.set("", "", true)
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	if _, err := NewRemoteACL(srv.URL, 0); err == nil {
+		t.Fatal("Expected the initial fetch to fail")
+	}
+}
+
+func TestRemoteACLClose(t *testing.T) {
+	rs := &remoteServer{}
+	rs.set("127.0.0.1\n", `"v1"`, false)
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	wl, err := NewRemoteACL(srv.URL, time.Millisecond)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var _ io.Closer = wl
+	if err = wl.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	select {
+	case <-wl.exited:
+	default:
+		t.Fatal("Expected the refresh goroutine to have exited")
+	}
+
+	// Closing again, or after Stop, is harmless.
+	wl.Stop()
+	if err = wl.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !wl.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected the last whitelist to stay in effect")
+	}
+}
+
+func TestRemoteACLCloseDuringFetch(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := false
+		once.Do(func() { first = true })
+		if !first {
+			// Hang every refresh until the test is over.
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return
+		}
+		w.Write([]byte("127.0.0.1\n"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	wl, err := NewRemoteACL(srv.URL, time.Millisecond)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		wl.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the fetch in progress")
+	}
+
+	if stats := wl.Stats(); stats.ReloadErrors != 0 {
+		t.Fatalf("Expected an abandoned fetch not to count as an error, have %d", stats.ReloadErrors)
+	}
+
+	if err = wl.Refresh(); err == nil {
+		t.Fatal("Expected Refresh to fail once the RemoteACL is closed")
+	}
+
+	if !wl.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected the last whitelist to stay in effect")
+	}
+}
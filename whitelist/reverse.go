@@ -0,0 +1,153 @@
+package whitelist
+
+// This file contains support for logging the hostnames of denied
+// addresses.
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for a ReverseLookup constructed with non-positive values.
+const (
+	DefaultReverseTimeout   = 500 * time.Millisecond
+	DefaultReverseCacheSize = 1024
+	DefaultReverseCacheTTL  = 10 * time.Minute
+)
+
+// reverseConcurrency bounds the number of reverse lookups that may
+// be in flight at once; denials beyond this are logged without a
+// hostname rather than queued.
+const reverseConcurrency = 16
+
+type reverseEntry struct {
+	host    string
+	expires time.Time
+}
+
+// A ReverseLookup logs denied addresses along with their hostnames,
+// as found by a reverse DNS lookup. Lookups happen in the background
+// and never delay the response: the log line is written once the
+// lookup finishes or times out. Results (including failures) are
+// cached, and the number of concurrent lookups is bounded, so that a
+// flood of denied requests can't be used to generate unbounded DNS
+// traffic.
+type ReverseLookup struct {
+	timeout time.Duration
+	size    int
+	lock    *sync.Mutex
+	cache   map[string]reverseEntry
+	sem     chan struct{}
+	lookup  func(context.Context, string) ([]string, error)
+}
+
+// NewReverseLookup returns a new ReverseLookup. Each lookup is
+// abandoned after timeout, and up to size results are cached. If
+// either is not positive, the package default is used.
+func NewReverseLookup(timeout time.Duration, size int) *ReverseLookup {
+	if timeout <= 0 {
+		timeout = DefaultReverseTimeout
+	}
+
+	if size <= 0 {
+		size = DefaultReverseCacheSize
+	}
+
+	return &ReverseLookup{
+		timeout: timeout,
+		size:    size,
+		lock:    new(sync.Mutex),
+		cache:   map[string]reverseEntry{},
+		sem:     make(chan struct{}, reverseConcurrency),
+		lookup:  net.DefaultResolver.LookupAddr,
+	}
+}
+
+// cached returns the cached hostname for addr, if any.
+func (rl *ReverseLookup) cached(addr string) (string, bool) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	ent, ok := rl.cache[addr]
+	if !ok || time.Now().After(ent.expires) {
+		return "", false
+	}
+	return ent.host, true
+}
+
+func (rl *ReverseLookup) store(addr, host string) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if _, ok := rl.cache[addr]; !ok && len(rl.cache) >= rl.size {
+		for k := range rl.cache {
+			delete(rl.cache, k)
+			break
+		}
+	}
+
+	rl.cache[addr] = reverseEntry{
+		host:    host,
+		expires: time.Now().Add(DefaultReverseCacheTTL),
+	}
+}
+
+// resolve performs a bounded reverse lookup of addr and caches the
+// result. An empty string is returned if no hostname was found.
+func (rl *ReverseLookup) resolve(addr string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+
+	var host string
+	names, err := rl.lookup(ctx, addr)
+	if err == nil && len(names) > 0 {
+		host = strings.TrimSuffix(names[0], ".")
+	}
+
+	rl.store(addr, host)
+	return host
+}
+
+func logDenied(ip net.IP, host string) {
+	addr := logIP(ip)
+	if host == "" {
+		log.Printf("whitelist: denied request from %s", addr)
+	} else {
+		log.Printf("whitelist: denied request from %s (%s)", addr, host)
+	}
+}
+
+// LogDenied logs that ip was denied, including its hostname if one
+// can be found. It returns immediately; if the hostname isn't
+// cached, the line is logged once the lookup completes. If an
+// anonymizer has been registered, no lookup is made and the hostname
+// is left out, as it identifies the client as clearly as its address.
+func (rl *ReverseLookup) LogDenied(ip net.IP) {
+	if anonymizing() {
+		logDenied(ip, "")
+		return
+	}
+
+	addr := ip.String()
+	if host, ok := rl.cached(addr); ok {
+		logDenied(ip, host)
+		return
+	}
+
+	select {
+	case rl.sem <- struct{}{}:
+	default:
+		// Too many lookups are already in flight.
+		logDenied(ip, "")
+		return
+	}
+
+	go func() {
+		defer func() { <-rl.sem }()
+		logDenied(ip, rl.resolve(addr))
+	}()
+}
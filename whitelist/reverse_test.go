@@ -0,0 +1,143 @@
+package whitelist
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	n, err := b.buf.Write(p)
+	b.done <- struct{}{}
+	return n, err
+}
+
+func TestReverseLookup(t *testing.T) {
+	out := &syncBuffer{done: make(chan struct{}, 4)}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	lookups := 0
+	rl := NewReverseLookup(0, 1)
+	rl.lookup = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if addr == "127.0.0.1" {
+			return []string{"localhost."}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	wl := NewBasic()
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.ReverseLookup = rl
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:4141"
+	for i := 0; i < 2; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		select {
+		case <-out.done:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the denial to be logged")
+		}
+	}
+
+	if !strings.Contains(out.buf.String(), "127.0.0.1 (localhost)") {
+		t.Fatalf("Expected hostname in log, but have %s", out.buf.String())
+	}
+
+	if lookups != 1 {
+		t.Fatalf("Expected a single lookup, but have %d", lookups)
+	}
+
+	rl.LogDenied(net.ParseIP("192.168.3.1"))
+	<-out.done
+	if host, ok := rl.cached("192.168.3.1"); !ok || host != "" {
+		t.Fatal("Expected failed lookup to be cached")
+	}
+
+	if len(rl.cache) != 1 {
+		t.Fatalf("Expected cache to be bounded to 1 entry, but have %d", len(rl.cache))
+	}
+}
+
+func TestReverseLookupBounded(t *testing.T) {
+	out := &syncBuffer{done: make(chan struct{}, reverseConcurrency+1)}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	block := make(chan struct{})
+	rl := NewReverseLookup(time.Second, 0)
+	rl.lookup = func(ctx context.Context, addr string) ([]string, error) {
+		<-block
+		return nil, errors.New("no such host")
+	}
+
+	for i := 0; i < reverseConcurrency; i++ {
+		rl.LogDenied(net.IP{10, 0, 0, byte(i)})
+	}
+
+	// All lookup slots are taken, so this must be logged at once.
+	rl.LogDenied(net.IP{10, 0, 1, 1})
+	select {
+	case <-out.done:
+	case <-time.After(time.Second):
+		t.Fatal("LogDenied blocked with all lookups in flight")
+	}
+
+	close(block)
+	for i := 0; i < reverseConcurrency; i++ {
+		<-out.done
+	}
+
+	w := httptest.NewRecorder()
+	h, err := NewHandlerFunc(testAllowHandlerFunc, nil, NewBasic())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.ReverseLookup = rl
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:4141"
+	if h.ServeHTTP(w, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expect HTTP 401, but got HTTP %d", w.Code)
+	}
+	<-out.done
+}
+
+func TestReverseLookupAnonymized(t *testing.T) {
+	out := &syncBuffer{done: make(chan struct{}, 1)}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	SetAnonymizer(AnonymizeIP)
+	defer SetAnonymizer(nil)
+
+	rl := NewReverseLookup(0, 0)
+	rl.lookup = func(ctx context.Context, addr string) ([]string, error) {
+		t.Error("Expected no lookup while anonymizing")
+		return []string{"localhost."}, nil
+	}
+
+	rl.LogDenied(net.IP{127, 0, 0, 1})
+	<-out.done
+	if s := out.buf.String(); strings.Contains(s, "localhost") || !strings.Contains(s, "127.0.0.0") {
+		t.Fatalf("Expected only the anonymized address in the log, but have %s", s)
+	}
+}
@@ -0,0 +1,120 @@
+package whitelist
+
+// This file contains a handler that routes requests by client
+// network.
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+type route struct {
+	network *net.IPNet
+	ones    int
+	handler http.Handler
+}
+
+// RoutingHandler dispatches each request to the handler for the most
+// specific (longest-prefix) network containing the client's address,
+// or to a default handler if no network does; for example, internal
+// clients can be routed to an admin backend and everyone else to
+// the public one.
+type RoutingHandler struct {
+	lock     *sync.Mutex
+	routes   []route
+	fallback http.Handler
+}
+
+// NewRoutingHandler returns a new RoutingHandler with no routes,
+// which passes requests to fallback. If fallback is nil, requests
+// that don't match a route are refused with a 401.
+func NewRoutingHandler(fallback http.Handler) *RoutingHandler {
+	return &RoutingHandler{
+		lock:     new(sync.Mutex),
+		fallback: fallback,
+	}
+}
+
+// Route sends requests from clients in the network to the handler,
+// replacing any handler previously routed for the same network.
+func (rh *RoutingHandler) Route(n *net.IPNet, h http.Handler) error {
+	if _, ok := networkRange(n); !ok {
+		return errors.New("whitelist: invalid network")
+	}
+
+	if h == nil {
+		return errors.New("whitelist: handler cannot be nil")
+	}
+
+	ones, _ := n.Mask.Size()
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	for i := range rh.routes {
+		if netKey(rh.routes[i].network) == netKey(n) {
+			rh.routes[i].handler = h
+			return nil
+		}
+	}
+
+	rh.routes = append(rh.routes, route{network: n, ones: ones, handler: h})
+	return nil
+}
+
+// Unroute removes the route for the network, if any.
+func (rh *RoutingHandler) Unroute(n *net.IPNet) {
+	if n == nil {
+		return
+	}
+
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	for i := range rh.routes {
+		if netKey(rh.routes[i].network) == netKey(n) {
+			rh.routes = append(rh.routes[:i], rh.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// handler returns the handler for ip, or nil if no route matches.
+func (rh *RoutingHandler) handler(ip net.IP) http.Handler {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	var best http.Handler
+	bestOnes := -1
+	for _, r := range rh.routes {
+		if r.ones > bestOnes && r.network.Contains(ip) {
+			best, bestOnes = r.handler, r.ones
+		}
+	}
+	return best
+}
+
+// ServeHTTP dispatches the request to the handler for the client's
+// network.
+func (rh *RoutingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ip, err := HTTPRequestLookup(req)
+	if err != nil {
+		log.Printf("failed to lookup request address: %v", logError(err))
+		status := http.StatusInternalServerError
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	h := rh.handler(ip)
+	if h == nil {
+		h = rh.fallback
+	}
+
+	if h == nil {
+		status := http.StatusUnauthorized
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	h.ServeHTTP(w, req)
+}
@@ -0,0 +1,64 @@
+package whitelist
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutingHandler(t *testing.T) {
+	rh := NewRoutingHandler(newTestHandler("public"))
+	_, n8, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n16, _ := net.ParseCIDR("10.1.0.0/16")
+	_, n6, _ := net.ParseCIDR("2001:db8::/32")
+
+	for n, msg := range map[*net.IPNet]string{n16: "ops", n8: "internal", n6: "v6"} {
+		if err := rh.Route(n, newTestHandler(msg)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if err := rh.Route(nil, testAllowHandler); err == nil {
+		t.Fatal("Expected an invalid network to be rejected")
+	}
+
+	if err := rh.Route(n8, nil); err == nil {
+		t.Fatal("Expected a nil handler to be rejected")
+	}
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, req)
+		return w
+	}
+
+	tv := map[string]string{
+		"10.1.2.3:4141":      "ops",
+		"10.2.3.4:4141":      "internal",
+		"[2001:db8::1]:4141": "v6",
+		"192.168.3.1:4141":   "public",
+	}
+
+	for addr, expected := range tv {
+		if body := serve(addr).Body.String(); body != expected {
+			t.Fatalf("Expected %s for %s, but got %s", expected, addr, body)
+		}
+	}
+
+	rh.Unroute(n16)
+	if body := serve("10.1.2.3:4141").Body.String(); body != "internal" {
+		t.Fatalf("Expected internal after removing the route, but got %s", body)
+	}
+
+	if w := serve("10.1.2.3"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expect HTTP 500, but got HTTP %d", w.Code)
+	}
+
+	rh = NewRoutingHandler(nil)
+	if w := serve("192.168.3.1:4141"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expect HTTP 401, but got HTTP %d", w.Code)
+	}
+}
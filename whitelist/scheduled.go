@@ -0,0 +1,140 @@
+package whitelist
+
+// This file contains an ACL wrapper that restricts access to
+// scheduled time windows.
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Window is a daily period during which a ScheduledACL permits
+// access. Start and End are offsets from midnight, such as 9 *
+// time.Hour, and the window includes Start but not End. If End is
+// before Start, the window runs overnight into the following day. If
+// Days is empty, the window applies every day; otherwise, it only
+// applies to windows starting on the listed days.
+type Window struct {
+	Days  []time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+// onDay returns true if the window starts on the given day.
+func (w Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if the time, in the schedule's location,
+// falls within the window.
+func (w Window) contains(t time.Time) bool {
+	// Use the time on the clock, rather than the time elapsed
+	// since midnight, which differs on daylight saving changes.
+	hour, min, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+
+	if w.Start < w.End {
+		return w.onDay(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+
+	// An overnight window covers the end of the day it starts on
+	// and the beginning of the next.
+	if offset >= w.Start {
+		return w.onDay(t.Weekday())
+	}
+	return offset < w.End && w.onDay((t.Weekday()+6)%7)
+}
+
+// ScheduledACL wraps an ACL so that addresses are only permitted
+// during scheduled time windows, such as business hours: within a
+// window, the wrapped ACL decides, and outside every window, every
+// address is denied.
+type ScheduledACL struct {
+	lock    *sync.Mutex
+	acl     ACL
+	loc     *time.Location
+	windows []Window
+	now     func() time.Time
+}
+
+// NewScheduledACL wraps the ACL so that it only permits addresses
+// during one of the windows, with times of day and weekdays taken in
+// the location loc; if loc is nil, UTC is used. An error is returned
+// if there are no windows, or if a window's Start or End is outside
+// the day or they are equal.
+func NewScheduledACL(acl ACL, loc *time.Location, windows ...Window) (*ScheduledACL, error) {
+	if acl == nil {
+		return nil, errors.New("whitelist: ACL cannot be nil")
+	}
+
+	if len(windows) == 0 {
+		return nil, errors.New("whitelist: schedule has no windows")
+	}
+
+	for _, w := range windows {
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End > 24*time.Hour {
+			return nil, errors.New("whitelist: schedule window is outside the day")
+		}
+
+		if w.Start == w.End {
+			return nil, errors.New("whitelist: schedule window is empty")
+		}
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return &ScheduledACL{
+		lock:    new(sync.Mutex),
+		acl:     acl,
+		loc:     loc,
+		windows: windows,
+		now:     time.Now,
+	}, nil
+}
+
+// SetClock replaces the function used to get the current time, such
+// as with a fixed time in tests. Passing nil restores time.Now.
+func (wl *ScheduledACL) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.now = now
+}
+
+// Open returns true if the current time falls within a window.
+func (wl *ScheduledACL) Open() bool {
+	wl.lock.Lock()
+	now := wl.now
+	wl.lock.Unlock()
+
+	t := now().In(wl.loc)
+	for _, w := range wl.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permitted returns true if the current time falls within a window
+// and the wrapped ACL permits the IP.
+func (wl *ScheduledACL) Permitted(ip net.IP) bool {
+	return wl.Open() && wl.acl.Permitted(ip)
+}
@@ -0,0 +1,103 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestScheduledACL(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "192.168.3.1", t)
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	businessHours := Window{
+		Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+	}
+
+	// Saturday nights, running into Sunday morning.
+	maintenance := Window{
+		Days:  []time.Weekday{time.Saturday},
+		Start: 22 * time.Hour,
+		End:   2 * time.Hour,
+	}
+
+	acl, err := NewScheduledACL(wl, loc, businessHours, maintenance)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// 2026-10-12 is a Monday.
+	tv := map[string]bool{
+		"2026-10-12T09:00:00+02:00": true,
+		"2026-10-12T08:59:59+02:00": false,
+		"2026-10-12T16:59:59+02:00": true,
+		"2026-10-12T17:00:00+02:00": false,
+		"2026-10-12T07:30:00Z":      true,
+		"2026-10-12T15:30:00Z":      false,
+		"2026-10-17T12:00:00+02:00": false,
+		"2026-10-17T22:00:00+02:00": true,
+		"2026-10-18T01:59:00+02:00": true,
+		"2026-10-18T02:00:00+02:00": false,
+		"2026-10-18T22:30:00+02:00": false,
+		"2026-10-19T01:00:00+02:00": false,
+	}
+
+	for ts, open := range tv {
+		now, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		acl.SetClock(func() time.Time { return now })
+		if acl.Open() != open {
+			t.Fatalf("Expected Open at %s to be %v", ts, open)
+		}
+
+		if acl.Permitted(net.ParseIP("192.168.3.1")) != open {
+			t.Fatalf("Expected Permitted at %s to be %v", ts, open)
+		}
+
+		if acl.Permitted(net.ParseIP("192.168.3.2")) {
+			t.Fatalf("Expected a non-whitelisted address to be denied at %s", ts)
+		}
+	}
+
+	acl.SetClock(nil)
+	acl.Open()
+}
+
+func TestScheduledACLInvalid(t *testing.T) {
+	wl := NewBasic()
+	if _, err := NewScheduledACL(wl, nil); err == nil {
+		t.Fatal("Expected a schedule without windows to be rejected")
+	}
+
+	if _, err := NewScheduledACL(nil, nil, Window{Start: time.Hour, End: 2 * time.Hour}); err == nil {
+		t.Fatal("Expected a nil ACL to be rejected")
+	}
+
+	for _, w := range []Window{
+		{Start: time.Hour, End: time.Hour},
+		{Start: -time.Hour, End: time.Hour},
+		{Start: time.Hour, End: 25 * time.Hour},
+		{Start: 24 * time.Hour, End: time.Hour},
+	} {
+		if _, err := NewScheduledACL(wl, nil, w); err == nil {
+			t.Fatalf("Expected window %+v to be rejected", w)
+		}
+	}
+
+	// A window may run to the end of the day, and defaults to UTC.
+	acl, err := NewScheduledACL(wl, nil, Window{Start: 23 * time.Hour, End: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	acl.SetClock(func() time.Time { return time.Date(2026, 10, 16, 23, 59, 59, 0, time.UTC) })
+	if !acl.Open() {
+		t.Fatal("Expected the window to be open at the end of the day")
+	}
+}
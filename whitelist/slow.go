@@ -0,0 +1,63 @@
+package whitelist
+
+// This file contains an ACL wrapper that logs slow lookups.
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// DefaultSlowThreshold is the threshold used by a SlowLookup
+// constructed with a non-positive threshold.
+const DefaultSlowThreshold = time.Millisecond
+
+// SlowLookup wraps an ACL, timing each Permitted call and logging a
+// warning for any that takes longer than a threshold, along with the
+// number of entries in the wrapped ACL if it reports its Stats. A
+// lookup in a BasicNet takes time proportional to the number of
+// networks, so these warnings are a sign that the whitelist has
+// outgrown it, and that a TrieDenylist or a CachedNet should be
+// considered.
+type SlowLookup struct {
+	acl       ACL
+	threshold time.Duration
+}
+
+// NewSlowLookup wraps the ACL so that Permitted calls taking longer
+// than threshold are logged. If threshold is not positive,
+// DefaultSlowThreshold is used.
+func NewSlowLookup(acl ACL, threshold time.Duration) *SlowLookup {
+	if threshold <= 0 {
+		threshold = DefaultSlowThreshold
+	}
+
+	return &SlowLookup{
+		acl:       acl,
+		threshold: threshold,
+	}
+}
+
+// Permitted returns true if the wrapped ACL permits the IP, logging
+// a warning if the lookup was slow.
+func (wl *SlowLookup) Permitted(ip net.IP) bool {
+	start := time.Now()
+	permitted := wl.acl.Permitted(ip)
+	elapsed := time.Since(start)
+
+	if elapsed > wl.threshold {
+		if sacl, ok := wl.acl.(StatsACL); ok {
+			log.Printf("WARNING: whitelist lookup for %s took %v with %d entries", logIP(ip), elapsed, sacl.Stats().Entries)
+		} else {
+			log.Printf("WARNING: whitelist lookup for %s took %v", logIP(ip), elapsed)
+		}
+	}
+
+	return permitted
+}
+
+// Stats returns the statistics of the wrapped ACL, if it reports
+// any.
+func (wl *SlowLookup) Stats() Stats {
+	return aclStats(wl.acl)
+}
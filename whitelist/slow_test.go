@@ -0,0 +1,64 @@
+package whitelist
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowNet is a NetACL whose lookups take a fixed time.
+type slowNet struct {
+	*BasicNet
+	delay time.Duration
+}
+
+func (wl *slowNet) Permitted(ip net.IP) bool {
+	time.Sleep(wl.delay)
+	return wl.BasicNet.Permitted(ip)
+}
+
+func TestSlowLookup(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	acl := &slowNet{BasicNet: NewBasicNet()}
+	testAddNet(acl, "192.168.3.0/24", t)
+	testAddNet(acl, "10.0.0.0/8", t)
+
+	wl := NewSlowLookup(acl, 10*time.Millisecond)
+	if !wl.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected 192.168.3.1 to be permitted")
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("Expected a fast lookup not to be logged, have %q", buf.String())
+	}
+
+	acl.delay = 20 * time.Millisecond
+	if wl.Permitted(net.IP{192, 168, 4, 1}) {
+		t.Fatal("Expected 192.168.4.1 to be denied")
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, "192.168.4.1") || !strings.Contains(logged, "with 2 entries") {
+		t.Fatalf("Expected the slow lookup to be logged with the entry count, have %q", logged)
+	}
+
+	buf.Reset()
+	fn := NewSlowLookup(FuncACL(func(net.IP) bool {
+		time.Sleep(2 * DefaultSlowThreshold)
+		return true
+	}), 0)
+	if !fn.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected 127.0.0.1 to be permitted")
+	}
+
+	if logged = buf.String(); !strings.Contains(logged, "127.0.0.1") || strings.Contains(logged, "entries") {
+		t.Fatalf("Unexpected log output %q", logged)
+	}
+}
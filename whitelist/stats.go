@@ -0,0 +1,47 @@
+package whitelist
+
+// This file contains the operational statistics reported by ACLs.
+
+import "time"
+
+// Stats reports the state of a whitelist, for exposing on a
+// monitoring or status endpoint. Wrappers such as CachedNet and
+// RemoteACL report the statistics of the ACL they wrap, augmented
+// with their own fields; fields that don't apply are left zero.
+type Stats struct {
+	// Entries is the number of entries in the whitelist.
+	Entries int `json:"entries"`
+
+	// Modified is the time of the most recent call that modified
+	// the whitelist, or the zero time if it hasn't been modified
+	// since it was created.
+	Modified time.Time `json:"modified"`
+
+	// Cache reports the effectiveness of a CachedNet's cache.
+	Cache *CacheStats `json:"cache,omitempty"`
+
+	// ReloadErrors is the number of times a RemoteACL, or a
+	// whitelist from NewWatchedNetFile, has failed to refresh its
+	// whitelist.
+	ReloadErrors uint64 `json:"reload_errors,omitempty"`
+
+	// Disabled is true if a Toggle has been disabled.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// A StatsACL is an ACL that can report its operational statistics.
+type StatsACL interface {
+	ACL
+
+	// Stats returns the current statistics for the ACL.
+	Stats() Stats
+}
+
+// aclStats returns the statistics reported by the ACL, or zero
+// statistics if it doesn't report any.
+func aclStats(acl ACL) Stats {
+	if sacl, ok := acl.(StatsACL); ok {
+		return sacl.Stats()
+	}
+	return Stats{}
+}
@@ -0,0 +1,95 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+var (
+	_ StatsACL = NewBasic()
+	_ StatsACL = NewBasicNet()
+	_ StatsACL = &CachedNet{}
+	_ StatsACL = &RemoteACL{}
+	_ StatsACL = &Toggle{}
+)
+
+func TestBasicStats(t *testing.T) {
+	wl := NewBasic()
+	if stats := wl.Stats(); stats.Entries != 0 || !stats.Modified.IsZero() {
+		t.Fatalf("Unexpected stats for a new whitelist %+v", stats)
+	}
+
+	wl.Add(net.IP{127, 0, 0, 1})
+	wl.Add(net.ParseIP("::1"))
+	stats := wl.Stats()
+	if stats.Entries != 2 || stats.Modified.IsZero() {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+
+	wl.Remove(net.ParseIP("::1"))
+	if next := wl.Stats(); next.Entries != 1 || next.Modified.Before(stats.Modified) {
+		t.Fatalf("Unexpected stats after removal %+v", next)
+	}
+}
+
+func TestWrapperStats(t *testing.T) {
+	netACL := NewBasicNet()
+	cached := NewCachedNet(netACL, 0)
+	testAddNet(cached, "192.168.3.0/24", t)
+	testAddNet(cached, "10.0.0.0/8", t)
+	cached.Permitted(net.IP{192, 168, 3, 1})
+	cached.Permitted(net.IP{192, 168, 3, 1})
+
+	stats := cached.Stats()
+	if stats.Entries != 2 || stats.Modified.IsZero() {
+		t.Fatalf("Expected the wrapped whitelist's stats, have %+v", stats)
+	}
+
+	if stats.Cache == nil || stats.Cache.Hits != 1 || stats.Cache.Misses != 1 {
+		t.Fatalf("Unexpected cache stats %+v", stats.Cache)
+	}
+
+	toggle := NewToggle(cached)
+	toggle.Disable()
+	stats = toggle.Stats()
+	if !stats.Disabled || stats.Entries != 2 || stats.Cache == nil {
+		t.Fatalf("Unexpected toggle stats %+v", stats)
+	}
+
+	out, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, name := range []string{"entries", "modified", "cache", "disabled"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("Expected field %s in %s", name, out)
+		}
+	}
+
+	if _, ok := fields["reload_errors"]; ok {
+		t.Fatalf("Unexpected reload_errors field in %s", out)
+	}
+
+	// A wrapped ACL without stats leaves the shared fields zero.
+	if stats = NewToggle(PrivateAndLoopback()).Stats(); stats.Entries != 0 || stats.Disabled {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCombinedStats(t *testing.T) {
+	acl, err := NewFromStrings([]string{"127.0.0.1", "10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if stats := aclStats(acl); stats.Entries != 3 || stats.Modified.IsZero() {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,102 @@
+package whitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+// stress runs each of ops concurrently from several goroutines, so
+// that the race detector can catch unsynchronised access.
+func stress(ops []func(i int), t *testing.T) {
+	iterations := 500
+	if testing.Short() {
+		iterations = 50
+	}
+
+	var wg sync.WaitGroup
+	for _, op := range ops {
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(op func(int)) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					op(i)
+				}
+			}(op)
+		}
+	}
+	wg.Wait()
+}
+
+func TestStressBasic(t *testing.T) {
+	wl := NewBasic()
+	stress([]func(int){
+		func(i int) { wl.Add(net.IP{192, 168, 3, byte(i)}) },
+		func(i int) { wl.Remove(net.IP{192, 168, 3, byte(i)}) },
+		func(i int) { wl.Permitted(net.IP{192, 168, 3, byte(i)}) },
+		func(i int) { wl.AddLabeled(net.IP{10, 0, 0, byte(i)}, "stress") },
+		func(int) {
+			if _, err := json.Marshal(wl); err != nil {
+				t.Errorf("%v", err)
+			}
+		},
+		func(i int) {
+			in := fmt.Sprintf(`"192.168.3.%d,::1"`, i%256)
+			if err := json.Unmarshal([]byte(in), wl); err != nil {
+				t.Errorf("%v", err)
+			}
+		},
+	}, t)
+}
+
+func TestStressBasicNet(t *testing.T) {
+	wl := NewBasicNet()
+	stress([]func(int){
+		func(i int) { wl.Add(&net.IPNet{IP: net.IP{10, byte(i), 0, 0}, Mask: net.CIDRMask(16, 32)}) },
+		func(i int) { wl.Remove(&net.IPNet{IP: net.IP{10, byte(i), 0, 0}, Mask: net.CIDRMask(16, 32)}) },
+		func(i int) { wl.Permitted(net.IP{10, byte(i), 0, 1}) },
+		func(i int) {
+			wl.AddLabeled(&net.IPNet{IP: net.IP{172, 16, byte(i), 0}, Mask: net.CIDRMask(24, 32)}, "stress")
+		},
+		func(int) {
+			if _, err := json.Marshal(wl); err != nil {
+				t.Errorf("%v", err)
+			}
+		},
+		func(i int) {
+			in := fmt.Sprintf(`"10.%d.0.0/16,2001:db8::/32"`, i%256)
+			if err := json.Unmarshal([]byte(in), wl); err != nil {
+				t.Errorf("%v", err)
+			}
+		},
+	}, t)
+}
+
+// TestStressUnmarshalZero checks that whitelists declared as zero
+// values, whose locks are created on first use, can be unmarshalled
+// into concurrently.
+func TestStressUnmarshalZero(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		var wl Basic
+		var wlNet BasicNet
+		stress([]func(int){
+			func(int) {
+				if err := json.Unmarshal([]byte(`"127.0.0.1"`), &wl); err != nil {
+					t.Errorf("%v", err)
+				}
+			},
+			func(int) {
+				if err := json.Unmarshal([]byte(`{"127.0.0.0/8":"loopback"}`), &wlNet); err != nil {
+					t.Errorf("%v", err)
+				}
+			},
+		}, t)
+
+		if !wl.Permitted(net.IP{127, 0, 0, 1}) || !wlNet.Permitted(net.IP{127, 0, 0, 1}) {
+			t.Fatal("Expected the unmarshalled whitelists to permit the address")
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package whitelist
+
+// This file contains a tarpit that delays responses to clients that
+// are repeatedly denied.
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults for the fields of TarpitOptions that are not positive.
+const (
+	DefaultTarpitThreshold = 5
+	DefaultTarpitBackoff   = 100 * time.Millisecond
+	DefaultTarpitMaxDelay  = 10 * time.Second
+	DefaultTarpitCooldown  = 10 * time.Minute
+	DefaultTarpitSize      = 4096
+)
+
+// TarpitOptions control a Tarpit.
+type TarpitOptions struct {
+	// Threshold is the number of denials of an address that go
+	// undelayed.
+	Threshold int
+
+	// Backoff is the delay for the first denial past the
+	// threshold. It doubles with each further denial.
+	Backoff time.Duration
+
+	// MaxDelay caps the delay.
+	MaxDelay time.Duration
+
+	// Cooldown is how long an address must go without a denial for
+	// its count to be cleared.
+	Cooldown time.Duration
+
+	// Size is the number of addresses tracked. When it is
+	// reached, addresses past their cooldown are forgotten first.
+	Size int
+}
+
+type tarpitEntry struct {
+	denials int
+	last    time.Time
+}
+
+// A Tarpit slows down scanners and other abusive clients by delaying
+// the response to an address that has been denied repeatedly. Once
+// an address has been denied more than the threshold number of
+// times, each further denial is delayed by an exponentially
+// increasing backoff, up to a cap. The number of addresses tracked
+// is bounded, and an address's count is cleared once it has gone
+// without a denial for the cooldown period.
+type Tarpit struct {
+	lock    *sync.Mutex
+	opts    TarpitOptions
+	entries map[string]*tarpitEntry
+	now     func() time.Time
+}
+
+// NewTarpit returns a new Tarpit. Options that are not positive are
+// replaced by the package defaults.
+func NewTarpit(opts TarpitOptions) *Tarpit {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultTarpitThreshold
+	}
+
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultTarpitBackoff
+	}
+
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultTarpitMaxDelay
+	}
+
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultTarpitCooldown
+	}
+
+	if opts.Size <= 0 {
+		opts.Size = DefaultTarpitSize
+	}
+
+	return &Tarpit{
+		lock:    new(sync.Mutex),
+		opts:    opts,
+		entries: map[string]*tarpitEntry{},
+		now:     time.Now,
+	}
+}
+
+// evict makes room for a new address. The caller must hold the
+// lock.
+func (tp *Tarpit) evict(now time.Time) {
+	for addr, ent := range tp.entries {
+		if now.Sub(ent.last) >= tp.opts.Cooldown {
+			delete(tp.entries, addr)
+		}
+	}
+
+	if len(tp.entries) < tp.opts.Size {
+		return
+	}
+
+	for addr := range tp.entries {
+		delete(tp.entries, addr)
+		break
+	}
+}
+
+// Deny records a denial of ip and returns how long the response to
+// it should be delayed.
+func (tp *Tarpit) Deny(ip net.IP) time.Duration {
+	addr := ip.String()
+	now := tp.now()
+
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	ent, ok := tp.entries[addr]
+	if ok && now.Sub(ent.last) >= tp.opts.Cooldown {
+		ent.denials = 0
+	}
+
+	if !ok {
+		if len(tp.entries) >= tp.opts.Size {
+			tp.evict(now)
+		}
+		ent = new(tarpitEntry)
+		tp.entries[addr] = ent
+	}
+
+	ent.denials++
+	ent.last = now
+
+	excess := ent.denials - tp.opts.Threshold
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := tp.opts.Backoff
+	for i := 1; i < excess && delay < tp.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > tp.opts.MaxDelay {
+		delay = tp.opts.MaxDelay
+	}
+	return delay
+}
+
+// wait records a denial of ip and sleeps for the resulting delay,
+// returning early if ctx is done.
+func (tp *Tarpit) wait(ctx context.Context, ip net.IP) {
+	delay := tp.Deny(ip)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
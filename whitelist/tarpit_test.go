@@ -0,0 +1,70 @@
+package whitelist
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTarpit(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tp := NewTarpit(TarpitOptions{
+		Threshold: 2,
+		Backoff:   time.Second,
+		MaxDelay:  5 * time.Second,
+		Cooldown:  time.Minute,
+		Size:      2,
+	})
+	tp.now = func() time.Time { return now }
+
+	ip := net.IP{192, 168, 3, 1}
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if d := tp.Deny(ip); d != delay {
+			t.Fatalf("Expected a delay of %v for denial %d, but have %v", delay, i+1, d)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if d := tp.Deny(ip); d != 0 {
+		t.Fatalf("Expected the count to be cleared after the cooldown, but have a delay of %v", d)
+	}
+
+	tp.Deny(net.IP{192, 168, 3, 2})
+	tp.Deny(net.IP{192, 168, 3, 3})
+	if len(tp.entries) != 2 {
+		t.Fatalf("Expected the tracked addresses to be bounded, but have %d", len(tp.entries))
+	}
+}
+
+func TestTarpitHandler(t *testing.T) {
+	wl := NewBasic()
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.Tarpit = NewTarpit(TarpitOptions{
+		Threshold: 1,
+		Backoff:   50 * time.Millisecond,
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.3.1:4141"
+
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if time.Since(start) >= 50*time.Millisecond {
+		t.Fatal("Expected the first denial not to be delayed")
+	}
+
+	start = time.Now()
+	w := httptest.NewRecorder()
+	if h.ServeHTTP(w, req); w.Body.String() != "NO" {
+		t.Fatalf("Expected NO, but got %s", w.Body.String())
+	}
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("Expected the second denial to be delayed")
+	}
+}
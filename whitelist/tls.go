@@ -0,0 +1,32 @@
+package whitelist
+
+// This file contains whitelisting for TLS handshakes.
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// GetConfigForClient returns a function for use as a tls.Config's
+// GetConfigForClient callback that aborts the handshake with any
+// client whose address isn't permitted by the ACL, before the server
+// does any of the expensive work of the handshake. Permitted clients
+// are passed to next if it isn't nil; otherwise, the server's
+// original configuration is used.
+func GetConfigForClient(acl ACL, next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		ip, err := NetConnLookup(hello.Conn)
+		if err != nil {
+			return nil, err
+		}
+
+		if !acl.Permitted(ip) {
+			return nil, errors.New("whitelist: client address is not whitelisted")
+		}
+
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,48 @@
+package whitelist
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+type addrConn struct {
+	stubConn
+	addr net.Addr
+}
+
+func (conn *addrConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
+
+func testHello(addr string) *tls.ClientHelloInfo {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return &tls.ClientHelloInfo{Conn: &addrConn{addr: tcpAddr}}
+}
+
+func TestGetConfigForClient(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+
+	getConfig := GetConfigForClient(wl, nil)
+	if cfg, err := getConfig(testHello("127.0.0.1:4141")); err != nil || cfg != nil {
+		t.Fatalf("Expected the original config for a permitted client, but have %v, %v", cfg, err)
+	}
+
+	if _, err := getConfig(testHello("192.168.3.1:4141")); err == nil {
+		t.Fatal("Expected the handshake to be aborted for a denied client.")
+	}
+
+	if _, err := getConfig(&tls.ClientHelloInfo{}); err == nil {
+		t.Fatal("Expected the handshake to be aborted without a connection.")
+	}
+
+	override := &tls.Config{}
+	getConfig = GetConfigForClient(wl, func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return override, nil
+	})
+
+	if cfg, err := getConfig(testHello("127.0.0.1:4141")); err != nil || cfg != override {
+		t.Fatalf("Expected the next config for a permitted client, but have %v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,100 @@
+package whitelist
+
+// This file contains a bounded tracker of frequently denied
+// addresses.
+
+import (
+	"net"
+	"sort"
+	"sync"
+)
+
+// DefaultTopDeniedSize is the number of addresses tracked by a
+// TopDenied constructed with a non-positive size.
+const DefaultTopDeniedSize = 100
+
+// A DeniedCount is the estimated number of times an address has been
+// denied.
+type DeniedCount struct {
+	IP    string
+	Count uint64
+}
+
+// TopDenied tracks the most frequently denied addresses in a fixed
+// amount of memory, for spotting scanners. It uses the Space-Saving
+// algorithm: once the tracker is full, a newly denied address
+// replaces the least denied one and inherits its count. Counts may
+// therefore be overestimated, but any address denied more often than
+// once in every size denials is guaranteed to be tracked.
+type TopDenied struct {
+	lock   *sync.Mutex
+	size   int
+	counts map[string]uint64
+}
+
+// NewTopDenied returns a new TopDenied tracking up to size
+// addresses. If size is not positive, DefaultTopDeniedSize is used.
+func NewTopDenied(size int) *TopDenied {
+	if size <= 0 {
+		size = DefaultTopDeniedSize
+	}
+
+	return &TopDenied{
+		lock:   new(sync.Mutex),
+		size:   size,
+		counts: make(map[string]uint64, size),
+	}
+}
+
+// Record counts a denial of ip.
+func (td *TopDenied) Record(ip net.IP) {
+	addr := ip.String()
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	if _, ok := td.counts[addr]; ok || len(td.counts) < td.size {
+		td.counts[addr]++
+		return
+	}
+
+	var minAddr string
+	var minCount uint64
+	for a, c := range td.counts {
+		if minAddr == "" || c < minCount {
+			minAddr, minCount = a, c
+		}
+	}
+
+	delete(td.counts, minAddr)
+	td.counts[addr] = minCount + 1
+}
+
+// Top returns up to n of the most denied addresses, most denied
+// first. If n is not positive, every tracked address is returned.
+func (td *TopDenied) Top(n int) []DeniedCount {
+	td.lock.Lock()
+	top := make([]DeniedCount, 0, len(td.counts))
+	for addr, count := range td.counts {
+		top = append(top, DeniedCount{IP: addr, Count: count})
+	}
+	td.lock.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].IP < top[j].IP
+	})
+
+	if n > 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+// Reset discards every count.
+func (td *TopDenied) Reset() {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+	td.counts = make(map[string]uint64, td.size)
+}
@@ -0,0 +1,59 @@
+package whitelist
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTopDenied(t *testing.T) {
+	td := NewTopDenied(2)
+	for i := 0; i < 5; i++ {
+		td.Record(net.ParseIP("192.168.3.1"))
+	}
+	for i := 0; i < 3; i++ {
+		td.Record(net.ParseIP("192.168.3.2"))
+	}
+
+	// This evicts 192.168.3.2, the least denied address.
+	td.Record(net.ParseIP("192.168.3.3"))
+
+	top := td.Top(0)
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 tracked addresses, have %d", len(top))
+	}
+
+	if top[0] != (DeniedCount{"192.168.3.1", 5}) || top[1] != (DeniedCount{"192.168.3.3", 4}) {
+		t.Fatalf("Unexpected counts %v", top)
+	}
+
+	if top = td.Top(1); len(top) != 1 || top[0].IP != "192.168.3.1" {
+		t.Fatalf("Unexpected top address %v", top)
+	}
+
+	td.Reset()
+	if len(td.Top(0)) != 0 {
+		t.Fatal("Expected no counts after a reset")
+	}
+}
+
+func TestTopDeniedHandler(t *testing.T) {
+	wl := NewBasic()
+	wl.Add(net.IP{127, 0, 0, 1})
+	h, err := NewHandlerWithOptions(testAllowHandler, testDenyHandler, wl, HandlerOptions{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	h.TopDenied = NewTopDenied(0)
+
+	for _, addr := range []string{"127.0.0.1", "192.168.3.1", "192.168.3.1"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr + ":4141"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	top := h.TopDenied.Top(0)
+	if len(top) != 1 || top[0] != (DeniedCount{"192.168.3.1", 2}) {
+		t.Fatalf("Unexpected counts %v", top)
+	}
+}
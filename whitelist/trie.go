@@ -0,0 +1,188 @@
+package whitelist
+
+// This file contains a binary prefix trie for fast network lookups,
+// and a denylist built on it.
+
+import (
+	"net"
+	"sync"
+)
+
+type trieNode struct {
+	children [2]*trieNode
+	terminal bool
+}
+
+// bit returns the i'th bit of ip, counting from the most significant.
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// A prefixTrie stores a set of prefixes from a single address family.
+type prefixTrie struct {
+	root trieNode
+}
+
+// insert adds the first ones bits of ip as a prefix.
+func (t *prefixTrie) insert(ip net.IP, ones int) {
+	node := &t.root
+	for i := 0; i < ones; i++ {
+		b := bit(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = new(trieNode)
+		}
+		node = node.children[b]
+	}
+	node.terminal = true
+}
+
+// remove drops the exact prefix, pruning any nodes that no longer
+// lead to a prefix.
+func (t *prefixTrie) remove(ip net.IP, ones int) {
+	// walk returns true if node is empty after the removal.
+	var walk func(node *trieNode, depth int) bool
+	walk = func(node *trieNode, depth int) bool {
+		if depth == ones {
+			node.terminal = false
+		} else {
+			b := bit(ip, depth)
+			child := node.children[b]
+			if child == nil {
+				return false
+			}
+
+			if walk(child, depth+1) {
+				node.children[b] = nil
+			}
+		}
+		return !node.terminal && node.children[0] == nil && node.children[1] == nil
+	}
+	walk(&t.root, 0)
+}
+
+// match returns true if any prefix in the trie contains ip.
+func (t *prefixTrie) match(ip net.IP) bool {
+	node := &t.root
+	for i := 0; ; i++ {
+		if node.terminal {
+			return true
+		}
+
+		if i == len(ip)*8 {
+			return false
+		}
+
+		node = node.children[bit(ip, i)]
+		if node == nil {
+			return false
+		}
+	}
+}
+
+// A netTrie stores networks from both address families.
+type netTrie struct {
+	v4 prefixTrie
+	v6 prefixTrie
+}
+
+func (t *netTrie) family(ip net.IP) *prefixTrie {
+	if len(ip) == net.IPv4len {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// prefix returns the address and prefix length under which the
+// network is stored. A v4-mapped IPv6 network is stored as the IPv4
+// network it covers, since addresses are looked up in their
+// canonical form; this matches the addresses BasicNet matches.
+func prefix(n *net.IPNet) (net.IP, int, bool) {
+	r, ok := networkRange(n)
+	if !ok {
+		return nil, 0, false
+	}
+
+	ones, v4 := prefixLen(n)
+	if v4 {
+		return n.IP.To4().Mask(net.CIDRMask(ones, 8*net.IPv4len)), ones, true
+	}
+	return r.first, ones, true
+}
+
+func (t *netTrie) insert(n *net.IPNet) {
+	ip, ones, ok := prefix(n)
+	if !ok {
+		return
+	}
+
+	t.family(ip).insert(ip, ones)
+}
+
+func (t *netTrie) remove(n *net.IPNet) {
+	ip, ones, ok := prefix(n)
+	if !ok {
+		return
+	}
+
+	t.family(ip).remove(ip, ones)
+}
+
+func (t *netTrie) match(ip net.IP) bool {
+	ip = canonicalIP(ip)
+	return t.family(ip).match(ip)
+}
+
+// TrieDenylist is a network denylist backed by a binary prefix trie,
+// so lookups take time proportional to the address length rather
+// than the number of entries; it is intended for large blocklists.
+// Its Permitted method returns false if the IP is contained in any
+// blocked network, and true otherwise. Add and Remove block and
+// unblock networks; as with BasicNet, Remove requires the exact
+// network that was added.
+type TrieDenylist struct {
+	lock *sync.Mutex
+	trie *netTrie
+}
+
+// NewTrieDenylist returns a new, empty trie-backed denylist.
+func NewTrieDenylist() *TrieDenylist {
+	return &TrieDenylist{
+		lock: new(sync.Mutex),
+		trie: new(netTrie),
+	}
+}
+
+// Permitted returns true if the IP is not in a blocked network.
+// Invalid addresses are not permitted.
+func (dl *TrieDenylist) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	return !dl.trie.match(ip)
+}
+
+// Add blocks a network.
+func (dl *TrieDenylist) Add(n *net.IPNet) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	dl.trie.insert(n)
+}
+
+// Load blocks every network in the list, taking the lock only once.
+func (dl *TrieDenylist) Load(nets []*net.IPNet) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	for _, n := range nets {
+		dl.trie.insert(n)
+	}
+}
+
+// Remove unblocks a network.
+func (dl *TrieDenylist) Remove(n *net.IPNet) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	dl.trie.remove(n)
+}
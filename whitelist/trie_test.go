@@ -0,0 +1,102 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTrieDenylist(t *testing.T) {
+	dl := NewTrieDenylist()
+	if !checkIPString(dl, "10.1.2.3", t) {
+		t.Fatal("denylist should have permitted address")
+	}
+
+	var nets []*net.IPNet
+	for _, ns := range []string{"10.0.0.0/8", "10.1.2.0/24", "192.168.3.4/32", "2001:db8::/32"} {
+		_, n, err := net.ParseCIDR(ns)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		nets = append(nets, n)
+	}
+	dl.Load(nets)
+	dl.Add(nil)
+
+	for _, addr := range []string{"10.1.2.3", "10.200.0.1", "192.168.3.4", "::ffff:10.0.0.1", "2001:db8::1"} {
+		if checkIPString(dl, addr, t) {
+			t.Fatalf("denylist should have denied %s", addr)
+		}
+	}
+
+	for _, addr := range []string{"11.0.0.1", "192.168.3.5", "2001:db9::1", "::1"} {
+		if !checkIPString(dl, addr, t) {
+			t.Fatalf("denylist should have permitted %s", addr)
+		}
+	}
+
+	testDelNet(dl, "10.0.0.0/8", t)
+	if !checkIPString(dl, "10.200.0.1", t) {
+		t.Fatal("denylist should have permitted address")
+	}
+
+	if checkIPString(dl, "10.1.2.3", t) {
+		t.Fatal("denylist should have denied address")
+	}
+
+	testDelNet(dl, "10.1.2.0/24", t)
+	testDelNet(dl, "10.1.3.0/24", t)
+	dl.Remove(nil)
+	if !checkIPString(dl, "10.1.2.3", t) {
+		t.Fatal("denylist should have permitted address")
+	}
+
+	if dl.trie.v4.root.children[0] != nil {
+		t.Fatal("Expected removed prefixes to be pruned")
+	}
+
+	testAddNet(dl, "0.0.0.0/0", t)
+	if checkIPString(dl, "203.0.113.1", t) {
+		t.Fatal("denylist should have denied address")
+	}
+
+	if dl.Permitted(nil) {
+		t.Fatal("denylist should have denied an invalid address")
+	}
+}
+
+func BenchmarkTrieDenylist(b *testing.B) {
+	dl := NewTrieDenylist()
+	for i := 0; i < 1<<16; i++ {
+		dl.Add(&net.IPNet{IP: net.IP{10, byte(i >> 8), byte(i), 0}, Mask: net.CIDRMask(24, 32)})
+	}
+	ip := net.IP{192, 168, 3, 1}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dl.Permitted(ip)
+	}
+}
+
+func TestTrieDenylistMapped(t *testing.T) {
+	dl := NewTrieDenylist()
+	wl := NewBasicNet()
+	for _, ns := range []string{"::ffff:10.0.0.0/104", "::ffff:192.168.3.0/120", "2001:db8::/32"} {
+		testAddNet(dl, ns, t)
+		testAddNet(wl, ns, t)
+	}
+
+	for _, addr := range []string{"10.1.2.3", "::ffff:10.1.2.3", "192.168.3.4", "192.168.4.1", "11.0.0.1", "2001:db8::1", "::1"} {
+		if checkIPString(dl, addr, t) == checkIPString(wl, addr, t) {
+			t.Fatalf("Expected the denylist and whitelist to agree on %s", addr)
+		}
+	}
+
+	if checkIPString(dl, "10.1.2.3", t) {
+		t.Fatal("Expected a v4-mapped network to deny the IPv4 address")
+	}
+
+	testDelNet(dl, "::ffff:10.0.0.0/104", t)
+	if !checkIPString(dl, "10.1.2.3", t) {
+		t.Fatal("Expected the v4-mapped network to be removed")
+	}
+}
@@ -0,0 +1,170 @@
+package whitelist
+
+// This file contains a network whitelist that is reloaded from a
+// file whenever the file changes.
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often the file behind a watched
+// whitelist is checked for changes.
+const DefaultWatchInterval = 2 * time.Second
+
+// watchedNet is the NetACL returned by NewWatchedNetFile.
+type watchedNet struct {
+	path    string
+	lock    *sync.Mutex
+	acl     *BasicNet
+	modTime time.Time
+	size    int64
+	loaded  time.Time
+	errors  uint64
+	once    *sync.Once
+	done    chan struct{}
+	exited  chan struct{}
+}
+
+// NewWatchedNetFile loads a network whitelist from the file at path,
+// in the format read by LoadBasicNetFile, and watches the file for
+// changes. The file is checked every DefaultWatchInterval; when its
+// modification time or size changes, it is reloaded and the new
+// whitelist swapped in. If the reload fails, such as on a parse
+// error or because the file has no networks, the error is logged
+// and the previous whitelist stays in effect. Networks added or removed through the returned NetACL are
+// discarded at the next reload.
+//
+// The returned function stops watching the file and waits for the
+// watcher to exit; it must be called once the whitelist is no longer
+// needed, and always returns nil. An error is returned if the initial
+// load fails, or finds no networks, as there is no whitelist to fall
+// back to.
+func NewWatchedNetFile(path string) (NetACL, func() error, error) {
+	return newWatchedNetFile(path, DefaultWatchInterval)
+}
+
+func newWatchedNetFile(path string, interval time.Duration) (*watchedNet, func() error, error) {
+	wl := &watchedNet{
+		path:   path,
+		lock:   new(sync.Mutex),
+		once:   new(sync.Once),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+
+	if _, err := wl.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	go wl.watch(interval)
+	return wl, wl.stop, nil
+}
+
+func (wl *watchedNet) watch(interval time.Duration) {
+	defer close(wl.exited)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wl.done:
+			return
+		case <-ticker.C:
+			if _, err := wl.reload(); err != nil {
+				wl.lock.Lock()
+				wl.errors++
+				wl.lock.Unlock()
+				log.Printf("whitelist: failed to reload %s, keeping the previous whitelist: %v", wl.path, err)
+			}
+		}
+	}
+}
+
+// reload loads the file if it has changed since it was last loaded,
+// returning true if a new whitelist was swapped in.
+func (wl *watchedNet) reload() (bool, error) {
+	fi, err := os.Stat(wl.path)
+	if err != nil {
+		return false, err
+	}
+
+	wl.lock.Lock()
+	unchanged := wl.acl != nil && fi.ModTime().Equal(wl.modTime) && fi.Size() == wl.size
+	wl.lock.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	acl, err := LoadBasicNetFile(wl.path)
+	if err == nil && len(acl.whitelist) == 0 {
+		// An empty file is more likely to be mid-write, or
+		// truncated by mistake, than a deliberate deny-all.
+		err = fmt.Errorf("whitelist: %s has no networks", wl.path)
+	}
+
+	if err != nil {
+		// Record the failed version, so that the error is only
+		// reported once per change to the file.
+		wl.lock.Lock()
+		if wl.acl != nil {
+			wl.modTime, wl.size = fi.ModTime(), fi.Size()
+		}
+		wl.lock.Unlock()
+		return false, err
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.acl = acl
+	wl.modTime, wl.size = fi.ModTime(), fi.Size()
+	wl.loaded = time.Now()
+	return true, nil
+}
+
+// current returns the whitelist currently in effect.
+func (wl *watchedNet) current() *BasicNet {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return wl.acl
+}
+
+// Permitted returns true if the IP is permitted by the most recently
+// loaded whitelist.
+func (wl *watchedNet) Permitted(ip net.IP) bool {
+	return wl.current().Permitted(ip)
+}
+
+// Add adds the network to the current whitelist, until the next
+// reload.
+func (wl *watchedNet) Add(n *net.IPNet) {
+	wl.current().Add(n)
+}
+
+// Remove removes the network from the current whitelist, until the
+// next reload.
+func (wl *watchedNet) Remove(n *net.IPNet) {
+	wl.current().Remove(n)
+}
+
+// Stats returns the number of entries in the current whitelist, the
+// time it was loaded, and the number of failed reloads.
+func (wl *watchedNet) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	stats := wl.acl.Stats()
+	stats.Modified = wl.loaded
+	stats.ReloadErrors = wl.errors
+	return stats
+}
+
+// stop stops watching the file and waits for the watcher to exit.
+func (wl *watchedNet) stop() error {
+	wl.once.Do(func() { close(wl.done) })
+	<-wl.exited
+	return nil
+}
@@ -0,0 +1,155 @@
+package whitelist
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchedNetFile(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"allow": "# office\n10.0.0.0/8 # datacenter A\n",
+	}, t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "allow")
+
+	acl, stop, err := NewWatchedNetFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer stop()
+
+	if !acl.Permitted(net.IP{10, 0, 0, 1}) || acl.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected the loaded whitelist to be in effect")
+	}
+
+	if _, _, err = NewWatchedNetFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("Expected watching a missing file to fail")
+	}
+
+	if err = ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, _, err = NewWatchedNetFile(path); err == nil {
+		t.Fatal("Expected watching an empty file to fail")
+	}
+}
+
+func TestWatchedNetFileReload(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"allow": "10.0.0.0/8\n",
+	}, t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "allow")
+
+	wl, stop, err := newWatchedNetFile(path, time.Hour)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer stop()
+
+	if reloaded, err := wl.reload(); reloaded || err != nil {
+		t.Fatalf("Expected an unchanged file not to be reloaded, have %v (%v)", reloaded, err)
+	}
+
+	// Change the size and the modification time, as the file
+	// system's timestamps may be too coarse to tell the writes
+	// apart.
+	write := func(contents string, mtime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	start := time.Now()
+	write("192.168.3.0/24\n2001:db8::/32\n", start.Add(time.Minute))
+	if reloaded, err := wl.reload(); !reloaded || err != nil {
+		t.Fatalf("Expected a changed file to be reloaded, have %v (%v)", reloaded, err)
+	}
+
+	if wl.Permitted(net.IP{10, 0, 0, 1}) || !wl.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected the whitelist to be replaced")
+	}
+
+	write("192.168.3.0/24\nnot a network\n", start.Add(2*time.Minute))
+	if _, err = wl.reload(); err == nil {
+		t.Fatal("Expected an invalid file to fail to load")
+	}
+
+	if !wl.Permitted(net.IP{192, 168, 3, 1}) || !wl.Permitted(net.ParseIP("2001:db8::1")) {
+		t.Fatal("Expected the previous whitelist to be kept")
+	}
+
+	// A failed version is only reported once.
+	if reloaded, err := wl.reload(); reloaded || err != nil {
+		t.Fatalf("Expected a failed version not to be reloaded, have %v (%v)", reloaded, err)
+	}
+
+	// A truncated file, such as one that is mid-write, or only has
+	// comments left, isn't swapped in.
+	for i, contents := range []string{"", "# nothing here\n"} {
+		write(contents, start.Add(time.Duration(3+i)*time.Minute))
+		if _, err = wl.reload(); err == nil {
+			t.Fatalf("Expected an empty file %q to fail to load", contents)
+		}
+
+		if !wl.Permitted(net.IP{192, 168, 3, 1}) {
+			t.Fatal("Expected the previous whitelist to be kept")
+		}
+	}
+
+	if stats := wl.Stats(); stats.Entries != 2 || stats.Modified.IsZero() {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestWatchedNetFileWatch(t *testing.T) {
+	dir := testWriteDir(map[string]string{
+		"allow": "10.0.0.0/8\n",
+	}, t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "allow")
+
+	wl, stop, err := newWatchedNetFile(path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	mtime := time.Now().Add(time.Minute)
+	if err = ioutil.WriteFile(path, []byte("192.168.3.0/24\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err = os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !wl.Permitted(net.IP{192, 168, 3, 1}) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the changed file to be picked up by the watcher")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err = stop(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	select {
+	case <-wl.exited:
+	default:
+		t.Fatal("Expected the watcher to have exited")
+	}
+
+	// Stopping again is harmless.
+	if err = stop(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -4,12 +4,16 @@
 package whitelist
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // An ACL stores a list of permitted IP addresses, and handles
@@ -20,6 +24,80 @@ type ACL interface {
 	Permitted(net.IP) bool
 }
 
+// FuncACL adapts a function to the ACL interface, so that any policy
+// can be used with the handlers: FuncACL(fn) is an ACL whose
+// Permitted method calls fn. The function may be called from many
+// goroutines at once, so it must be safe for concurrent use.
+type FuncACL func(net.IP) bool
+
+// Permitted calls fn(ip).
+func (fn FuncACL) Permitted(ip net.IP) bool {
+	return fn(ip)
+}
+
+// PermittedAll returns true if the ACL permits every IP address in
+// the list, such as every hop in a forwarded chain. An empty list is
+// not permitted: there must be at least one address to check.
+func PermittedAll(acl ACL, ips []net.IP) bool {
+	if len(ips) == 0 {
+		return false
+	}
+
+	for _, ip := range ips {
+		if !acl.Permitted(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PermittedAny returns true if the ACL permits at least one IP
+// address in the list. An empty list is not permitted.
+func PermittedAny(acl ACL, ips []net.IP) bool {
+	for _, ip := range ips {
+		if acl.Permitted(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivateAndLoopback returns an ACL permitting the addresses that
+// are only reachable from a local network, so that they needn't be
+// listed explicitly:
+//
+//   - private addresses: 10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16
+//     (RFC 1918) and fc00::/7 (RFC 4193)
+//   - loopback addresses: 127.0.0.0/8 and ::1
+//   - link-local unicast addresses: 169.254.0.0/16 and fe80::/10
+//
+// IPv4-mapped IPv6 forms of the IPv4 ranges are also permitted. It
+// may be combined with other whitelists using FuncACL.
+func PrivateAndLoopback() ACL {
+	return FuncACL(func(ip net.IP) bool {
+		if !validIP(ip) {
+			return false
+		}
+		return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+	})
+}
+
+// isLoopback returns true if the IP is a valid loopback address: in
+// 127.0.0.0/8, in its IPv4-mapped IPv6 form, or ::1.
+func isLoopback(ip net.IP) bool {
+	return validIP(ip) && ip.IsLoopback()
+}
+
+// LoopbackOr returns an ACL that permits loopback addresses (those in
+// 127.0.0.0/8, and ::1) without consulting acl, and otherwise defers
+// to it, so that health checks and local tooling work without the
+// loopback addresses having to be whitelisted.
+func LoopbackOr(acl ACL) ACL {
+	return FuncACL(func(ip net.IP) bool {
+		return isLoopback(ip) || acl.Permitted(ip)
+	})
+}
+
 // A HostACL stores a list of permitted hosts.
 type HostACL interface {
 	ACL
@@ -48,6 +126,15 @@ func validIP(ip net.IP) bool {
 	return false
 }
 
+// hostKey returns the key under which an IP is stored in a Basic
+// whitelist. Every path that stores or looks up an address must use
+// it, so that the different textual forms of an address, such as
+// upper and lower case or compressed and expanded IPv6, and the 4-
+// and 16-byte forms of an IPv4 address, all share a single key.
+func hostKey(ip net.IP) string {
+	return ip.String()
+}
+
 // Basic implements a basic map-backed whitelister that uses an
 // RWMutex for conccurency. IPv4 addresses are treated differently
 // than an IPv6 address; namely, the IPv4 localhost will not match
@@ -55,6 +142,63 @@ func validIP(ip net.IP) bool {
 type Basic struct {
 	lock      *sync.Mutex
 	whitelist map[string]bool
+	labels    map[string]string
+	onChange  func()
+	modified  time.Time
+}
+
+// OnChange registers fn to be called after each call that modifies
+// the whitelist, such as Add or Remove, replacing any function
+// registered earlier; a nil fn removes it. It is called once the
+// whitelist's lock has been released, so it may safely call back
+// into the whitelist, and it sees the modification that triggered
+// it. fn is called even if the call didn't change the whitelist,
+// e.g. when adding an entry that is already present.
+func (wl *Basic) OnChange(fn func()) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.onChange = fn
+}
+
+// lockInit serialises the creation of the locks of whitelists
+// declared as zero values, which are created when the whitelist is
+// first unmarshalled into.
+var lockInit sync.Mutex
+
+// initLock creates the lock if it doesn't exist yet. Without
+// lockInit, two goroutines unmarshalling into the same zero-valued
+// whitelist could each create a lock, and then hold different locks.
+func initLock(lock **sync.Mutex) {
+	lockInit.Lock()
+	defer lockInit.Unlock()
+	if *lock == nil {
+		*lock = new(sync.Mutex)
+	}
+}
+
+// changed records the modification time and calls the OnChange
+// function, if any. Modifying methods defer it before taking the
+// lock, so that it runs after the lock is released.
+func (wl *Basic) changed() {
+	wl.lock.Lock()
+	wl.modified = time.Now()
+	fn := wl.onChange
+	wl.lock.Unlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// Stats returns the number of entries in the whitelist and the time
+// it was last modified.
+func (wl *Basic) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return Stats{
+		Entries:  len(wl.whitelist),
+		Modified: wl.modified,
+	}
 }
 
 // Permitted returns true if the IP has been whitelisted.
@@ -64,7 +208,7 @@ func (wl *Basic) Permitted(ip net.IP) bool {
 	}
 
 	wl.lock.Lock()
-	permitted := wl.whitelist[ip.String()]
+	permitted := wl.whitelist[hostKey(ip)]
 	wl.lock.Unlock()
 	return permitted
 }
@@ -75,20 +219,98 @@ func (wl *Basic) Add(ip net.IP) {
 		return
 	}
 
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
-	wl.whitelist[ip.String()] = true
+	wl.whitelist[hostKey(ip)] = true
+}
+
+// ReplaceAll atomically replaces the contents of the whitelist with
+// the given IPs, so that concurrent lookups see either the old or
+// the new whitelist and never a partially loaded one. Invalid IPs
+// are skipped. Labels are kept for IPs that remain whitelisted.
+func (wl *Basic) ReplaceAll(ips []net.IP) {
+	whitelist := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		if validIP(ip) {
+			whitelist[hostKey(ip)] = true
+		}
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist = whitelist
+	for addr := range wl.labels {
+		if !whitelist[addr] {
+			delete(wl.labels, addr)
+		}
+	}
 }
 
-// Remove clears the IP from the whitelist.
+// AddIfAbsent whitelists an IP, returning true if it was not already
+// whitelisted.
+func (wl *Basic) AddIfAbsent(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	addr := hostKey(ip)
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	if wl.whitelist[addr] {
+		return false
+	}
+
+	wl.whitelist[addr] = true
+	return true
+}
+
+// AddLabeled whitelists an IP, recording a label describing why it
+// is whitelisted (e.g. "office-vpn").
+func (wl *Basic) AddLabeled(ip net.IP, label string) {
+	if !validIP(ip) {
+		return
+	}
+
+	addr := hostKey(ip)
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[addr] = true
+	if wl.labels == nil {
+		wl.labels = map[string]string{}
+	}
+	wl.labels[addr] = label
+}
+
+// Label returns the label recorded for a whitelisted IP. The second
+// return value is false if the IP isn't whitelisted or wasn't added
+// with a label.
+func (wl *Basic) Label(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	label, ok := wl.labels[hostKey(ip)]
+	return label, ok
+}
+
+// Remove clears the IP, and any label, from the whitelist.
 func (wl *Basic) Remove(ip net.IP) {
 	if !validIP(ip) {
 		return
 	}
 
+	addr := hostKey(ip)
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
-	delete(wl.whitelist, ip.String())
+	delete(wl.whitelist, addr)
+	delete(wl.labels, addr)
 }
 
 // NewBasic returns a new initialised basic whitelist.
@@ -99,38 +321,96 @@ func NewBasic() *Basic {
 	}
 }
 
-// MarshalJSON serialises a host whitelist to a comma-separated list of
-// hosts, implementing the json.Marshaler interface.
-func (wl *Basic) MarshalJSON() ([]byte, error) {
+// Validate checks that the whitelist is usable: it must be non-empty,
+// and every entry must be a valid IP address. It is intended to be
+// called after loading a whitelist, as a guard against a
+// configuration that would deny everyone.
+func (wl *Basic) Validate() error {
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
-	var ss = make([]string, 0, len(wl.whitelist))
-	for ip := range wl.whitelist {
-		ss = append(ss, ip)
+
+	if len(wl.whitelist) == 0 {
+		return errors.New("whitelist: whitelist is empty")
 	}
 
-	out := []byte(`"` + strings.Join(ss, ",") + `"`)
-	return out, nil
+	for addr := range wl.whitelist {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("whitelist: invalid IP address %q", addr)
+		}
+	}
+
+	return nil
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface for host
-// whitelists, taking a comma-separated string of hosts.
-func (wl *Basic) UnmarshalJSON(in []byte) error {
-	if in[0] != '"' || in[len(in)-1] != '"' {
-		return errors.New("whitelist: invalid whitelist")
+// Normalize rewrites the whitelist into canonical form, such as
+// after migrating entries from a legacy store: invalid entries are
+// dropped, and every other entry is rewritten to its canonical form,
+// merging entries that differ only in how the address was written.
+// Where merged entries have different labels, the label of an entry
+// already in canonical form is kept. Normalize returns the number of
+// entries removed or merged; calling it again returns zero.
+func (wl *Basic) Normalize() int {
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	whitelist := make(map[string]bool, len(wl.whitelist))
+	var labels map[string]string
+	for addr, permitted := range wl.whitelist {
+		ip := net.ParseIP(addr)
+		if !permitted || ip == nil {
+			continue
+		}
+
+		key := hostKey(ip)
+		whitelist[key] = true
+		label, ok := wl.labels[addr]
+		if !ok {
+			continue
+		}
+
+		if labels == nil {
+			labels = map[string]string{}
+		}
+
+		if _, have := labels[key]; !have || key == addr {
+			labels[key] = label
+		}
 	}
 
-	if wl.lock == nil {
-		wl.lock = new(sync.Mutex)
+	removed := len(wl.whitelist) - len(whitelist)
+	wl.whitelist = whitelist
+	wl.labels = labels
+	return removed
+}
+
+// MarshalText serialises a host whitelist to a comma-separated list
+// of hosts, implementing the encoding.TextMarshaler interface.
+func (wl *Basic) MarshalText() ([]byte, error) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	var ss = make([]string, 0, len(wl.whitelist))
+	for ip := range wl.whitelist {
+		ss = append(ss, ip)
 	}
 
+	return []byte(strings.Join(ss, ",")), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for
+// host whitelists, taking a comma-separated list of hosts.
+func (wl *Basic) UnmarshalText(in []byte) error {
+	initLock(&wl.lock)
+
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
 
-	netString := strings.TrimSpace(string(in[1 : len(in)-1]))
+	netString := strings.TrimSpace(string(in))
 	nets := strings.Split(netString, ",")
 
 	wl.whitelist = map[string]bool{}
+	wl.labels = nil
 	for i := range nets {
 		addr := strings.TrimSpace(nets[i])
 		if addr == "" {
@@ -142,7 +422,110 @@ func (wl *Basic) UnmarshalJSON(in []byte) error {
 			wl.whitelist = nil
 			return errors.New("whitelist: invalid IP address " + addr)
 		}
+		wl.whitelist[hostKey(ip)] = true
+	}
+
+	return nil
+}
+
+// MarshalJSON serialises a host whitelist to a comma-separated list of
+// hosts, implementing the json.Marshaler interface. If any host has
+// a label, the whitelist is instead serialised as an object mapping
+// each host to its label.
+func (wl *Basic) MarshalJSON() ([]byte, error) {
+	var labels map[string]string
+	wl.lock.Lock()
+	if len(wl.labels) > 0 {
+		labels = make(map[string]string, len(wl.whitelist))
+		for addr := range wl.whitelist {
+			labels[addr] = wl.labels[addr]
+		}
+	}
+	wl.lock.Unlock()
+
+	if labels != nil {
+		return json.Marshal(labels)
+	}
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(`"` + string(out) + `"`), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for host
+// whitelists, taking either a comma-separated string of hosts or an
+// object mapping hosts to labels.
+func (wl *Basic) UnmarshalJSON(in []byte) error {
+	text, labels, err := unmarshalJSONList(in)
+	if err != nil {
+		return err
+	}
+
+	if labels != nil {
+		return wl.unmarshalLabels(labels)
+	}
+	return wl.UnmarshalText([]byte(text))
+}
+
+// unmarshalJSONList decodes a serialised whitelist, which is either a
+// JSON string holding a comma-separated list of entries or an object
+// mapping entries to labels. On success, labels is non-nil if and
+// only if the object form was used. Malformed input, including empty
+// input, is reported as an error.
+func unmarshalJSONList(in []byte) (text string, labels map[string]string, err error) {
+	in = bytes.TrimSpace(in)
+	if len(in) < 2 {
+		// Neither form can be shorter than a pair of quotes or
+		// braces.
+		return "", nil, fmt.Errorf("whitelist: serialised whitelist is too short (%d bytes)", len(in))
+	}
+
+	switch in[0] {
+	case '{':
+		if err = json.Unmarshal(in, &labels); err != nil {
+			return "", nil, err
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		return "", labels, nil
+	case '"':
+		if err = json.Unmarshal(in, &text); err != nil {
+			return "", nil, err
+		}
+		return text, nil, nil
+	default:
+		return "", nil, errors.New("whitelist: invalid whitelist")
+	}
+}
+
+// unmarshalLabels replaces the whitelist with the hosts in labels.
+// Hosts with an empty label are whitelisted without a label.
+func (wl *Basic) unmarshalLabels(labels map[string]string) error {
+	initLock(&wl.lock)
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	wl.whitelist = map[string]bool{}
+	wl.labels = map[string]string{}
+	for addr, label := range labels {
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			wl.whitelist = nil
+			wl.labels = nil
+			return errors.New("whitelist: invalid IP address " + addr)
+		}
+
+		addr = hostKey(ip)
 		wl.whitelist[addr] = true
+		if label != "" {
+			wl.labels[addr] = label
+		}
 	}
 
 	return nil
@@ -165,17 +548,14 @@ func DumpBasic(wl *Basic) []byte {
 	return []byte(addrList)
 }
 
-// LoadBasic loads a whitelist from a byteslice.
+// LoadBasic loads a whitelist from a byteslice, with one address per
+// line. Blank lines and lines beginning with '#' are ignored, and an
+// address may be followed by a comment beginning with '#', which
+// becomes its label.
 func LoadBasic(in []byte) (*Basic, error) {
 	wl := NewBasic()
-	addrs := strings.Split(string(in), "\n")
-
-	for _, addr := range addrs {
-		ip := net.ParseIP(addr)
-		if ip == nil {
-			return nil, errors.New("whitelist: invalid address")
-		}
-		wl.Add(ip)
+	if err := scanLines("", bytes.NewReader(in), addHostLine(wl)); err != nil {
+		return nil, err
 	}
 	return wl, nil
 }
@@ -190,18 +570,18 @@ type HostStub struct{}
 // Permitted always returns true, but prints a warning message alerting
 // that whitelisting is stubbed.
 func (wl HostStub) Permitted(ip net.IP) bool {
-	log.Printf("WARNING: whitelist check for %s but whitelisting is stubbed", ip)
+	log.Printf("WARNING: whitelist check for %s but whitelisting is stubbed", logIP(ip))
 	return true
 }
 
 // Add prints a warning message about whitelisting being stubbed.
 func (wl HostStub) Add(ip net.IP) {
-	log.Printf("WARNING: IP %s added to whitelist but whitelisting is stubbed", ip)
+	log.Printf("WARNING: IP %s added to whitelist but whitelisting is stubbed", logIP(ip))
 }
 
 // Remove prints a warning message about whitelisting being stubbed.
 func (wl HostStub) Remove(ip net.IP) {
-	log.Printf("WARNING: IP %s removed from whitelist but whitelisting is stubbed", ip)
+	log.Printf("WARNING: IP %s removed from whitelist but whitelisting is stubbed", logIP(ip))
 }
 
 // NewHostStub returns a new stubbed host whitelister.
@@ -0,0 +1,93 @@
+package whitelist
+
+// This file contains a whitelist of address and port pairs.
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// An AddrPortACL stores a list of permitted IP address and port
+// pairs, for policies such as "this host, but only to port 443". It
+// is separate from the IP-only ACLs, which are unaffected by it.
+type AddrPortACL interface {
+	// Permitted returns true if the pair is whitelisted.
+	Permitted(ip net.IP, port int) bool
+
+	// Add whitelists the pair.
+	Add(ip net.IP, port int)
+
+	// Remove drops the pair from the whitelist.
+	Remove(ip net.IP, port int)
+}
+
+// addrPort converts an IP address and port to a netip.AddrPort. As
+// with Basic, an IPv4 address and its IPv4-mapped IPv6 form are
+// treated as the same address. It returns false if either the
+// address or the port is invalid.
+func addrPort(ip net.IP, port int) (netip.AddrPort, bool) {
+	if !validIP(ip) || port < 0 || port > 65535 {
+		return netip.AddrPort{}, false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), true
+}
+
+// BasicAddrPort is a map-backed AddrPortACL.
+type BasicAddrPort struct {
+	lock      *sync.Mutex
+	whitelist map[netip.AddrPort]bool
+}
+
+// NewBasicAddrPort returns a new initialised address and port
+// whitelist.
+func NewBasicAddrPort() *BasicAddrPort {
+	return &BasicAddrPort{
+		lock:      new(sync.Mutex),
+		whitelist: map[netip.AddrPort]bool{},
+	}
+}
+
+// Permitted returns true if the address and port pair has been
+// whitelisted.
+func (wl *BasicAddrPort) Permitted(ip net.IP, port int) bool {
+	ap, ok := addrPort(ip, port)
+	if !ok {
+		return false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return wl.whitelist[ap]
+}
+
+// Add whitelists an address and port pair. Invalid pairs are
+// ignored.
+func (wl *BasicAddrPort) Add(ip net.IP, port int) {
+	ap, ok := addrPort(ip, port)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[ap] = true
+}
+
+// Remove clears an address and port pair from the whitelist.
+func (wl *BasicAddrPort) Remove(ip net.IP, port int) {
+	ap, ok := addrPort(ip, port)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	delete(wl.whitelist, ap)
+}
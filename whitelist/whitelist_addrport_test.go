@@ -0,0 +1,48 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBasicAddrPort(t *testing.T) {
+	wl := NewBasicAddrPort()
+	wl.Add(net.ParseIP("192.168.3.1"), 443)
+	wl.Add(net.ParseIP("2001:db8::1"), 8443)
+
+	type addrPortTest struct {
+		ip        string
+		port      int
+		permitted bool
+	}
+
+	tv := []addrPortTest{
+		{"192.168.3.1", 443, true},
+		{"192.168.3.1", 80, false},
+		{"::ffff:192.168.3.1", 443, true},
+		{"192.168.3.2", 443, false},
+		{"2001:db8::1", 8443, true},
+		{"2001:db8::1", 443, false},
+		{"192.168.3.1", -1, false},
+		{"192.168.3.1", 65979, false},
+	}
+
+	for _, tc := range tv {
+		if wl.Permitted(net.ParseIP(tc.ip), tc.port) != tc.permitted {
+			t.Fatalf("Expected %s port %d permitted=%v", tc.ip, tc.port, tc.permitted)
+		}
+	}
+
+	if wl.Permitted(nil, 443) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+
+	wl.Add(net.ParseIP("192.168.3.1"), 65979)
+	wl.Remove(net.IP{192, 168, 3, 1}, 443)
+	if wl.Permitted(net.ParseIP("192.168.3.1"), 443) {
+		t.Fatal("Expected 192.168.3.1:443 to be removed")
+	}
+	if len(wl.whitelist) != 1 {
+		t.Fatalf("Expected one remaining entry, have %d", len(wl.whitelist))
+	}
+}
@@ -0,0 +1,108 @@
+package whitelist
+
+// This file contains an ACL that permits addresses by the autonomous
+// system that announces them.
+
+import (
+	"log"
+	"net"
+	"sync"
+)
+
+// An ASNLookup returns the number of the autonomous system that
+// announces the IP address. The mapping source is up to the caller;
+// it might be a routing table dump or an external database.
+type ASNLookup func(net.IP) (uint32, error)
+
+// DefaultASNCacheSize is the number of address to ASN mappings an
+// ASN whitelist will cache if it is constructed with a non-positive
+// size.
+const DefaultASNCacheSize = 4096
+
+// ASN implements a whitelist of autonomous systems: an address is
+// permitted if the autonomous system announcing it is whitelisted.
+// The results of the lookup function are cached; failed lookups are
+// not cached, and the address is denied.
+type ASN struct {
+	lock      *sync.Mutex
+	lookup    ASNLookup
+	size      int
+	cache     map[string]uint32
+	whitelist map[uint32]bool
+}
+
+// NewASN returns a new ASN whitelist that resolves addresses with
+// lookup, caching up to size mappings. If size is not positive,
+// DefaultASNCacheSize is used.
+func NewASN(lookup ASNLookup, size int) *ASN {
+	if size <= 0 {
+		size = DefaultASNCacheSize
+	}
+
+	return &ASN{
+		lock:      new(sync.Mutex),
+		lookup:    lookup,
+		size:      size,
+		cache:     map[string]uint32{},
+		whitelist: map[uint32]bool{},
+	}
+}
+
+// resolve returns the ASN for the IP, consulting the cache first.
+func (wl *ASN) resolve(ip net.IP) (uint32, error) {
+	addr := ip.String()
+	wl.lock.Lock()
+	asn, ok := wl.cache[addr]
+	wl.lock.Unlock()
+	if ok {
+		return asn, nil
+	}
+
+	asn, err := wl.lookup(ip)
+	if err != nil {
+		return 0, err
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	if len(wl.cache) >= wl.size {
+		for k := range wl.cache {
+			delete(wl.cache, k)
+			break
+		}
+	}
+	wl.cache[addr] = asn
+	return asn, nil
+}
+
+// Permitted returns true if the IP is announced by a whitelisted
+// autonomous system.
+func (wl *ASN) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	asn, err := wl.resolve(ip)
+	if err != nil {
+		log.Printf("whitelist: failed to look up ASN for %s: %v", logIP(ip), err)
+		return false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return wl.whitelist[asn]
+}
+
+// Add whitelists an autonomous system.
+func (wl *ASN) Add(asn uint32) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[asn] = true
+}
+
+// Remove drops an autonomous system from the whitelist.
+func (wl *ASN) Remove(asn uint32) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	delete(wl.whitelist, asn)
+}
@@ -0,0 +1,53 @@
+package whitelist
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestASN(t *testing.T) {
+	lookups := 0
+	wl := NewASN(func(ip net.IP) (uint32, error) {
+		lookups++
+		if ip.To4() == nil {
+			return 0, errors.New("no route")
+		}
+		return uint32(ip.To4()[0]), nil
+	}, 2)
+
+	if checkIPString(wl, "13.0.0.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	wl.Add(13)
+	if !checkIPString(wl, "13.0.0.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if checkIPString(wl, "14.0.0.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	if lookups != 2 {
+		t.Fatalf("Expected 2 lookups, but have %d", lookups)
+	}
+
+	checkIPString(wl, "15.0.0.1", t)
+	if len(wl.cache) != 2 {
+		t.Fatalf("Expected cache to be bounded to 2 entries, but have %d", len(wl.cache))
+	}
+
+	if checkIPString(wl, "::1", t) {
+		t.Fatal("whitelist should have denied address that failed lookup")
+	}
+
+	wl.Remove(13)
+	if checkIPString(wl, "13.0.0.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	if wl.Permitted(nil) {
+		t.Fatal("whitelist should have denied an invalid address")
+	}
+}
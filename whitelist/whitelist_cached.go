@@ -0,0 +1,276 @@
+package whitelist
+
+// This file contains a NetACL wrapper that caches the results of
+// recent Permitted calls.
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of results a CachedNet will hold
+// if it is constructed with a non-positive size.
+const DefaultCacheSize = 128
+
+type cacheEntry struct {
+	addr      string
+	permitted bool
+	expires   time.Time
+}
+
+// CacheStats reports how effective a cache has been.
+type CacheStats struct {
+	// Hits is the number of lookups answered from the cache.
+	Hits uint64 `json:"hits"`
+
+	// Misses is the number of lookups passed to the wrapped ACL.
+	Misses uint64 `json:"misses"`
+
+	// Entries is the number of results currently cached.
+	Entries int `json:"entries"`
+}
+
+// CachedNet wraps a NetACL with a least-recently-used cache of
+// Permitted results, keyed by the string form of the address. It is
+// intended for workloads dominated by a small set of repeat
+// addresses, where it turns most lookups into a map hit.
+//
+// The cache is cleared whenever a network is added or removed
+// through the CachedNet. Changes made directly to the wrapped ACL
+// bypass this invalidation, so once an ACL has been wrapped, it
+// should only be modified through the wrapper.
+//
+// Positive and negative results may also be given separate lifetimes
+// with NewCachedNetTTL. Negative results are often the more valuable
+// to cache, as denying an address means scanning the entire wrapped
+// whitelist.
+type CachedNet struct {
+	lock        *sync.Mutex
+	acl         NetACL
+	size        int
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	order       *list.List
+	cache       map[string]*list.Element
+	stats       CacheStats
+
+	// gen is incremented each time the cache is cleared, so that
+	// a lookup that started before a change isn't cached after it.
+	gen uint64
+}
+
+// NewCachedNet wraps the ACL with a cache holding the results for
+// up to size addresses. If size is not positive, DefaultCacheSize
+// is used.
+func NewCachedNet(acl NetACL, size int) *CachedNet {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	return &CachedNet{
+		lock:  new(sync.Mutex),
+		acl:   acl,
+		size:  size,
+		order: list.New(),
+		cache: map[string]*list.Element{},
+	}
+}
+
+// NewCachedNetTTL is like NewCachedNet, but cached results expire:
+// permitted results after positiveTTL, and denied results after
+// negativeTTL. A non-positive TTL means that results never expire,
+// though they may still be evicted to make room or cleared by a
+// change to the whitelist.
+func NewCachedNetTTL(acl NetACL, size int, positiveTTL, negativeTTL time.Duration) *CachedNet {
+	wl := NewCachedNet(acl, size)
+	wl.positiveTTL = positiveTTL
+	wl.negativeTTL = negativeTTL
+	return wl
+}
+
+// Permitted returns true if the IP has been whitelisted, consulting
+// the cache before the wrapped ACL.
+func (wl *CachedNet) Permitted(ip net.IP) bool {
+	d, _ := wl.PermittedDetailed(ip)
+	return d == Allow
+}
+
+// PermittedDetailed returns the decision for the IP, consulting the
+// cache before the wrapped ACL. If the wrapped ACL is a DetailedACL,
+// its indeterminate decisions are passed on without being cached, so
+// that the next check tries again. The wrapped ACL is consulted
+// without holding the cache's lock, so a slow miss doesn't delay
+// lookups answered from the cache.
+func (wl *CachedNet) PermittedDetailed(ip net.IP) (Decision, error) {
+	if !validIP(ip) {
+		return Indeterminate, errInvalidIP
+	}
+
+	addr := ip.String()
+	now := time.Now()
+	wl.lock.Lock()
+	if permitted, ok := wl.cached(addr, now); ok {
+		wl.stats.Hits++
+		wl.lock.Unlock()
+		if permitted {
+			return Allow, nil
+		}
+		return Deny, nil
+	}
+
+	wl.stats.Misses++
+	gen := wl.gen
+	wl.lock.Unlock()
+
+	d, err := PermittedDetailed(wl.acl, ip)
+	if err != nil {
+		return d, err
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.store(addr, d == Allow, now, gen)
+	return d, nil
+}
+
+// cached returns the cached result for addr, if there is one that
+// hasn't expired, and marks it as the most recently used. The caller
+// must hold the lock.
+func (wl *CachedNet) cached(addr string, now time.Time) (permitted, ok bool) {
+	elt, ok := wl.cache[addr]
+	if !ok {
+		return false, false
+	}
+
+	ent := elt.Value.(*cacheEntry)
+	if !ent.expires.IsZero() && !now.Before(ent.expires) {
+		wl.order.Remove(elt)
+		delete(wl.cache, addr)
+		return false, false
+	}
+
+	wl.order.MoveToFront(elt)
+	return ent.permitted, true
+}
+
+// store caches a result, evicting the least recently used result if
+// the cache is full. The result is dropped if the cache has been
+// cleared since generation gen, as it may predate a change to the
+// whitelist. The caller must hold the lock.
+func (wl *CachedNet) store(addr string, permitted bool, now time.Time, gen uint64) {
+	if gen != wl.gen {
+		return
+	}
+
+	// Another lookup of the same address may have finished first.
+	if elt, ok := wl.cache[addr]; ok {
+		wl.order.Remove(elt)
+	}
+
+	ent := &cacheEntry{
+		addr:      addr,
+		permitted: permitted,
+	}
+
+	ttl := wl.negativeTTL
+	if permitted {
+		ttl = wl.positiveTTL
+	}
+
+	if ttl > 0 {
+		ent.expires = now.Add(ttl)
+	}
+	wl.cache[addr] = wl.order.PushFront(ent)
+
+	if wl.order.Len() > wl.size {
+		oldest := wl.order.Back()
+		wl.order.Remove(oldest)
+		delete(wl.cache, oldest.Value.(*cacheEntry).addr)
+	}
+}
+
+// Warmup populates the cache with the results for the IPs, such as
+// a service's known top clients at startup, so that their first
+// requests after a restart are answered from the cache. The IPs
+// should be ordered from most to least important: if there are more
+// than the cache can hold, only the first are cached. Results that
+// are already cached are kept, warmed results expire as usual, and
+// indeterminate results from a DetailedACL aren't cached. As with
+// PermittedDetailed, the wrapped ACL is consulted without holding
+// the lock. Warmup doesn't count towards the cache's hits and misses.
+func (wl *CachedNet) Warmup(ips []net.IP) {
+	valid := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if validIP(ip) {
+			valid = append(valid, ip)
+		}
+	}
+
+	if len(valid) > wl.size {
+		valid = valid[:wl.size]
+	}
+
+	// Insert in reverse so that the most important results are
+	// the most recently used, and the last to be evicted.
+	for i := len(valid) - 1; i >= 0; i-- {
+		addr := valid[i].String()
+		now := time.Now()
+		wl.lock.Lock()
+		_, ok := wl.cached(addr, now)
+		gen := wl.gen
+		wl.lock.Unlock()
+		if ok {
+			continue
+		}
+
+		d, err := PermittedDetailed(wl.acl, valid[i])
+		if err != nil {
+			// Leave indeterminate results to be retried.
+			continue
+		}
+
+		wl.lock.Lock()
+		wl.store(addr, d == Allow, now, gen)
+		wl.lock.Unlock()
+	}
+}
+
+// Add adds a network to the wrapped ACL and clears the cache.
+func (wl *CachedNet) Add(n *net.IPNet) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.acl.Add(n)
+	wl.reset()
+}
+
+// Remove removes a network from the wrapped ACL and clears the
+// cache.
+func (wl *CachedNet) Remove(n *net.IPNet) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.acl.Remove(n)
+	wl.reset()
+}
+
+// Stats returns the statistics of the wrapped ACL, if it reports
+// any, along with the cache's hit and miss counts since it was
+// created and the number of results it holds.
+func (wl *CachedNet) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	cache := wl.stats
+	cache.Entries = wl.order.Len()
+
+	stats := aclStats(wl.acl)
+	stats.Cache = &cache
+	return stats
+}
+
+// reset clears the cache. The caller must hold the lock.
+func (wl *CachedNet) reset() {
+	wl.gen++
+	wl.order.Init()
+	wl.cache = map[string]*list.Element{}
+}
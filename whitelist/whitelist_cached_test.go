@@ -0,0 +1,202 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type countingNet struct {
+	*BasicNet
+	lookups int
+}
+
+func (wl *countingNet) Permitted(ip net.IP) bool {
+	wl.lookups++
+	return wl.BasicNet.Permitted(ip)
+}
+
+func TestCachedNet(t *testing.T) {
+	acl := &countingNet{BasicNet: NewBasicNet()}
+	wl := NewCachedNet(acl, 2)
+
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	testAddNet(wl, "192.168.3.0/24", t)
+	if !checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	checkIPString(wl, "192.168.3.1", t)
+	if acl.lookups != 2 {
+		t.Fatalf("Expected 2 lookups, but have %d", acl.lookups)
+	}
+
+	// Evict 192.168.3.1 by looking up two other addresses.
+	checkIPString(wl, "192.168.3.2", t)
+	checkIPString(wl, "192.168.3.3", t)
+	checkIPString(wl, "192.168.3.1", t)
+	if acl.lookups != 5 {
+		t.Fatalf("Expected 5 lookups, but have %d", acl.lookups)
+	}
+
+	if len(wl.cache) != 2 || wl.order.Len() != 2 {
+		t.Fatalf("Expected 2 cached results, but have %d", len(wl.cache))
+	}
+
+	testDelNet(wl, "192.168.3.0/24", t)
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	if wl.Permitted(nil) {
+		t.Fatal("whitelist should have denied an invalid address")
+	}
+}
+
+func TestCachedNetDefaultSize(t *testing.T) {
+	wl := NewCachedNet(NewBasicNet(), 0)
+	if wl.size != DefaultCacheSize {
+		t.Fatalf("Expected cache size %d, but have %d", DefaultCacheSize, wl.size)
+	}
+}
+
+func TestCachedNetTTL(t *testing.T) {
+	acl := &countingNet{BasicNet: NewBasicNet()}
+	testAddNet(acl, "192.168.3.0/24", t)
+	wl := NewCachedNetTTL(acl, 0, time.Hour, time.Nanosecond)
+
+	checkIPString(wl, "192.168.3.1", t)
+	checkIPString(wl, "10.0.0.1", t)
+	time.Sleep(time.Millisecond)
+
+	if !checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if checkIPString(wl, "10.0.0.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	// The denied result expired, so it was looked up again.
+	if acl.lookups != 3 {
+		t.Fatalf("Expected 3 lookups, but have %d", acl.lookups)
+	}
+
+	stats := wl.Stats().Cache
+	if stats.Hits != 1 || stats.Misses != 3 || stats.Entries != 2 {
+		t.Fatalf("Unexpected cache stats %+v", stats)
+	}
+
+	testDelNet(wl, "192.168.3.0/24", t)
+	if stats = wl.Stats().Cache; stats.Entries != 0 {
+		t.Fatalf("Expected an empty cache, but have %d entries", stats.Entries)
+	}
+}
+
+func TestCachedNetWarmup(t *testing.T) {
+	acl := &countingNet{BasicNet: NewBasicNet()}
+	testAddNet(acl, "192.168.3.0/24", t)
+	wl := NewCachedNetTTL(acl, 2, time.Hour, time.Hour)
+
+	wl.Warmup([]net.IP{
+		net.ParseIP("192.168.3.1"),
+		nil,
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.0.0.2"),
+	})
+
+	// Only the first two results fit in the cache.
+	if acl.lookups != 2 || len(wl.cache) != 2 {
+		t.Fatalf("Expected 2 lookups and cached results, but have %d and %d", acl.lookups, len(wl.cache))
+	}
+
+	if !checkIPString(wl, "192.168.3.1", t) || checkIPString(wl, "10.0.0.1", t) {
+		t.Fatal("Unexpected result for a warmed address")
+	}
+
+	if acl.lookups != 2 {
+		t.Fatalf("Expected warmed addresses to be answered from the cache, but have %d lookups", acl.lookups)
+	}
+
+	if stats := wl.Stats().Cache; stats.Hits != 2 || stats.Misses != 0 {
+		t.Fatalf("Unexpected cache stats %+v", stats)
+	}
+
+	// Warming an address that is already cached doesn't look it up
+	// again.
+	wl.Warmup([]net.IP{net.ParseIP("10.0.0.1")})
+	if acl.lookups != 2 {
+		t.Fatalf("Expected no further lookups, but have %d", acl.lookups)
+	}
+
+	// Warmed results expire as usual.
+	wl = NewCachedNetTTL(acl, 0, time.Nanosecond, time.Nanosecond)
+	wl.Warmup([]net.IP{net.ParseIP("192.168.3.1")})
+	time.Sleep(time.Millisecond)
+	checkIPString(wl, "192.168.3.1", t)
+	if acl.lookups != 4 {
+		t.Fatalf("Expected an expired warm result to be looked up again, but have %d lookups", acl.lookups)
+	}
+}
+
+// blockingNet holds back the result of a lookup of 10.0.0.1 until
+// release is closed.
+type blockingNet struct {
+	*BasicNet
+	started chan struct{}
+	release chan struct{}
+}
+
+func (wl *blockingNet) Permitted(ip net.IP) bool {
+	permitted := wl.BasicNet.Permitted(ip)
+	if ip.Equal(net.IP{10, 0, 0, 1}) {
+		wl.started <- struct{}{}
+		<-wl.release
+	}
+	return permitted
+}
+
+func TestCachedNetSlowMiss(t *testing.T) {
+	acl := &blockingNet{
+		BasicNet: NewBasicNet(),
+		started:  make(chan struct{}, 2),
+		release:  make(chan struct{}),
+	}
+	wl := NewCachedNet(acl, 0)
+	testAddNet(wl, "192.168.3.0/24", t)
+	checkIPString(wl, "192.168.3.1", t)
+
+	done := make(chan bool)
+	go func() {
+		done <- wl.Permitted(net.IP{10, 0, 0, 1})
+	}()
+	<-acl.started
+
+	// A cached result is returned while the miss is in progress.
+	hit := make(chan bool)
+	go func() {
+		hit <- wl.Permitted(net.IP{192, 168, 3, 1})
+	}()
+
+	select {
+	case permitted := <-hit:
+		if !permitted {
+			t.Fatal("Expected the cached address to be permitted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("A cache hit was blocked by a slow miss")
+	}
+
+	// A change made during the miss keeps its result out of the
+	// cache, as it may be stale.
+	testAddNet(wl, "10.0.0.0/8", t)
+	close(acl.release)
+	<-done
+
+	if !wl.Permitted(net.IP{10, 0, 0, 1}) {
+		t.Fatal("Expected the result from before the change not to be cached")
+	}
+}
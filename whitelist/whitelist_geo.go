@@ -0,0 +1,77 @@
+package whitelist
+
+// This file contains an ACL that permits addresses by the country
+// they are located in.
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+)
+
+// A CountryDB resolves addresses to ISO 3166-1 alpha-2 country codes,
+// such as "US" or "DE". It is typically a thin adapter around a
+// reader for a MaxMind GeoLite2 Country database, opened once and
+// shared by every lookup; see the package README for an example. An
+// empty code means that the address's country is unknown.
+type CountryDB interface {
+	Country(ip net.IP) (string, error)
+}
+
+// GeoACL implements a whitelist of countries: an address is permitted
+// if it is located in one of the whitelisted countries. If the
+// country can't be determined, because the lookup failed or the
+// address isn't in the database, the address is denied unless the
+// GeoACL was constructed to fail open.
+type GeoACL struct {
+	db        CountryDB
+	countries map[string]bool
+	failOpen  bool
+}
+
+// NewGeoACL returns a new GeoACL permitting addresses in the given
+// countries, which are ISO 3166-1 alpha-2 codes compared without
+// regard to case. Addresses are resolved with db. If failOpen is
+// true, addresses whose country can't be determined are permitted;
+// otherwise they are denied.
+func NewGeoACL(db CountryDB, countries []string, failOpen bool) *GeoACL {
+	wl := &GeoACL{
+		db:        db,
+		countries: make(map[string]bool, len(countries)),
+		failOpen:  failOpen,
+	}
+
+	for _, country := range countries {
+		wl.countries[strings.ToUpper(strings.TrimSpace(country))] = true
+	}
+	return wl
+}
+
+// Permitted returns true if the IP is located in a whitelisted
+// country.
+func (wl *GeoACL) Permitted(ip net.IP) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	country, err := wl.db.Country(ip)
+	if err != nil {
+		log.Printf("whitelist: failed to look up country for %s: %v", logIP(ip), err)
+		return wl.failOpen
+	}
+
+	if country == "" {
+		return wl.failOpen
+	}
+	return wl.countries[strings.ToUpper(country)]
+}
+
+// Close releases the database, if it implements io.Closer. The
+// GeoACL must not be used afterwards.
+func (wl *GeoACL) Close() error {
+	if closer, ok := wl.db.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
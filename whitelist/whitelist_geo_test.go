@@ -0,0 +1,89 @@
+package whitelist
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// testCountryDB maps addresses to countries by their first octet.
+type testCountryDB struct {
+	closed bool
+}
+
+func (db *testCountryDB) Country(ip net.IP) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", errors.New("no IPv6 data")
+	}
+
+	switch ip4[0] {
+	case 1:
+		return "us", nil
+	case 2:
+		return "DE", nil
+	case 3:
+		return "FR", nil
+	}
+	return "", nil
+}
+
+func (db *testCountryDB) Close() error {
+	db.closed = true
+	return nil
+}
+
+// staticCountryDB places every address in a single country.
+type staticCountryDB string
+
+func (db staticCountryDB) Country(ip net.IP) (string, error) {
+	return string(db), nil
+}
+
+func TestGeoACL(t *testing.T) {
+	db := &testCountryDB{}
+	wl := NewGeoACL(db, []string{"US", " de"}, false)
+
+	tv := map[string]bool{
+		"1.0.0.1":     true,
+		"2.0.0.1":     true,
+		"3.0.0.1":     false,
+		"4.0.0.1":     false,
+		"2001:db8::1": false,
+	}
+
+	for addr, permitted := range tv {
+		if checkIPString(wl, addr, t) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if wl.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+
+	// Failing open permits addresses whose country is unknown, but
+	// still denies addresses in other countries.
+	open := NewGeoACL(db, []string{"US"}, true)
+	if !checkIPString(open, "4.0.0.1", t) || !checkIPString(open, "2001:db8::1", t) {
+		t.Fatal("Expected addresses with an unknown country to be permitted")
+	}
+
+	if checkIPString(open, "3.0.0.1", t) {
+		t.Fatal("Expected an address in another country to be denied")
+	}
+
+	if err := wl.Close(); err != nil || !db.closed {
+		t.Fatalf("Expected the database to be closed, have %v", err)
+	}
+
+	// Databases that needn't be closed are accepted.
+	static := NewGeoACL(staticCountryDB("GB"), []string{"gb"}, false)
+	if !checkIPString(static, "4.0.0.1", t) {
+		t.Fatal("Expected the address to be permitted")
+	}
+
+	if err := static.Close(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
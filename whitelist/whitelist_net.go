@@ -5,11 +5,14 @@ package whitelist
 // that is needed to support network whitelists.
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 // A NetACL stores a list of permitted IP networks.
@@ -32,6 +35,64 @@ type NetACL interface {
 type BasicNet struct {
 	lock      *sync.Mutex
 	whitelist []*net.IPNet
+	labels    map[string]string
+	onChange  func()
+	modified  time.Time
+
+	// matchers holds the whitelist in the precomputed form used
+	// by Permitted. Methods that modify the whitelist clear
+	// compiled, and it is rebuilt on the next lookup.
+	matchers []netMatcher
+	compiled bool
+}
+
+// OnChange registers fn to be called after each call that modifies
+// the whitelist, such as Add or Remove, replacing any function
+// registered earlier; a nil fn removes it. It is called once the
+// whitelist's lock has been released, so it may safely call back
+// into the whitelist, and it sees the modification that triggered
+// it. fn is called even if the call didn't change the whitelist,
+// e.g. when adding an entry that is already present.
+func (wl *BasicNet) OnChange(fn func()) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.onChange = fn
+}
+
+// changed records the modification time and calls the OnChange
+// function, if any. Modifying methods defer it before taking the
+// lock, so that it runs after the lock is released.
+func (wl *BasicNet) changed() {
+	wl.lock.Lock()
+	wl.modified = time.Now()
+	fn := wl.onChange
+	wl.lock.Unlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// Stats returns the number of entries in the whitelist and the time
+// it was last modified.
+func (wl *BasicNet) Stats() Stats {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return Stats{
+		Entries:  len(wl.whitelist),
+		Modified: wl.modified,
+	}
+}
+
+// netKey returns the canonical string form of a network, used to
+// compare entries: networks written with host bits set, or with an
+// IPv4 address in its 16-byte form, compare equal to their canonical
+// form.
+func netKey(n *net.IPNet) string {
+	if cn := canonicalNet(n); cn != nil {
+		return cn.String()
+	}
+	return n.String()
 }
 
 // Permitted returns true if the IP has been whitelisted.
@@ -40,10 +101,59 @@ func (wl *BasicNet) Permitted(ip net.IP) bool {
 		return false
 	}
 
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	if !wl.compiled {
+		wl.matchers = compileNets(wl.matchers[:0], wl.whitelist)
+		wl.compiled = true
+	}
+
+	for i := range wl.matchers {
+		if wl.matchers[i].contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LongestMatch returns the most specific (longest-prefix) whitelisted
+// network containing the IP, i.e. the entry that governs it. The
+// second return value is false if no network contains the IP.
+func (wl *BasicNet) LongestMatch(ip net.IP) (*net.IPNet, bool) {
+	if !validIP(ip) {
+		return nil, false
+	}
+
+	var best *net.IPNet
+	bestOnes := -1
+
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
 	for i := range wl.whitelist {
-		if wl.whitelist[i].Contains(ip) {
+		ones, _ := wl.whitelist[i].Mask.Size()
+		if ones > bestOnes && wl.whitelist[i].Contains(ip) {
+			best, bestOnes = wl.whitelist[i], ones
+		}
+	}
+	return best, best != nil
+}
+
+// PermittedWithinPrefix returns true if the IP is contained in a
+// whitelisted network whose prefix is at least minPrefixLen bits
+// long. Broader networks are ignored, so that an address isn't
+// permitted solely because it falls within, say, a whitelisted /8.
+// The prefix length is that of the network itself, so IPv4 and IPv6
+// networks are measured against the same threshold.
+func (wl *BasicNet) PermittedWithinPrefix(ip net.IP, minPrefixLen int) bool {
+	if !validIP(ip) {
+		return false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	for i := range wl.whitelist {
+		ones, _ := wl.whitelist[i].Mask.Size()
+		if ones >= minPrefixLen && wl.whitelist[i].Contains(ip) {
 			return true
 		}
 	}
@@ -59,22 +169,224 @@ func (wl *BasicNet) Add(n *net.IPNet) {
 		return
 	}
 
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
+	wl.compiled = false
 	wl.whitelist = append(wl.whitelist, n)
 }
 
-// Remove removes a network from the whitelist.
+// ReplaceAll atomically replaces the contents of the whitelist with
+// the given networks, so that concurrent lookups see either the old
+// or the new whitelist and never a partially loaded one. Nil
+// networks are skipped. Labels are kept for networks that remain
+// whitelisted.
+func (wl *BasicNet) ReplaceAll(nets []*net.IPNet) {
+	whitelist := make([]*net.IPNet, 0, len(nets))
+	keys := make(map[string]bool, len(nets))
+	for _, n := range nets {
+		if n != nil {
+			whitelist = append(whitelist, n)
+			keys[netKey(n)] = true
+		}
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+	wl.whitelist = whitelist
+	for key := range wl.labels {
+		if !keys[key] {
+			delete(wl.labels, key)
+		}
+	}
+}
+
+// AddIfAbsent adds a new network to the whitelist, returning true if
+// the exact network was not already present. As with Add, a network
+// that overlaps an existing entry is still added.
+func (wl *BasicNet) AddIfAbsent(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+	for i := range wl.whitelist {
+		if netKey(wl.whitelist[i]) == netKey(n) {
+			return false
+		}
+	}
+
+	wl.whitelist = append(wl.whitelist, n)
+	return true
+}
+
+// AddMerging adds a new network to the whitelist, dropping any
+// existing entries that are entirely contained within it, as they
+// are now redundant. The addresses permitted by the whitelist are the
+// same as if Add had been called.
+func (wl *BasicNet) AddMerging(n *net.IPNet) {
+	r, ok := networkRange(n)
+	if !ok {
+		return
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+
+	kept := wl.whitelist[:0]
+	for _, entry := range wl.whitelist {
+		if er, ok := networkRange(entry); ok && r.contains(er) {
+			delete(wl.labels, netKey(entry))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	wl.whitelist = append(kept, n)
+}
+
+// AddLabeled adds a new network to the whitelist, recording a label
+// describing why it is whitelisted (e.g. "partner-x").
+func (wl *BasicNet) AddLabeled(n *net.IPNet, label string) {
+	if n == nil {
+		return
+	}
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+	wl.whitelist = append(wl.whitelist, n)
+	if wl.labels == nil {
+		wl.labels = map[string]string{}
+	}
+	wl.labels[netKey(n)] = label
+}
+
+// Label returns the label of the first whitelisted network that
+// contains the IP. The second return value is false if no network
+// contains the IP, or the network wasn't added with a label.
+func (wl *BasicNet) Label(ip net.IP) (string, bool) {
+	if !validIP(ip) {
+		return "", false
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	for i := range wl.whitelist {
+		if wl.whitelist[i].Contains(ip) {
+			label, ok := wl.labels[netKey(wl.whitelist[i])]
+			return label, ok
+		}
+	}
+	return "", false
+}
+
+// hostNet returns the single-host network for the IP: a /32 for an
+// IPv4 address, or a /128 for an IPv6 address.
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// AddHost adds a single host to the whitelist, as a /32 network for
+// an IPv4 address or a /128 network for an IPv6 address.
+func (wl *BasicNet) AddHost(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+	wl.Add(hostNet(ip))
+}
+
+// RemoveHost removes a single host added with AddHost (or as a /32 or
+// /128 network) from the whitelist.
+func (wl *BasicNet) RemoveHost(ip net.IP) {
+	if !validIP(ip) {
+		return
+	}
+	wl.Remove(hostNet(ip))
+}
+
+// DefaultIPv6SubnetLen is the prefix length of the subnet typically
+// assigned to a single IPv6 customer, and the default used by
+// AddHost6AsSubnet and PermittedSubnet6.
+const DefaultIPv6SubnetLen = 64
+
+// subnet6 returns the IPv6 subnet of the given prefix length that
+// contains ip, or nil if ip is not an IPv6 address. A prefix length
+// outside (0, 128] is replaced by DefaultIPv6SubnetLen.
+func subnet6(ip net.IP, prefixLen int) *net.IPNet {
+	if !validIP(ip) || ip.To4() != nil {
+		return nil
+	}
+
+	if prefixLen <= 0 || prefixLen > 128 {
+		prefixLen = DefaultIPv6SubnetLen
+	}
+
+	mask := net.CIDRMask(prefixLen, 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// AddHost6AsSubnet whitelists the subnet containing an IPv6 host
+// rather than the exact address, as ISPs usually assign a whole
+// subnet (typically a /64) to each customer, and hosts may rotate
+// the rest of their address. If prefixLen is not between 1 and 128,
+// DefaultIPv6SubnetLen is used. An IPv4 address is added as a single
+// host, as with AddHost.
+func (wl *BasicNet) AddHost6AsSubnet(ip net.IP, prefixLen int) {
+	if n := subnet6(ip, prefixLen); n != nil {
+		wl.Add(n)
+		return
+	}
+	wl.AddHost(ip)
+}
+
+// PermittedSubnet6 is like Permitted, but matches an IPv6 address at
+// the granularity of the subnet of the given prefix length that
+// contains it: the address is permitted if any whitelisted network
+// overlaps that subnet. This avoids denying a client whose exact
+// address was whitelisted but has since rotated within its subnet.
+// If prefixLen is not between 1 and 128, DefaultIPv6SubnetLen is
+// used. IPv4 addresses are matched as by Permitted.
+func (wl *BasicNet) PermittedSubnet6(ip net.IP, prefixLen int) bool {
+	sn := subnet6(ip, prefixLen)
+	if sn == nil {
+		return wl.Permitted(ip)
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	for _, n := range wl.whitelist {
+		if n.Contains(sn.IP) || sn.Contains(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove removes a network, and any label, from the whitelist.
 func (wl *BasicNet) Remove(n *net.IPNet) {
 	if n == nil {
 		return
 	}
 
 	index := -1
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
+	wl.compiled = false
 	for i := range wl.whitelist {
-		if wl.whitelist[i].String() == n.String() {
+		if netKey(wl.whitelist[i]) == netKey(n) {
 			index = i
 			break
 		}
@@ -84,6 +396,7 @@ func (wl *BasicNet) Remove(n *net.IPNet) {
 		return
 	}
 
+	delete(wl.labels, netKey(n))
 	wl.whitelist = append(wl.whitelist[:index], wl.whitelist[index+1:]...)
 }
 
@@ -94,51 +407,358 @@ func NewBasicNet() *BasicNet {
 	}
 }
 
-// MarshalJSON serialises a network whitelist to a comma-separated
-// list of networks.
-func (wl *BasicNet) MarshalJSON() ([]byte, error) {
-	var ss = make([]string, 0, len(wl.whitelist))
-	for i := range wl.whitelist {
-		ss = append(ss, wl.whitelist[i].String())
+// Validate checks that the whitelist is usable: it must be non-empty,
+// with no nil or malformed entries, and no entry may cover an entire
+// address space (e.g. 0.0.0.0/0, ::ffff:0:0/96, or ::/0). It is
+// intended to be called after loading a whitelist, as a guard
+// against a configuration that would deny or permit everyone. To
+// also reject networks that are merely too broad, use
+// ValidateMaxPrefix.
+func (wl *BasicNet) Validate() error {
+	return wl.ValidateMaxPrefix(0, 0)
+}
+
+// prefixLen returns the prefix length of n, and whether n matches
+// IPv4 addresses. A v4-mapped IPv6 network, such as ::ffff:0:0/96,
+// matches IPv4 addresses, so its length is that of the IPv4 network
+// it covers (0.0.0.0/0 in this case).
+func prefixLen(n *net.IPNet) (ones int, v4 bool) {
+	ones, bits := n.Mask.Size()
+	if bits == 128 && n.IP.To4() != nil {
+		if ones -= 96; ones < 0 {
+			ones = 0
+		}
+		return ones, true
 	}
+	return ones, bits == 32
+}
 
-	out := []byte(`"` + strings.Join(ss, ",") + `"`)
-	return out, nil
+// ValidateMaxPrefix makes the checks of Validate, and also checks
+// that no entry is broader than the policy allows: IPv4 networks
+// must have a prefix length of at least v4, and IPv6 networks a
+// prefix length of at least v6. A v4-mapped IPv6 network is held to
+// the IPv4 limit, measured on the IPv4 network it covers. A
+// non-positive limit disables the check for that address family.
+// The returned error lists every entry that is too broad, so that a
+// risky configuration, such as a mistyped 10.0.0.0/8, can be
+// rejected when it is loaded.
+func (wl *BasicNet) ValidateMaxPrefix(v4, v6 int) error {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	if len(wl.whitelist) == 0 {
+		return errors.New("whitelist: whitelist is empty")
+	}
+
+	var broad []string
+	for i, n := range wl.whitelist {
+		if n == nil {
+			return fmt.Errorf("whitelist: entry %d is nil", i)
+		}
+
+		if _, ok := networkRange(n); !ok {
+			return fmt.Errorf("whitelist: entry %d (%s) is not a valid network", i, n)
+		}
+
+		ones, v4Net := prefixLen(n)
+		if ones == 0 {
+			return fmt.Errorf("whitelist: entry %d (%s) permits every address", i, n)
+		}
+
+		if (v4Net && v4 > 0 && ones < v4) || (!v4Net && v6 > 0 && ones < v6) {
+			broad = append(broad, fmt.Sprintf("%q", n.String()))
+		}
+	}
+
+	if len(broad) > 0 {
+		return fmt.Errorf("whitelist: networks broader than the maximum prefix length: %s", strings.Join(broad, ", "))
+	}
+	return nil
 }
 
-// UnmarshalJSON implements the json.Unmarshaler interface for network
-// whitelists, taking a comma-separated string of networks.
-func (wl *BasicNet) UnmarshalJSON(in []byte) error {
-	if in[0] != '"' || in[len(in)-1] != '"' {
-		return errors.New("whitelist: invalid whitelist")
+// Normalize rewrites the whitelist into canonical form, such as
+// after migrating entries from a legacy store: nil and invalid
+// networks are dropped, every other network is rewritten with its
+// host bits cleared, and duplicates are removed, keeping the first
+// occurrence. Networks that merely overlap are left alone. Normalize
+// returns the number of entries removed; calling it again returns
+// zero.
+func (wl *BasicNet) Normalize() int {
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+
+	whitelist := make([]*net.IPNet, 0, len(wl.whitelist))
+	seen := make(map[string]bool, len(wl.whitelist))
+	var labels map[string]string
+	for _, n := range wl.whitelist {
+		cn := canonicalNet(n)
+		if cn == nil {
+			continue
+		}
+
+		key := cn.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		whitelist = append(whitelist, cn)
+
+		if label, ok := wl.labels[key]; ok {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[key] = label
+		}
 	}
 
-	if wl.lock == nil {
-		wl.lock = new(sync.Mutex)
+	removed := len(wl.whitelist) - len(whitelist)
+	wl.whitelist = whitelist
+	wl.labels = labels
+	return removed
+}
+
+// MarshalText serialises a network whitelist to a comma-separated
+// list of networks, implementing the encoding.TextMarshaler interface.
+func (wl *BasicNet) MarshalText() ([]byte, error) {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	var ss = make([]string, 0, len(wl.whitelist))
+	for i := range wl.whitelist {
+		ss = append(ss, wl.whitelist[i].String())
 	}
 
+	return []byte(strings.Join(ss, ",")), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface for
+// network whitelists, taking a comma-separated list of networks.
+func (wl *BasicNet) UnmarshalText(in []byte) error {
+	initLock(&wl.lock)
+
+	defer wl.changed()
 	wl.lock.Lock()
 	defer wl.lock.Unlock()
+	wl.compiled = false
 
-	var err error
-	netString := strings.TrimSpace(string(in[1 : len(in)-1]))
+	netString := strings.TrimSpace(string(in))
 	nets := strings.Split(netString, ",")
-	wl.whitelist = make([]*net.IPNet, len(nets))
+	wl.whitelist = make([]*net.IPNet, 0, len(nets))
+	wl.labels = nil
 	for i := range nets {
 		addr := strings.TrimSpace(nets[i])
 		if addr == "" {
 			continue
 		}
-		_, wl.whitelist[i], err = net.ParseCIDR(addr)
+
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			wl.whitelist = nil
+			return err
+		}
+		wl.whitelist = append(wl.whitelist, n)
+	}
+
+	return nil
+}
+
+// MarshalJSON serialises a network whitelist to a comma-separated
+// list of networks. If any network has a label, the whitelist is
+// instead serialised as an object mapping each network to its label.
+func (wl *BasicNet) MarshalJSON() ([]byte, error) {
+	var labels map[string]string
+	wl.lock.Lock()
+	if len(wl.labels) > 0 {
+		labels = make(map[string]string, len(wl.whitelist))
+		for i := range wl.whitelist {
+			key := netKey(wl.whitelist[i])
+			labels[key] = wl.labels[key]
+		}
+	}
+	wl.lock.Unlock()
+
+	if labels != nil {
+		return json.Marshal(labels)
+	}
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(`"` + string(out) + `"`), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for network
+// whitelists, taking either a comma-separated string of networks or
+// an object mapping networks to labels.
+func (wl *BasicNet) UnmarshalJSON(in []byte) error {
+	text, labels, err := unmarshalJSONList(in)
+	if err != nil {
+		return err
+	}
+
+	if labels != nil {
+		return wl.unmarshalLabels(labels)
+	}
+	return wl.UnmarshalText([]byte(text))
+}
+
+// unmarshalLabels replaces the whitelist with the networks in
+// labels. Networks with an empty label are whitelisted without a
+// label.
+func (wl *BasicNet) unmarshalLabels(labels map[string]string) error {
+	initLock(&wl.lock)
+
+	defer wl.changed()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.compiled = false
+
+	wl.whitelist = make([]*net.IPNet, 0, len(labels))
+	wl.labels = map[string]string{}
+	for addr, label := range labels {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(addr))
 		if err != nil {
 			wl.whitelist = nil
+			wl.labels = nil
 			return err
 		}
+
+		wl.whitelist = append(wl.whitelist, n)
+		if label != "" {
+			wl.labels[netKey(n)] = label
+		}
 	}
 
+	sortNets(wl.whitelist)
 	return nil
 }
 
+// DumpBasicNetAggregated returns a network whitelist as a byte slice
+// where each network is on its own line. Overlapping and adjacent
+// networks are coalesced into the smallest set of networks that
+// covers exactly the same addresses; IPv4 networks are listed
+// before IPv6 networks, and each family is sorted by address.
+func DumpBasicNetAggregated(wl *BasicNet) []byte {
+	wl.lock.Lock()
+	nets := aggregateNetworks(wl.whitelist)
+	wl.lock.Unlock()
+
+	var ss = make([]string, 0, len(nets))
+	for i := range nets {
+		ss = append(ss, nets[i].String())
+	}
+
+	return []byte(strings.Join(ss, "\n"))
+}
+
+// Complement returns the smallest set of networks that covers every
+// address in parent that isn't permitted by the whitelist, in
+// ascending order. This is the inverse of DumpBasicNetAggregated,
+// and is useful for generating deny rules from a whitelist, or for
+// auditing a block that is meant to be fully whitelisted: an empty
+// result means that there are no holes in its coverage. Only
+// whitelisted networks in the same address family as parent are
+// considered; if none of them overlap parent, the result is parent
+// itself.
+func (wl *BasicNet) Complement(parent *net.IPNet) ([]*net.IPNet, error) {
+	pr, ok := networkRange(parent)
+	if !ok {
+		return nil, errors.New("whitelist: invalid parent network")
+	}
+
+	wl.lock.Lock()
+	ranges := make([]ipRange, 0, len(wl.whitelist))
+	for _, n := range wl.whitelist {
+		if r, ok := networkRange(n); ok {
+			ranges = append(ranges, r)
+		}
+	}
+	wl.lock.Unlock()
+
+	var nets []*net.IPNet
+	for _, r := range complementRanges(pr, mergeRanges(ranges)) {
+		nets = append(nets, rangeNetworks(r)...)
+	}
+	return nets, nil
+}
+
+// Affected returns the entries in the whitelist, other than n
+// itself, that overlap n: the entries it contains and the entries
+// that contain it, in whitelist order. It is intended for reviewing
+// the removal of a broad network. The whitelist isn't modified.
+func (wl *BasicNet) Affected(n *net.IPNet) []*net.IPNet {
+	if n == nil {
+		return nil
+	}
+
+	key := netKey(n)
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	var affected []*net.IPNet
+	for _, entry := range wl.whitelist {
+		if netKey(entry) == key {
+			continue
+		}
+
+		if entry.Contains(n.IP) || n.Contains(entry.IP) {
+			affected = append(affected, entry)
+		}
+	}
+	return affected
+}
+
+// DeniedWithout returns the IPs, from a sample such as recent client
+// addresses, that are permitted by the whitelist now but would be
+// denied if n were removed with Remove. Addresses also covered by
+// another entry are still permitted, and are not returned. The
+// whitelist isn't modified.
+func (wl *BasicNet) DeniedWithout(n *net.IPNet, ips []net.IP) []net.IP {
+	if n == nil {
+		return nil
+	}
+
+	key := netKey(n)
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+
+	// As with Remove, only the first matching entry is dropped.
+	index := -1
+	for i := range wl.whitelist {
+		if netKey(wl.whitelist[i]) == key {
+			index = i
+			break
+		}
+	}
+
+	if index == -1 {
+		return nil
+	}
+
+	var denied []net.IP
+	for _, ip := range ips {
+		if !validIP(ip) || !wl.whitelist[index].Contains(ip) {
+			continue
+		}
+
+		covered := false
+		for i, entry := range wl.whitelist {
+			if i != index && entry.Contains(ip) {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			denied = append(denied, ip)
+		}
+	}
+	return denied
+}
+
 // NetStub allows network whitelisting to be added into a system's
 // flow without doing anything yet. All operations result in warning
 // log messages being printed to stderr. There is no mechanism for
@@ -149,7 +769,7 @@ type NetStub struct{}
 // Permitted always returns true, but prints a warning message alerting
 // that whitelisting is stubbed.
 func (wl NetStub) Permitted(ip net.IP) bool {
-	log.Printf("WARNING: whitelist check for %s but whitelisting is stubbed", ip)
+	log.Printf("WARNING: whitelist check for %s but whitelisting is stubbed", logIP(ip))
 	return true
 }
 
@@ -3,6 +3,8 @@ package whitelist
 import (
 	"encoding/json"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -49,6 +51,15 @@ func TestMarshalNetFail(t *testing.T) {
 	}
 }
 
+func TestMarshalNetFailShort(t *testing.T) {
+	wl := NewBasicNet()
+	for _, badInput := range []string{``, `"`, `127.0.0.1`} {
+		if err := wl.UnmarshalJSON([]byte(badInput)); err == nil {
+			t.Fatalf("Expected failure unmarshaling %q.", badInput)
+		}
+	}
+}
+
 var testNet *BasicNet
 
 func testAddNet(wl NetACL, ns string, t *testing.T) {
@@ -90,3 +101,651 @@ func TestFailPermitted(t *testing.T) {
 		t.Fatal("Expected failure checking invalid IP address.")
 	}
 }
+
+func TestDumpBasicNetAggregated(t *testing.T) {
+	wl := NewBasicNet()
+	for _, ns := range []string{
+		"192.168.1.0/24",
+		"10.0.0.0/8",
+		"192.168.0.0/24",
+		"192.168.1.128/25",
+		"192.168.2.0/24",
+		"10.1.0.0/16",
+		"2001:db8::/33",
+		"2001:db8:8000::/33",
+		"0.0.0.0/32",
+	} {
+		testAddNet(wl, ns, t)
+	}
+
+	expected := "0.0.0.0/32\n10.0.0.0/8\n192.168.0.0/23\n192.168.2.0/24\n2001:db8::/32"
+	out := string(DumpBasicNetAggregated(wl))
+	if out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	if len(wl.whitelist) != 9 {
+		t.Fatal("Aggregating a dump should not modify the whitelist.")
+	}
+}
+
+func TestDumpBasicNetAggregatedEdges(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "255.255.255.0/24", t)
+	testAddNet(wl, "255.255.254.255/32", t)
+	testAddNet(wl, "255.255.255.255/32", t)
+
+	expected := "255.255.254.255/32\n255.255.255.0/24"
+	out := string(DumpBasicNetAggregated(wl))
+	if out != expected {
+		t.Fatalf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+
+	if out = string(DumpBasicNetAggregated(NewBasicNet())); out != "" {
+		t.Fatalf("Expected an empty dump, but got %s", out)
+	}
+}
+
+func TestTextNet(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "10.0.0.0/8", t)
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != "192.168.3.0/24,10.0.0.0/8" {
+		t.Fatalf("Expected 192.168.3.0/24,10.0.0.0/8, but got %s", out)
+	}
+
+	var wlPrime BasicNet
+	if err = wlPrime.UnmarshalText([]byte("192.168.3.0/24,,10.0.0.0/8")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(wlPrime.whitelist) != 2 {
+		t.Fatalf("Expected 2 networks, but have %d", len(wlPrime.whitelist))
+	}
+
+	if !checkIPString(&wlPrime, "10.1.2.3", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if err = wlPrime.UnmarshalText([]byte("192.168.3.1")); err == nil {
+		t.Fatal("Expected failure unmarshaling bad text input.")
+	}
+}
+
+func TestAddIfAbsentNet(t *testing.T) {
+	wl := NewBasicNet()
+	_, n, err := net.ParseCIDR("192.168.3.0/24")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !wl.AddIfAbsent(n) {
+		t.Fatal("Expected network to be newly added")
+	}
+
+	_, n, err = net.ParseCIDR("192.168.3.1/24")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if wl.AddIfAbsent(n) {
+		t.Fatal("Expected network to already be present")
+	}
+
+	if len(wl.whitelist) != 1 {
+		t.Fatalf("Expected 1 network, but have %d", len(wl.whitelist))
+	}
+
+	if wl.AddIfAbsent(nil) {
+		t.Fatal("Expected a nil network not to be added")
+	}
+}
+
+func TestValidateNet(t *testing.T) {
+	wl := NewBasicNet()
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected an empty whitelist to fail validation.")
+	}
+
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "2001:db8::/32", t)
+	if err := wl.Validate(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testAddNet(wl, "::/0", t)
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected a default route to fail validation.")
+	}
+
+	testDelNet(wl, "::/0", t)
+	testAddNet(wl, "::ffff:0:0/96", t)
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected a network covering every IPv4 address to fail validation.")
+	}
+
+	testDelNet(wl, "::ffff:0:0/96", t)
+	wl.whitelist = append(wl.whitelist, &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}})
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected a non-canonical mask to fail validation.")
+	}
+
+	wl.whitelist[2] = nil
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected a nil entry to fail validation.")
+	}
+}
+
+func TestValidateMaxPrefix(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "172.16.0.0/16", t)
+	testAddNet(wl, "2001:db8::/48", t)
+	if err := wl.ValidateMaxPrefix(16, 48); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "2001:db8::/32", t)
+	err := wl.ValidateMaxPrefix(16, 48)
+	if err == nil {
+		t.Fatal("Expected broad networks to fail validation.")
+	}
+
+	for _, n := range []string{"10.0.0.0/8", "2001:db8::/32"} {
+		if !strings.Contains(err.Error(), n) {
+			t.Fatalf("Expected the error to list %s, have %v", n, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "172.16.0.0/16") {
+		t.Fatalf("Expected a network at the limit to pass, have %v", err)
+	}
+
+	err = wl.ValidateMaxPrefix(16, 0)
+	if err == nil || strings.Contains(err.Error(), "2001:db8::/32") {
+		t.Fatalf("Expected only the IPv4 limit to apply, have %v", err)
+	}
+
+	if err = wl.ValidateMaxPrefix(0, 0); err != nil {
+		t.Fatalf("Expected no limits to pass, have %v", err)
+	}
+
+	// A v4-mapped network permits IPv4 addresses, so it is held to
+	// the IPv4 limit.
+	wl = NewBasicNet()
+	testAddNet(wl, "::ffff:10.0.0.0/104", t)
+	if !checkIPString(wl, "10.1.1.1", t) {
+		t.Fatal("Expected the v4-mapped network to permit IPv4 addresses")
+	}
+
+	// The network is listed as the IPv4 network it covers.
+	if err = wl.ValidateMaxPrefix(16, 48); err == nil || !strings.Contains(err.Error(), "10.0.0.0/8") {
+		t.Fatalf("Expected a v4-mapped network to fail the IPv4 limit, have %v", err)
+	}
+
+	if err = NewBasicNet().ValidateMaxPrefix(16, 48); err == nil {
+		t.Fatal("Expected an empty whitelist to fail validation.")
+	}
+
+	wl = NewBasicNet()
+	testAddNet(wl, "::ffff:10.1.0.0/112", t)
+	if err = wl.ValidateMaxPrefix(16, 120); err != nil {
+		t.Fatalf("Expected a v4-mapped /16 to pass, have %v", err)
+	}
+}
+
+func TestAddMerging(t *testing.T) {
+	wl := NewBasicNet()
+	for _, ns := range []string{"10.1.0.0/16", "192.168.3.0/24", "10.2.0.0/16", "10.0.0.0/8", "::/0"} {
+		testAddNet(wl, ns, t)
+	}
+
+	probes := []string{"10.1.2.3", "10.2.3.4", "10.3.4.5", "192.168.3.1", "192.168.4.1", "::1"}
+	before := map[string]bool{}
+	for _, addr := range probes {
+		before[addr] = checkIPString(wl, addr, t)
+	}
+
+	_, n, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	wl.AddMerging(n)
+	wl.AddMerging(nil)
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != "192.168.3.0/24,::/0,10.0.0.0/8" {
+		t.Fatalf("Expected contained networks to be dropped, but have %s", out)
+	}
+
+	for _, addr := range probes {
+		if checkIPString(wl, addr, t) != before[addr] {
+			t.Fatalf("Coverage of %s changed after merging", addr)
+		}
+	}
+}
+
+func TestLabelNet(t *testing.T) {
+	wl := NewBasicNet()
+	_, n, err := net.ParseCIDR("192.168.3.0/24")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	wl.AddLabeled(n, "partner-x")
+	testAddNet(wl, "10.0.0.0/8", t)
+
+	if label, ok := wl.Label(net.ParseIP("192.168.3.1")); !ok || label != "partner-x" {
+		t.Fatalf("Expected label partner-x, but have %q", label)
+	}
+
+	if _, ok := wl.Label(net.ParseIP("10.0.0.1")); ok {
+		t.Fatal("Expected no label for an unlabeled network")
+	}
+
+	out, err := json.Marshal(wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := `{"10.0.0.0/8":"","192.168.3.0/24":"partner-x"}`
+	if string(out) != expected {
+		t.Fatalf("Expected %s, but got %s", expected, out)
+	}
+
+	var wlPrime BasicNet
+	if err = json.Unmarshal(out, &wlPrime); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if label, ok := wlPrime.Label(net.ParseIP("192.168.3.1")); !ok || label != "partner-x" {
+		t.Fatalf("Expected label partner-x, but have %q", label)
+	}
+
+	if err = wlPrime.UnmarshalJSON([]byte(`{"10.0.0.1":"bad"}`)); err == nil {
+		t.Fatal("Expected failure unmarshaling bad JSON input.")
+	}
+
+	wl.Remove(n)
+	if _, ok := wl.Label(net.ParseIP("192.168.3.1")); ok {
+		t.Fatal("Expected label to be removed with the network")
+	}
+}
+
+func TestPermittedWithinPrefix(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "10.1.2.0/24", t)
+	testAddNet(wl, "2001:db8::/32", t)
+
+	tv := []struct {
+		addr      string
+		prefixLen int
+		permitted bool
+	}{
+		{"10.1.2.3", 24, true},
+		{"10.1.2.3", 25, false},
+		{"10.9.9.9", 16, false},
+		{"10.9.9.9", 8, true},
+		{"2001:db8::1", 48, false},
+		{"2001:db8::1", 32, true},
+		{"192.168.3.1", 0, false},
+	}
+
+	for _, tc := range tv {
+		ip := net.ParseIP(tc.addr)
+		if wl.PermittedWithinPrefix(ip, tc.prefixLen) != tc.permitted {
+			t.Fatalf("Expected %s with minimum prefix /%d to be permitted=%v", tc.addr, tc.prefixLen, tc.permitted)
+		}
+	}
+
+	if wl.PermittedWithinPrefix(nil, 0) {
+		t.Fatal("whitelist should have denied an invalid address")
+	}
+}
+
+func testComplement(wl *BasicNet, parent string, t *testing.T) string {
+	_, n, err := net.ParseCIDR(parent)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	nets, err := wl.Complement(n)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ss := make([]string, 0, len(nets))
+	for i := range nets {
+		ss = append(ss, nets[i].String())
+	}
+	return strings.Join(ss, ",")
+}
+
+func TestComplement(t *testing.T) {
+	wl := NewBasicNet()
+	if out := testComplement(wl, "10.0.0.0/8", t); out != "10.0.0.0/8" {
+		t.Fatalf("Expected the parent network, but have %s", out)
+	}
+
+	testAddNet(wl, "10.0.0.0/9", t)
+	testAddNet(wl, "10.192.0.0/10", t)
+	testAddNet(wl, "10.160.0.0/11", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+	testAddNet(wl, "2001:db8::/33", t)
+
+	if out := testComplement(wl, "10.0.0.0/8", t); out != "10.128.0.0/11" {
+		t.Fatalf("Expected 10.128.0.0/11, but have %s", out)
+	}
+
+	if out := testComplement(wl, "10.0.0.0/9", t); out != "" {
+		t.Fatalf("Expected no networks, but have %s", out)
+	}
+
+	if out := testComplement(wl, "192.168.0.0/15", t); out != "192.169.0.0/16" {
+		t.Fatalf("Expected 192.169.0.0/16, but have %s", out)
+	}
+
+	if out := testComplement(wl, "2001:db8::/32", t); out != "2001:db8:8000::/33" {
+		t.Fatalf("Expected 2001:db8:8000::/33, but have %s", out)
+	}
+
+	expected := "0.0.0.0/5,8.0.0.0/7,10.128.0.0/11,11.0.0.0/8,12.0.0.0/6,16.0.0.0/4,32.0.0.0/3,64.0.0.0/2,128.0.0.0/2,192.0.0.0/9,192.128.0.0/11,192.160.0.0/13,192.169.0.0/16,192.170.0.0/15,192.172.0.0/14,192.176.0.0/12,192.192.0.0/10,193.0.0.0/8,194.0.0.0/7,196.0.0.0/6,200.0.0.0/5,208.0.0.0/4,224.0.0.0/3"
+	if out := testComplement(wl, "0.0.0.0/0", t); out != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	if _, err := wl.Complement(nil); err == nil {
+		t.Fatal("Expected failure with an invalid parent network.")
+	}
+}
+
+func TestAddHostNet(t *testing.T) {
+	wl := NewBasicNet()
+	wl.AddHost(net.ParseIP("10.0.0.1"))
+	wl.AddHost(net.ParseIP("2001:db8::1"))
+	wl.AddHost(nil)
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "10.0.0.2/32", t)
+
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "192.168.3.9"} {
+		if !checkIPString(wl, addr, t) {
+			t.Fatalf("whitelist should have permitted %s", addr)
+		}
+	}
+
+	for _, addr := range []string{"10.0.0.3", "2001:db8::2", "192.168.4.1"} {
+		if checkIPString(wl, addr, t) {
+			t.Fatalf("whitelist should have denied %s", addr)
+		}
+	}
+
+	wl.RemoveHost(net.ParseIP("10.0.0.2"))
+	wl.RemoveHost(net.ParseIP("2001:db8::1"))
+	wl.RemoveHost(nil)
+	if checkIPString(wl, "10.0.0.2", t) || checkIPString(wl, "2001:db8::1", t) {
+		t.Fatal("whitelist should have denied removed hosts")
+	}
+
+	// Removal matches networks in non-canonical forms.
+	wl.Remove(&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)})
+	wl.Remove(&net.IPNet{IP: net.ParseIP("192.168.3.7"), Mask: net.CIDRMask(24, 32)})
+	if len(wl.whitelist) != 0 {
+		t.Fatalf("Expected an empty whitelist, but have %d networks", len(wl.whitelist))
+	}
+}
+
+func TestLongestMatch(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "10.1.0.0/16", t)
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "10.1.2.0/24", t)
+	testAddNet(wl, "::/0", t)
+
+	tv := map[string]string{
+		"10.1.2.3":    "10.1.2.0/24",
+		"10.1.3.3":    "10.1.0.0/16",
+		"10.2.3.3":    "10.0.0.0/8",
+		"2001:db8::1": "::/0",
+	}
+
+	for addr, expected := range tv {
+		n, ok := wl.LongestMatch(net.ParseIP(addr))
+		if !ok || n.String() != expected {
+			t.Fatalf("Expected %s to match %s, but have %v", addr, expected, n)
+		}
+	}
+
+	if _, ok := wl.LongestMatch(net.ParseIP("192.168.3.1")); ok {
+		t.Fatal("Expected no match")
+	}
+
+	if _, ok := wl.LongestMatch(nil); ok {
+		t.Fatal("Expected no match for an invalid address")
+	}
+}
+
+func TestBasicNetReplaceAll(t *testing.T) {
+	_, n8, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n16, _ := net.ParseCIDR("192.168.0.0/16")
+	_, n24, _ := net.ParseCIDR("172.16.3.0/24")
+
+	wl := NewBasicNet()
+	wl.AddLabeled(n8, "internal")
+	wl.AddLabeled(n16, "office")
+
+	wl.ReplaceAll([]*net.IPNet{n8, n24, nil})
+	if !wl.Permitted(net.ParseIP("172.16.3.1")) || wl.Permitted(net.ParseIP("192.168.3.1")) {
+		t.Fatal("Expected the whitelist to be replaced")
+	}
+
+	if len(wl.whitelist) != 2 {
+		t.Fatalf("Expected 2 entries, have %d", len(wl.whitelist))
+	}
+
+	if label, _ := wl.Label(net.ParseIP("10.1.2.3")); label != "internal" || len(wl.labels) != 1 {
+		t.Fatal("Expected only the retained entry's label to be kept")
+	}
+
+	// Every replacement keeps 10.0.0.0/8, so a lookup must never
+	// see it missing.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !wl.Permitted(net.ParseIP("10.1.2.3")) {
+					t.Error("Lookup saw a partially replaced whitelist")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		wl.ReplaceAll([]*net.IPNet{n24, n8})
+		wl.ReplaceAll([]*net.IPNet{n8, n16})
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestIPv6Subnets(t *testing.T) {
+	wl := NewBasicNet()
+	wl.AddHost6AsSubnet(net.ParseIP("2001:db8:1:2:3:4:5:6"), 0)
+	wl.AddHost6AsSubnet(net.ParseIP("2001:db8:2::1"), 48)
+	wl.AddHost6AsSubnet(net.ParseIP("192.168.3.1"), 0)
+
+	expected := "192.168.3.1/32,2001:db8:1:2::/64,2001:db8:2::/48"
+	if out := strings.Join(wl.Entries(), ","); out != expected {
+		t.Fatalf("Expected %s, but got %s", expected, out)
+	}
+
+	wl = NewBasicNet()
+	wl.AddHost(net.ParseIP("2001:db8:1:2::1"))
+	wl.AddHost(net.ParseIP("192.168.3.1"))
+
+	tv := map[string]bool{
+		"2001:db8:1:2::1":       true,
+		"2001:db8:1:2:abcd::99": true,
+		"2001:db8:1:3::1":       false,
+		"192.168.3.1":           true,
+		"192.168.3.2":           false,
+	}
+
+	for addr, permitted := range tv {
+		if wl.PermittedSubnet6(net.ParseIP(addr), 64) != permitted {
+			t.Fatalf("Expected PermittedSubnet6(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if !wl.PermittedSubnet6(net.ParseIP("2001:db8:1:3::1"), 48) {
+		t.Fatal("Expected a match at a coarser prefix")
+	}
+}
+
+func TestBasicNetOnChange(t *testing.T) {
+	wl := NewBasicNet()
+	var changes int
+	var seen bool
+	wl.OnChange(func() {
+		changes++
+		// Calling back into the whitelist must not deadlock.
+		seen = wl.Permitted(net.ParseIP("10.1.2.3"))
+	})
+
+	testAddNet(wl, "10.0.0.0/8", t)
+	if changes != 1 || !seen {
+		t.Fatalf("Expected one change that sees the new entry, have %d", changes)
+	}
+
+	wl.AddHost(net.ParseIP("192.168.3.1"))
+	testDelNet(wl, "10.0.0.0/8", t)
+	if changes != 3 || seen {
+		t.Fatalf("Expected three changes, have %d", changes)
+	}
+
+	if err := wl.UnmarshalJSON([]byte(`{"10.0.0.0/8":"internal"}`)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl.ReplaceAll(nil)
+	if changes != 5 {
+		t.Fatalf("Expected five changes, have %d", changes)
+	}
+
+	wl.OnChange(nil)
+	testAddNet(wl, "10.0.0.0/8", t)
+	if changes != 5 {
+		t.Fatal("Expected no calls after the callback was removed")
+	}
+}
+
+func BenchmarkBasicNetPermitted(b *testing.B) {
+	wl := NewBasicNet()
+	wl.UnmarshalText([]byte("10.0.0.0/8,172.16.0.0/12,2001:db8::/32,192.168.0.0/16"))
+	ip := net.ParseIP("192.168.3.1")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		wl.Permitted(ip)
+	}
+}
+
+func TestBasicNetNormalize(t *testing.T) {
+	wl := NewBasicNet()
+	wl.AddLabeled(&net.IPNet{IP: net.ParseIP("192.168.3.7"), Mask: net.CIDRMask(24, 32)}, "office")
+	testAddNet(wl, "192.168.3.0/24", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+	testAddNet(wl, "2001:db8::/32", t)
+	wl.whitelist = append(wl.whitelist, nil,
+		&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}})
+
+	if removed := wl.Normalize(); removed != 3 {
+		t.Fatalf("Expected 3 entries to be removed, but have %d", removed)
+	}
+
+	out, _ := wl.MarshalText()
+	if expected := "192.168.3.0/24,192.168.0.0/16,2001:db8::/32"; string(out) != expected {
+		t.Fatalf("Expected %s, but have %s", expected, out)
+	}
+
+	if label, _ := wl.Label(net.IP{192, 168, 3, 1}); label != "office" {
+		t.Fatalf("Expected the label to be kept, but have %q", label)
+	}
+
+	if !wl.Permitted(net.IP{192, 168, 4, 1}) || wl.Permitted(net.IP{10, 0, 0, 1}) {
+		t.Fatal("Unexpected lookup result after normalizing")
+	}
+
+	if removed := wl.Normalize(); removed != 0 {
+		t.Fatalf("Expected Normalize to be idempotent, but it removed %d entries", removed)
+	}
+}
+
+func TestAffected(t *testing.T) {
+	wl := NewBasicNet()
+	testAddNet(wl, "10.0.0.0/8", t)
+	testAddNet(wl, "10.1.0.0/16", t)
+	testAddNet(wl, "10.1.2.0/24", t)
+	testAddNet(wl, "192.168.0.0/16", t)
+	testAddNet(wl, "2001:db8::/32", t)
+
+	_, n, _ := net.ParseCIDR("10.1.0.0/16")
+	affected := wl.Affected(n)
+	if len(affected) != 2 || affected[0].String() != "10.0.0.0/8" || affected[1].String() != "10.1.2.0/24" {
+		t.Fatalf("Unexpected affected entries %v", affected)
+	}
+
+	_, n, _ = net.ParseCIDR("172.16.0.0/12")
+	if affected = wl.Affected(n); len(affected) != 0 {
+		t.Fatalf("Expected no affected entries, but have %v", affected)
+	}
+
+	_, n, _ = net.ParseCIDR("10.0.0.0/8")
+	ips := []net.IP{
+		net.ParseIP("10.1.2.3"),
+		net.ParseIP("10.2.0.1"),
+		net.ParseIP("10.200.0.1"),
+		net.ParseIP("192.168.3.1"),
+		net.ParseIP("172.16.0.1"),
+		nil,
+	}
+
+	denied := wl.DeniedWithout(n, ips)
+	if len(denied) != 2 || !denied[0].Equal(ips[1]) || !denied[1].Equal(ips[2]) {
+		t.Fatalf("Unexpected addresses to be denied %v", denied)
+	}
+
+	// A duplicate entry keeps its addresses permitted.
+	testAddNet(wl, "10.0.0.0/8", t)
+	if denied = wl.DeniedWithout(n, ips); len(denied) != 0 {
+		t.Fatalf("Expected no addresses to be denied, but have %v", denied)
+	}
+
+	_, n, _ = net.ParseCIDR("172.16.0.0/12")
+	if denied = wl.DeniedWithout(n, ips); len(denied) != 0 {
+		t.Fatalf("Expected no addresses to be denied, but have %v", denied)
+	}
+
+	if len(wl.whitelist) != 6 {
+		t.Fatalf("Expected the whitelist to be unchanged, but have %d entries", len(wl.whitelist))
+	}
+}
@@ -0,0 +1,221 @@
+package whitelist
+
+// This file contains whitelists backed by the net/netip types.
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// netipAddr converts ip to a netip.Addr. IPv4-mapped IPv6 addresses
+// are converted to plain IPv4 addresses, so that both forms of an
+// IPv4 address compare equal. It returns false if ip is invalid.
+func netipAddr(ip net.IP) (netip.Addr, bool) {
+	if !validIP(ip) {
+		return netip.Addr{}, false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// canonicalPrefix masks the prefix and converts an IPv4-mapped IPv6
+// prefix to the equivalent IPv4 prefix. It returns false if the
+// prefix is invalid.
+func canonicalPrefix(p netip.Prefix) (netip.Prefix, bool) {
+	if !p.IsValid() {
+		return netip.Prefix{}, false
+	}
+
+	addr := p.Addr()
+	if addr.Is4In6() {
+		if p.Bits() < 96 {
+			// The prefix reaches outside the IPv4-mapped
+			// range, so it can't be expressed as IPv4.
+			return p.Masked(), true
+		}
+		p = netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), true
+}
+
+// netipPrefix converts n to a canonical netip.Prefix. It returns
+// false if n is nil or has a non-canonical mask.
+func netipPrefix(n *net.IPNet) (netip.Prefix, bool) {
+	if n == nil {
+		return netip.Prefix{}, false
+	}
+
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+
+	ip := n.IP
+	if bits == 32 {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	return canonicalPrefix(netip.PrefixFrom(addr, ones))
+}
+
+// BasicAddr is a host whitelist keyed by netip.Addr. It behaves like
+// Basic, but lookups don't allocate, and an IPv4 address matches
+// its IPv4-mapped IPv6 form (e.g. 127.0.0.1 and ::ffff:127.0.0.1)
+// however either was supplied. The netip methods may be used
+// directly to avoid converting from net.IP at all.
+type BasicAddr struct {
+	lock      *sync.Mutex
+	whitelist map[netip.Addr]bool
+}
+
+// NewBasicAddr returns a new initialised netip-backed host whitelist.
+func NewBasicAddr() *BasicAddr {
+	return &BasicAddr{
+		lock:      new(sync.Mutex),
+		whitelist: map[netip.Addr]bool{},
+	}
+}
+
+// PermittedAddr returns true if the address has been whitelisted.
+func (wl *BasicAddr) PermittedAddr(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+
+	addr = addr.Unmap()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return wl.whitelist[addr]
+}
+
+// AddAddr whitelists an address. Invalid addresses are ignored.
+func (wl *BasicAddr) AddAddr(addr netip.Addr) {
+	if !addr.IsValid() {
+		return
+	}
+
+	addr = addr.Unmap()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[addr] = true
+}
+
+// RemoveAddr clears an address from the whitelist.
+func (wl *BasicAddr) RemoveAddr(addr netip.Addr) {
+	addr = addr.Unmap()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	delete(wl.whitelist, addr)
+}
+
+// Permitted returns true if the IP has been whitelisted.
+func (wl *BasicAddr) Permitted(ip net.IP) bool {
+	addr, ok := netipAddr(ip)
+	return ok && wl.PermittedAddr(addr)
+}
+
+// Add whitelists an IP.
+func (wl *BasicAddr) Add(ip net.IP) {
+	if addr, ok := netipAddr(ip); ok {
+		wl.AddAddr(addr)
+	}
+}
+
+// Remove clears the IP from the whitelist.
+func (wl *BasicAddr) Remove(ip net.IP) {
+	if addr, ok := netipAddr(ip); ok {
+		wl.RemoveAddr(addr)
+	}
+}
+
+// BasicPrefix is a network whitelist of netip.Prefix values. It
+// behaves like BasicNet, except that prefixes are stored masked,
+// so that adding 10.1.2.3/8 and removing 10.0.0.0/8 leaves the
+// whitelist empty, and IPv4-mapped addresses and prefixes are
+// treated as IPv4.
+type BasicPrefix struct {
+	lock      *sync.Mutex
+	whitelist map[netip.Prefix]bool
+}
+
+// NewBasicPrefix returns a new initialised netip-backed network
+// whitelist.
+func NewBasicPrefix() *BasicPrefix {
+	return &BasicPrefix{
+		lock:      new(sync.Mutex),
+		whitelist: map[netip.Prefix]bool{},
+	}
+}
+
+// PermittedAddr returns true if the address is in a whitelisted
+// prefix.
+func (wl *BasicPrefix) PermittedAddr(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+
+	addr = addr.Unmap()
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	for p := range wl.whitelist {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddPrefix whitelists a prefix. Invalid prefixes are ignored.
+func (wl *BasicPrefix) AddPrefix(p netip.Prefix) {
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[p] = true
+}
+
+// RemovePrefix clears a prefix from the whitelist.
+func (wl *BasicPrefix) RemovePrefix(p netip.Prefix) {
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	delete(wl.whitelist, p)
+}
+
+// Permitted returns true if the IP is in a whitelisted network.
+func (wl *BasicPrefix) Permitted(ip net.IP) bool {
+	addr, ok := netipAddr(ip)
+	return ok && wl.PermittedAddr(addr)
+}
+
+// Add whitelists a network.
+func (wl *BasicPrefix) Add(n *net.IPNet) {
+	if p, ok := netipPrefix(n); ok {
+		wl.AddPrefix(p)
+	}
+}
+
+// Remove clears the network from the whitelist.
+func (wl *BasicPrefix) Remove(n *net.IPNet) {
+	if p, ok := netipPrefix(n); ok {
+		wl.RemovePrefix(p)
+	}
+}
@@ -0,0 +1,86 @@
+package whitelist
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+var (
+	_ HostACL = NewBasicAddr()
+	_ NetACL  = NewBasicPrefix()
+)
+
+func TestBasicAddr(t *testing.T) {
+	wl := NewBasicAddr()
+	wl.Add(net.ParseIP("127.0.0.1"))
+	wl.AddAddr(netip.MustParseAddr("::ffff:192.168.3.1"))
+	wl.AddAddr(netip.MustParseAddr("2001:db8::1"))
+
+	tv := map[string]bool{
+		"127.0.0.1":          true,
+		"::ffff:127.0.0.1":   true,
+		"192.168.3.1":        true,
+		"::ffff:192.168.3.1": true,
+		"2001:db8::1":        true,
+		"2001:db8::2":        false,
+		"10.0.0.1":           false,
+	}
+
+	for addr, permitted := range tv {
+		if wl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+
+		if wl.PermittedAddr(netip.MustParseAddr(addr)) != permitted {
+			t.Fatalf("Expected PermittedAddr(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if wl.Permitted(nil) || wl.PermittedAddr(netip.Addr{}) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+
+	wl.Remove(net.ParseIP("::ffff:127.0.0.1"))
+	if wl.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected 127.0.0.1 to be removed")
+	}
+}
+
+func TestBasicPrefix(t *testing.T) {
+	wl := NewBasicPrefix()
+	testAddNet(wl, "10.1.2.3/16", t)
+	testAddNet(wl, "2001:db8::/32", t)
+	wl.AddPrefix(netip.MustParsePrefix("::ffff:192.168.0.0/112"))
+
+	tv := map[string]bool{
+		"10.1.200.1":         true,
+		"::ffff:10.1.0.1":    true,
+		"10.2.0.1":           false,
+		"192.168.3.1":        true,
+		"2001:db8:1::1":      true,
+		"2001:db9::1":        false,
+		"::ffff:192.169.0.1": false,
+	}
+
+	for addr, permitted := range tv {
+		if wl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	testDelNet(wl, "10.1.0.0/16", t)
+	if wl.Permitted(net.ParseIP("10.1.200.1")) {
+		t.Fatal("Expected 10.1.0.0/16 to be removed")
+	}
+
+	wl.RemovePrefix(netip.MustParsePrefix("192.168.0.0/16"))
+	if wl.Permitted(net.ParseIP("192.168.3.1")) {
+		t.Fatal("Expected 192.168.0.0/16 to be removed")
+	}
+
+	wl.Add(nil)
+	if len(wl.whitelist) != 1 {
+		t.Fatalf("Expected one remaining prefix, have %d", len(wl.whitelist))
+	}
+}
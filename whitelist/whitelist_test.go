@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -148,6 +150,15 @@ func TestMarshalHostFail(t *testing.T) {
 	}
 }
 
+func TestMarshalHostFailShort(t *testing.T) {
+	wl := NewBasic()
+	for _, badInput := range []string{``, `"`, `127.0.0.1`} {
+		if err := wl.UnmarshalJSON([]byte(badInput)); err == nil {
+			t.Fatalf("Expected failure unmarshaling %q.", badInput)
+		}
+	}
+}
+
 var shutdown = make(chan struct{}, 1)
 var proceed = make(chan struct{}, 0)
 
@@ -248,6 +259,27 @@ func TestBasicFailedLoad(t *testing.T) {
 	}
 }
 
+func TestBasicLoadComments(t *testing.T) {
+	in := []byte("# office hosts\n\n192.168.1.5 # printer\n  10.0.1.15  \n\n")
+	wl, err := LoadBasic(in)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(wl, "192.168.1.5", t) || !checkIPString(wl, "10.0.1.15", t) {
+		t.Fatal("Expected both addresses to be loaded")
+	}
+
+	if label, _ := wl.Label(net.ParseIP("192.168.1.5")); label != "printer" {
+		t.Fatalf("Expected the comment to be the label, but have %q", label)
+	}
+
+	_, err = LoadBasic([]byte("192.168.1.5\n\n192.168.2 # typo\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("Expected an error for line 3, but have %v", err)
+	}
+}
+
 func TestNetConnChecks(t *testing.T) {
 	if _, err := NetConnLookup(nil); err == nil {
 		t.Fatal("Address should fail with an invalid argument")
@@ -264,6 +296,10 @@ func TestHTTPRequestLookup(t *testing.T) {
 		t.Fatal("Address should fail with an invalid argument")
 	}
 
+	req.RemoteAddr = "garbage:80"
+	if _, err := HTTPRequestLookup(req); err == nil {
+		t.Fatal("Address should fail with an invalid host")
+	}
 }
 
 type stubConn struct {
@@ -332,3 +368,397 @@ func TestValidIP(t *testing.T) {
 		t.Fatal("Failed to validate an IPv4 or an IPv6 address")
 	}
 }
+
+func TestTextHost(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "192.168.3.1", t)
+
+	out, err := wl.MarshalText()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if string(out) != "192.168.3.1" {
+		t.Fatalf("Expected 192.168.3.1, but got %s", out)
+	}
+
+	var wlPrime Basic
+	if err = wlPrime.UnmarshalText([]byte("192.168.3.1, ::1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !checkIPString(&wlPrime, "::1", t) || !checkIPString(&wlPrime, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if err = wlPrime.UnmarshalText([]byte("192.168.3.1/32")); err == nil {
+		t.Fatal("Expected failure unmarshaling bad text input.")
+	}
+}
+
+func TestPermittedAllAny(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "127.0.0.1", t)
+	addIPString(wl, "10.0.1.15", t)
+
+	all := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("10.0.1.15")}
+	some := []net.IP{net.ParseIP("192.168.1.5"), net.ParseIP("10.0.1.15")}
+	none := []net.IP{net.ParseIP("192.168.1.5"), nil}
+
+	if !PermittedAll(wl, all) || !PermittedAny(wl, all) {
+		t.Fatal("whitelist should have permitted every address")
+	}
+
+	if PermittedAll(wl, some) || !PermittedAny(wl, some) {
+		t.Fatal("whitelist should have permitted only some addresses")
+	}
+
+	if PermittedAll(wl, none) || PermittedAny(wl, none) {
+		t.Fatal("whitelist should have denied every address")
+	}
+
+	if PermittedAll(wl, nil) || PermittedAny(wl, []net.IP{}) {
+		t.Fatal("whitelist should deny an empty address list")
+	}
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	wl := NewBasic()
+	ip := net.ParseIP("192.168.3.1")
+
+	if !wl.AddIfAbsent(ip) {
+		t.Fatal("Expected address to be newly added")
+	}
+
+	if wl.AddIfAbsent(ip) {
+		t.Fatal("Expected address to already be present")
+	}
+
+	if !wl.Permitted(ip) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if wl.AddIfAbsent(nil) {
+		t.Fatal("Expected an invalid address not to be added")
+	}
+}
+
+func TestValidateHost(t *testing.T) {
+	wl := NewBasic()
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected an empty whitelist to fail validation.")
+	}
+
+	addIPString(wl, "127.0.0.1", t)
+	if err := wl.Validate(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl.whitelist["127.0.0"] = true
+	if err := wl.Validate(); err == nil {
+		t.Fatal("Expected an invalid address to fail validation.")
+	}
+}
+
+func TestLabelHost(t *testing.T) {
+	wl := NewBasic()
+	wl.AddLabeled(net.ParseIP("192.168.3.1"), "office-vpn")
+	addIPString(wl, "127.0.0.1", t)
+
+	if label, ok := wl.Label(net.ParseIP("192.168.3.1")); !ok || label != "office-vpn" {
+		t.Fatalf("Expected label office-vpn, but have %q", label)
+	}
+
+	if _, ok := wl.Label(net.ParseIP("127.0.0.1")); ok {
+		t.Fatal("Expected no label for an unlabeled address")
+	}
+
+	out, err := json.Marshal(wl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := `{"127.0.0.1":"","192.168.3.1":"office-vpn"}`
+	if string(out) != expected {
+		t.Fatalf("Expected %s, but got %s", expected, out)
+	}
+
+	var wlPrime Basic
+	if err = json.Unmarshal(out, &wlPrime); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if label, ok := wlPrime.Label(net.ParseIP("192.168.3.1")); !ok || label != "office-vpn" {
+		t.Fatalf("Expected label office-vpn, but have %q", label)
+	}
+
+	if !checkIPString(&wlPrime, "127.0.0.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if err = wlPrime.UnmarshalJSON([]byte(`{"127.0.0":"bad"}`)); err == nil {
+		t.Fatal("Expected failure unmarshaling bad JSON input.")
+	}
+
+	wl.Remove(net.ParseIP("192.168.3.1"))
+	if _, ok := wl.Label(net.ParseIP("192.168.3.1")); ok {
+		t.Fatal("Expected label to be removed with the address")
+	}
+
+	if out, _ = json.Marshal(wl); string(out) != `"127.0.0.1"` {
+		t.Fatalf("Expected a plain whitelist once labels are gone, but got %s", out)
+	}
+}
+
+func TestFuncACL(t *testing.T) {
+	var acl ACL = FuncACL(func(ip net.IP) bool {
+		return ip.IsLoopback()
+	})
+
+	if !checkIPString(acl, "127.0.0.1", t) || !checkIPString(acl, "::1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	if checkIPString(acl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+}
+
+func TestBasicReplaceAll(t *testing.T) {
+	wl := NewBasic()
+	wl.AddLabeled(net.IP{127, 0, 0, 1}, "loopback")
+	wl.AddLabeled(net.IP{192, 168, 3, 1}, "office")
+
+	wl.ReplaceAll([]net.IP{{127, 0, 0, 1}, {10, 0, 0, 1}, nil})
+	if !wl.Permitted(net.IP{10, 0, 0, 1}) || wl.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected the whitelist to be replaced")
+	}
+
+	if len(wl.whitelist) != 2 {
+		t.Fatalf("Expected 2 entries, have %d", len(wl.whitelist))
+	}
+
+	if label, _ := wl.Label(net.IP{127, 0, 0, 1}); label != "loopback" || len(wl.labels) != 1 {
+		t.Fatal("Expected only the retained entry's label to be kept")
+	}
+
+	// Every replacement keeps 127.0.0.1, so a lookup must never
+	// see it missing.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !wl.Permitted(net.IP{127, 0, 0, 1}) {
+					t.Error("Lookup saw a partially replaced whitelist")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		wl.ReplaceAll([]net.IP{{127, 0, 0, 1}, {10, 0, 0, byte(i)}})
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestPrivateAndLoopback(t *testing.T) {
+	acl := PrivateAndLoopback()
+	tv := map[string]bool{
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"172.31.255.255":  true,
+		"172.32.0.1":      false,
+		"192.168.3.1":     true,
+		"127.0.0.1":       true,
+		"127.255.0.1":     true,
+		"169.254.1.1":     true,
+		"::ffff:10.1.2.3": true,
+		"::1":             true,
+		"fd00::1":         true,
+		"fe80::1":         true,
+		"8.8.8.8":         false,
+		"100.64.0.1":      false,
+		"2001:4860::8888": false,
+		"::ffff:8.8.8.8":  false,
+	}
+
+	for addr, permitted := range tv {
+		if acl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+}
+
+func TestLoopbackOr(t *testing.T) {
+	wl := NewBasic()
+	addIPString(wl, "192.168.3.1", t)
+	acl := LoopbackOr(wl)
+
+	tv := map[string]bool{
+		"127.0.0.1":        true,
+		"127.255.0.1":      true,
+		"::ffff:127.0.0.1": true,
+		"::1":              true,
+		"192.168.3.1":      true,
+		"192.168.3.2":      false,
+		"::2":              false,
+	}
+
+	for addr, permitted := range tv {
+		if checkIPString(acl, addr, t) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	if acl.Permitted(nil) {
+		t.Fatal("Expected an invalid address to be denied")
+	}
+}
+
+func TestBasicOnChange(t *testing.T) {
+	wl := NewBasic()
+	var changes int
+	var seen bool
+	wl.OnChange(func() {
+		changes++
+		// Calling back into the whitelist must not deadlock.
+		seen = wl.Permitted(net.IP{127, 0, 0, 1})
+	})
+
+	wl.Add(net.IP{127, 0, 0, 1})
+	if changes != 1 || !seen {
+		t.Fatalf("Expected one change that sees the new entry, have %d", changes)
+	}
+
+	wl.AddLabeled(net.IP{10, 0, 0, 1}, "internal")
+	wl.Remove(net.IP{127, 0, 0, 1})
+	if changes != 3 || seen {
+		t.Fatalf("Expected three changes, have %d", changes)
+	}
+
+	if err := wl.UnmarshalText([]byte("127.0.0.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	wl.ReplaceAll(nil)
+	if changes != 5 {
+		t.Fatalf("Expected five changes, have %d", changes)
+	}
+
+	wl.OnChange(nil)
+	wl.Add(net.IP{127, 0, 0, 1})
+	if changes != 5 {
+		t.Fatal("Expected no calls after the callback was removed")
+	}
+}
+
+func TestBasicTextualForms(t *testing.T) {
+	forms := []string{
+		"2001:db8::1",
+		"2001:DB8::1",
+		"2001:0db8:0000:0000:0000:0000:0000:0001",
+		"2001:DB8:0:0:0:0:0:1",
+	}
+
+	for _, form := range forms {
+		wl := NewBasic()
+		if err := wl.UnmarshalText([]byte(form)); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		labelled := NewBasic()
+		if err := labelled.UnmarshalJSON([]byte(`{"` + form + `":"office"}`)); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		added := NewBasic()
+		added.AddLabeled(net.ParseIP(form), "office")
+
+		for _, other := range forms {
+			ip := net.ParseIP(other)
+			for _, acl := range []*Basic{wl, labelled, added} {
+				if !acl.Permitted(ip) {
+					t.Fatalf("Expected %s to match an entry added as %s", other, form)
+				}
+			}
+
+			if label, _ := labelled.Label(ip); label != "office" {
+				t.Fatalf("Expected %s to find the label added as %s", other, form)
+			}
+		}
+
+		wl.Remove(net.ParseIP(forms[3]))
+		if len(wl.whitelist) != 0 {
+			t.Fatalf("Expected %s to be removed", form)
+		}
+	}
+
+	wl := NewBasic()
+	if err := wl.UnmarshalText([]byte("::ffff:127.0.0.1")); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !wl.Permitted(net.IP{127, 0, 0, 1}) {
+		t.Fatal("Expected the IPv4-mapped form to match the IPv4 address")
+	}
+}
+
+func TestBasicNormalize(t *testing.T) {
+	wl := NewBasic()
+	wl.whitelist = map[string]bool{
+		"2001:DB8::1":            true,
+		"2001:0db8:0:0:0:0:0:1":  true,
+		"2001:db8::1":            true,
+		"::ffff:192.168.3.1":     true,
+		"10.0.0.1":               false,
+		"not an address":         true,
+		"127.0.0.1":              true,
+		"2001:0db8:0:0:0:0:0:02": true,
+	}
+	wl.labels = map[string]string{
+		"2001:DB8::1":        "upper",
+		"2001:db8::1":        "canonical",
+		"not an address":     "junk",
+		"::ffff:192.168.3.1": "mapped",
+	}
+
+	if removed := wl.Normalize(); removed != 4 {
+		t.Fatalf("Expected 4 entries to be removed, but have %d", removed)
+	}
+
+	expected := []string{"127.0.0.1", "192.168.3.1", "2001:db8::1", "2001:db8::2"}
+	out, _ := wl.MarshalText()
+	if entries := uniqueSorted(strings.Split(string(out), ",")); !equalStrings(entries, expected) {
+		t.Fatalf("Expected %v, but have %v", expected, entries)
+	}
+
+	if label, _ := wl.Label(net.ParseIP("2001:db8::1")); label != "canonical" {
+		t.Fatalf("Expected the canonical entry's label, but have %q", label)
+	}
+
+	if label, _ := wl.Label(net.IP{192, 168, 3, 1}); label != "mapped" {
+		t.Fatalf("Expected the label to follow the entry, but have %q", label)
+	}
+
+	if len(wl.labels) != 2 {
+		t.Fatalf("Expected 2 labels, but have %v", wl.labels)
+	}
+
+	if removed := wl.Normalize(); removed != 0 {
+		t.Fatalf("Expected Normalize to be idempotent, but it removed %d entries", removed)
+	}
+}
@@ -0,0 +1,82 @@
+package whitelist
+
+// This file contains an ACL wrapper that can be switched off without
+// discarding the wrapped ACL's entries.
+
+import (
+	"log"
+	"net"
+	"sync"
+)
+
+// Toggle wraps an ACL so that whitelisting can be turned off, for
+// example during an incident, and later turned back on. While the
+// Toggle is disabled, Permitted returns true for every address; the
+// wrapped ACL is left untouched, so its entries are in force again as
+// soon as the Toggle is re-enabled. A new Toggle is enabled.
+type Toggle struct {
+	lock     *sync.Mutex
+	acl      ACL
+	disabled bool
+}
+
+// NewToggle returns a new, enabled Toggle wrapping the ACL.
+func NewToggle(acl ACL) *Toggle {
+	return &Toggle{
+		lock: new(sync.Mutex),
+		acl:  acl,
+	}
+}
+
+// Permitted returns true if whitelisting is disabled, or if the
+// wrapped ACL permits the IP.
+func (wl *Toggle) Permitted(ip net.IP) bool {
+	wl.lock.Lock()
+	disabled := wl.disabled
+	wl.lock.Unlock()
+
+	if disabled {
+		return true
+	}
+	return wl.acl.Permitted(ip)
+}
+
+// Enable turns whitelisting back on.
+func (wl *Toggle) Enable() {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	if wl.disabled {
+		log.Println("whitelist: whitelisting has been enabled")
+	}
+	wl.disabled = false
+}
+
+// Disable turns whitelisting off, permitting all addresses until
+// Enable is called.
+func (wl *Toggle) Disable() {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	if !wl.disabled {
+		log.Println("WARNING: whitelisting has been disabled; all addresses are permitted")
+	}
+	wl.disabled = true
+}
+
+// Enabled returns true if whitelisting is in force.
+func (wl *Toggle) Enabled() bool {
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	return !wl.disabled
+}
+
+// Stats returns the statistics of the wrapped ACL, if it reports
+// any, noting whether whitelisting is disabled.
+func (wl *Toggle) Stats() Stats {
+	wl.lock.Lock()
+	disabled := wl.disabled
+	wl.lock.Unlock()
+
+	stats := aclStats(wl.acl)
+	stats.Disabled = disabled
+	return stats
+}
@@ -0,0 +1,40 @@
+package whitelist
+
+import "testing"
+
+func TestToggle(t *testing.T) {
+	acl := NewBasic()
+	addIPString(acl, "127.0.0.1", t)
+
+	wl := NewToggle(acl)
+	if !wl.Enabled() {
+		t.Fatal("A new toggle should be enabled")
+	}
+
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	wl.Disable()
+	wl.Disable()
+	if wl.Enabled() {
+		t.Fatal("Toggle should have been disabled")
+	}
+
+	if !checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+
+	wl.Enable()
+	if !wl.Enabled() {
+		t.Fatal("Toggle should have been enabled")
+	}
+
+	if checkIPString(wl, "192.168.3.1", t) {
+		t.Fatal("whitelist should have denied address")
+	}
+
+	if !checkIPString(wl, "127.0.0.1", t) {
+		t.Fatal("whitelist should have permitted address")
+	}
+}
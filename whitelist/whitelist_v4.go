@@ -0,0 +1,79 @@
+package whitelist
+
+// This file contains a compact host whitelist for IPv4-only
+// deployments.
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// ipv4Key returns the 32-bit form of an IPv4 address, including one
+// in its 16-byte IPv4-mapped form. It returns false for IPv6
+// addresses and invalid addresses.
+func ipv4Key(ip net.IP) (uint32, bool) {
+	if !validIP(ip) {
+		return 0, false
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(ip4), true
+}
+
+// Basic4 is a host whitelist specialised to IPv4 addresses. It
+// stores each address as a 32-bit key rather than a string, which
+// takes far less memory than Basic for large whitelists. IPv6
+// addresses are never permitted, and adding one has no effect.
+type Basic4 struct {
+	lock      *sync.Mutex
+	whitelist map[uint32]struct{}
+}
+
+// NewBasic4 returns a new initialised IPv4 host whitelist.
+func NewBasic4() *Basic4 {
+	return &Basic4{
+		lock:      new(sync.Mutex),
+		whitelist: map[uint32]struct{}{},
+	}
+}
+
+// Permitted returns true if the IP is a whitelisted IPv4 address.
+func (wl *Basic4) Permitted(ip net.IP) bool {
+	key, ok := ipv4Key(ip)
+	if !ok {
+		return false
+	}
+
+	wl.lock.Lock()
+	_, permitted := wl.whitelist[key]
+	wl.lock.Unlock()
+	return permitted
+}
+
+// Add whitelists an IPv4 address. Other addresses are ignored.
+func (wl *Basic4) Add(ip net.IP) {
+	key, ok := ipv4Key(ip)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	wl.whitelist[key] = struct{}{}
+}
+
+// Remove clears the IP from the whitelist.
+func (wl *Basic4) Remove(ip net.IP) {
+	key, ok := ipv4Key(ip)
+	if !ok {
+		return
+	}
+
+	wl.lock.Lock()
+	defer wl.lock.Unlock()
+	delete(wl.whitelist, key)
+}
@@ -0,0 +1,45 @@
+package whitelist
+
+import (
+	"net"
+	"testing"
+)
+
+var _ HostACL = NewBasic4()
+
+func TestBasic4(t *testing.T) {
+	wl := NewBasic4()
+	wl.Add(net.IP{127, 0, 0, 1})
+	wl.Add(net.ParseIP("::ffff:192.168.3.1"))
+	wl.Add(net.ParseIP("2001:db8::1"))
+	wl.Add(nil)
+
+	if len(wl.whitelist) != 2 {
+		t.Fatalf("Expected 2 entries, but have %d", len(wl.whitelist))
+	}
+
+	tv := map[string]bool{
+		"127.0.0.1":        true,
+		"::ffff:127.0.0.1": true,
+		"192.168.3.1":      true,
+		"192.168.3.2":      false,
+		"2001:db8::1":      false,
+		"::1":              false,
+	}
+
+	for addr, permitted := range tv {
+		if wl.Permitted(net.ParseIP(addr)) != permitted {
+			t.Fatalf("Expected Permitted(%s) to be %v", addr, permitted)
+		}
+	}
+
+	wl.Remove(net.ParseIP("192.168.3.1"))
+	if wl.Permitted(net.IP{192, 168, 3, 1}) {
+		t.Fatal("Expected 192.168.3.1 to be removed")
+	}
+
+	h, err := NewHandler(testAllowHandler, testDenyHandler, wl)
+	if err != nil || h == nil {
+		t.Fatalf("Expected Basic4 to be usable with a Handler: %v", err)
+	}
+}